@@ -0,0 +1,346 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/eze8789/movies-api/data"
+	"github.com/eze8789/movies-api/validator"
+	"github.com/julienschmidt/httprouter"
+)
+
+const contentTypeZIP = "application/zip"
+
+// deleteCurrentUser schedule the deletion of the authenticated user after the grace period, sign out every
+// session and remove the data exports, the account can be restored until it is deleted by the purgeAccounts job
+func (app *application) deleteCurrentUser(w http.ResponseWriter, r *http.Request) {
+	app.logger.LogInfo(fmt.Sprintf("%s - %s: %s", r.RemoteAddr, r.Method, r.URL.String()), nil)
+	var input struct {
+		Password string `json:"password"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	if data.ValidatePasswordPlain(v, input.Password); !v.Valid() { //nolint:gocritic
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	u, ok := app.readCurrentUser(w, r)
+	if !ok {
+		return
+	}
+
+	match, err := u.Password.Match(input.Password)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if !match {
+		v.AddError("password", "does not match")
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// deleting the account twice keep the first date
+	if u.DeleteAfter == nil {
+		deleteAfter := time.Now().Add(app.config.account.deletionGrace).UTC().Truncate(time.Second)
+		u.DeleteAfter = &deleteAfter
+		err = app.models.Users.Update(u)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrEditConflict):
+				app.editConflictResponse(w, r)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		app.runBackground(func() {
+			tmplData := map[string]interface{}{
+				"userName":    u.Name,
+				"deleteAfter": u.DeleteAfter.Format(time.RFC1123),
+			}
+			mailErr := app.mailer.Send(u.Email, "account_deletion.tmpl", tmplData)
+			if mailErr != nil {
+				app.logger.LogError(mailErr, nil)
+			}
+		})
+	}
+
+	err = app.models.Tokens.DeleteAllForUser(u.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	// the export tokens were deleted with the sessions so the exports can not be downloaded anymore
+	app.removeExports(u.ID)
+
+	msg := envelope{
+		"message":      "the account will be deleted, sign in and restore it before the date to keep it",
+		"delete_after": u.DeleteAfter,
+	}
+	err = app.writeJSON(w, http.StatusAccepted, msg, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// restoreCurrentUser cancel the deletion of the authenticated user
+func (app *application) restoreCurrentUser(w http.ResponseWriter, r *http.Request) {
+	app.logger.LogInfo(fmt.Sprintf("%s - %s: %s", r.RemoteAddr, r.Method, r.URL.String()), nil)
+	u, ok := app.readCurrentUser(w, r)
+	if !ok {
+		return
+	}
+	if u.DeleteAfter == nil {
+		app.errorResponse(w, r, http.StatusConflict, "the account is not scheduled for deletion")
+		return
+	}
+
+	u.DeleteAfter = nil
+	err := app.models.Users.Update(u)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	app.writeCurrentUser(w, r, u)
+}
+
+// exportCurrentUser build a ZIP with the data of the authenticated user in the background and mail the token
+// to download it, requesting a new export remove the previous one
+func (app *application) exportCurrentUser(w http.ResponseWriter, r *http.Request) {
+	app.logger.LogInfo(fmt.Sprintf("%s - %s: %s", r.RemoteAddr, r.Method, r.URL.String()), nil)
+	u, ok := app.readCurrentUser(w, r)
+	if !ok {
+		return
+	}
+
+	err := app.models.Tokens.DeleteAllByUser(u.ID, data.ScopeDataExport)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	app.removeExports(u.ID)
+
+	token, err := app.models.Tokens.New(u.ID, data.DataExportTokenDuration, data.ScopeDataExport)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.runBackground(func() {
+		app.sendExport(u, token)
+	})
+
+	msg := envelope{"message": "an email will be sent with the link to download your data once the export is ready"}
+	err = app.writeJSON(w, http.StatusAccepted, msg, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// sendExport store the export of the user under the key of the token and mail the token
+func (app *application) sendExport(u *data.User, token *data.Token) {
+	archive, err := app.buildExport(u)
+	if err != nil {
+		app.logger.LogError(err, map[string]string{"user_id": strconv.FormatInt(u.ID, 10)})
+		return
+	}
+	err = app.exports.Put(exportKey(u.ID, token.PlainToken), archive, contentTypeZIP)
+	if err != nil {
+		app.logger.LogError(err, map[string]string{"user_id": strconv.FormatInt(u.ID, 10)})
+		return
+	}
+
+	tmplData := map[string]interface{}{
+		"exportToken": token.PlainToken,
+		"userName":    u.Name,
+	}
+	err = app.mailer.Send(u.Email, "data_export.tmpl", tmplData)
+	if err != nil {
+		app.logger.LogError(err, nil)
+	}
+}
+
+// downloadExport send the ZIP of the data-export token, the token can only be used by its user
+func (app *application) downloadExport(w http.ResponseWriter, r *http.Request) {
+	app.logger.LogInfo(fmt.Sprintf("%s - %s: %s", r.RemoteAddr, r.Method, r.URL.String()), nil)
+	tokenPlain := httprouter.ParamsFromContext(r.Context()).ByName("token")
+
+	v := validator.New()
+	if data.ValidateTokenPlain(v, tokenPlain); !v.Valid() { //nolint:gocritic
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	token, err := app.models.Tokens.Get(tokenPlain, data.ScopeDataExport)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	if token.UserID != app.contextGetUser(r).ID {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	archive, err := app.exports.Get(exportKey(token.UserID, tokenPlain))
+	if err != nil {
+		switch {
+		case errors.Is(err, fs.ErrNotExist):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", contentTypeZIP)
+	w.Header().Set("Content-Disposition", `attachment; filename="movies-api-export.zip"`)
+	w.Header().Set("Content-Length", strconv.Itoa(len(archive)))
+	_, err = w.Write(archive)
+	if err != nil {
+		app.logError(r, err)
+	}
+}
+
+// exportKey return the storage key of an export, the hash of the token is used so the files can not be found
+// without it
+func exportKey(userID int64, tokenPlain string) string {
+	hash := sha256.Sum256([]byte(tokenPlain))
+	return fmt.Sprintf("%d/%s.zip", userID, hex.EncodeToString(hash[:]))
+}
+
+// removeExports delete every export of a user from the storage
+func (app *application) removeExports(userID int64) {
+	err := app.exports.DeletePrefix(strconv.FormatInt(userID, 10))
+	if err != nil {
+		app.logger.LogError(err, map[string]string{"user_id": strconv.FormatInt(userID, 10)})
+	}
+}
+
+type exportFile struct {
+	name    string
+	content interface{}
+}
+
+type exportSession struct {
+	Scope  string    `json:"scope"`
+	Expiry time.Time `json:"expiry"`
+}
+
+// buildExport return a ZIP with a JSON file for the profile, permissions, sessions, lists, reviews and revisions
+// of the user
+func (app *application) buildExport(u *data.User) ([]byte, error) {
+	perms, err := app.models.Permissions.GetAllForUser(u.ID)
+	if err != nil {
+		return nil, err
+	}
+	granted, err := app.models.Permissions.GetGrantedForUser(u.ID)
+	if err != nil {
+		return nil, err
+	}
+	roles, err := app.models.Roles.GetAllForUser(u.ID)
+	if err != nil {
+		return nil, err
+	}
+	tokens, err := app.models.Tokens.GetAllForUser(u.ID)
+	if err != nil {
+		return nil, err
+	}
+	// the token hashes are not exported, the sessions can not be used from the file
+	sessions := make([]exportSession, 0, len(tokens))
+	for _, t := range tokens {
+		sessions = append(sessions, exportSession{Scope: t.Scope, Expiry: t.Expiry})
+	}
+
+	files := []exportFile{
+		{"profile.json", envelope{"user": u}},
+		{"permissions.json", envelope{"permissions": perms, "granted": granted, "roles": roles}},
+		{"sessions.json", envelope{"sessions": sessions}},
+	}
+
+	owned, err := app.exportOwnedData(u.ID)
+	if err != nil {
+		return nil, err
+	}
+	files = append(files, owned...)
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	created := time.Now()
+	for _, f := range files {
+		var content []byte
+		var fw io.Writer
+		content, err = json.MarshalIndent(f.content, "", "\t")
+		if err != nil {
+			return nil, err
+		}
+		fw, err = zw.CreateHeader(&zip.FileHeader{Name: f.name, Method: zip.Deflate, Modified: created})
+		if err != nil {
+			return nil, err
+		}
+		_, err = fw.Write(append(content, '\n'))
+		if err != nil {
+			return nil, err
+		}
+	}
+	err = zw.Close()
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// exportOwnedData return the lists with their movies, the reviews and the revisions of a user
+func (app *application) exportOwnedData(userID int64) ([]exportFile, error) {
+	lists, err := app.models.Lists.GetAllForUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, l := range lists {
+		l.Movies, err = app.models.Lists.GetItems(l.ID)
+		if err != nil {
+			return nil, err
+		}
+	}
+	reviews, err := app.models.Reviews.GetAllForUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	revisions, err := app.models.Revisions.GetAllForUser(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return []exportFile{
+		{"lists.json", envelope{"lists": lists}},
+		{"reviews.json", envelope{"reviews": reviews}},
+		{"revisions.json", envelope{"revisions": revisions}},
+	}, nil
+}
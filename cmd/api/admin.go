@@ -0,0 +1,345 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/eze8789/movies-api/data"
+	"github.com/eze8789/movies-api/jsonlog"
+	"github.com/eze8789/movies-api/validator"
+)
+
+const adminUsage = `usage: movies-api [flags] admin <command>
+  create-user -name NAME -email EMAIL [-password PASSWORD] [-activated]
+  activate EMAIL
+  deactivate EMAIL
+  grant EMAIL PERMISSION...
+  revoke EMAIL PERMISSION...
+  permissions EMAIL
+  revoke-tokens EMAIL
+  reset-password [-password PASSWORD] EMAIL
+the password is read from stdin when -password is not set`
+
+var errAdminUsage = errors.New(adminUsage)
+
+// adminCommand manage the users, permissions and tokens from the command line with the same models and
+// validations used by the API
+type adminCommand struct {
+	models data.Models
+	logger *jsonlog.Logger
+	in     io.Reader
+	out    io.Writer
+}
+
+// admin run the admin subcommand
+func admin(models data.Models, logger *jsonlog.Logger, args []string) error {
+	if models.Backend == data.BackendMemory {
+		return errors.New("admin commands need a postgres or sqlite database, set MEMORY_ADMIN_EMAIL and " +
+			"MEMORY_ADMIN_PASSWORD to create an admin on the in-memory backend")
+	}
+	if len(args) == 0 {
+		return errAdminUsage
+	}
+
+	cmd := &adminCommand{models: models, logger: logger, in: os.Stdin, out: os.Stdout}
+	switch args[0] {
+	case "create-user":
+		return cmd.createUser(args[1:])
+	case "activate":
+		return cmd.setActivated(args[1:], true)
+	case "deactivate":
+		return cmd.setActivated(args[1:], false)
+	case "grant":
+		return cmd.grant(args[1:])
+	case "revoke":
+		return cmd.revoke(args[1:])
+	case "permissions":
+		return cmd.permissions(args[1:])
+	case "revoke-tokens":
+		return cmd.revokeTokens(args[1:])
+	case "reset-password":
+		return cmd.resetPassword(args[1:])
+	default:
+		return errAdminUsage
+	}
+}
+
+// seedAdmin create an activated user with every permission, the in-memory backend start empty and the admin
+// commands can not reach the data of a running server
+func seedAdmin(models data.Models, logger *jsonlog.Logger, email, password string) error {
+	user := &data.User{Name: "Admin", Email: email, Activated: true}
+	err := user.Password.Set(password)
+	if err != nil {
+		return err
+	}
+
+	v := validator.New()
+	if data.ValidateUser(v, user); !v.Valid() { //nolint:gocritic
+		return validationError(v)
+	}
+
+	err = models.Users.Insert(user)
+	if err != nil {
+		return err
+	}
+	err = models.Permissions.AddForUser(user.ID, data.PermissionCodes...)
+	if err != nil {
+		return err
+	}
+
+	logger.LogInfo("admin created", map[string]string{"id": strconv.FormatInt(user.ID, 10), "email": user.Email})
+	return nil
+}
+
+func (cmd *adminCommand) createUser(args []string) error {
+	fs := flag.NewFlagSet("create-user", flag.ContinueOnError)
+	name := fs.String("name", "", "User name")
+	email := fs.String("email", "", "User email")
+	password := fs.String("password", "", "User password, read from stdin when empty")
+	activated := fs.Bool("activated", false, "Create the user activated")
+	if err := fs.Parse(args); err != nil || fs.NArg() > 0 {
+		return errAdminUsage
+	}
+
+	pwd, err := cmd.readPassword(*password)
+	if err != nil {
+		return err
+	}
+	user := &data.User{Name: *name, Email: *email, Activated: *activated}
+	err = user.Password.Set(pwd)
+	if err != nil {
+		return err
+	}
+
+	v := validator.New()
+	if data.ValidateUser(v, user); !v.Valid() { //nolint:gocritic
+		return validationError(v)
+	}
+
+	err = cmd.models.Users.Insert(user)
+	if err != nil {
+		return err
+	}
+	// users created by the admin get the same permissions as the registered users
+	err = cmd.models.Permissions.AddForUser(user.ID, "movies:read")
+	if err != nil {
+		return err
+	}
+
+	cmd.logger.LogInfo("user created", map[string]string{
+		"id":        strconv.FormatInt(user.ID, 10),
+		"email":     user.Email,
+		"activated": strconv.FormatBool(user.Activated),
+	})
+	return nil
+}
+
+// setActivated activate or deactivate a user, the tokens of a deactivated user are revoked
+func (cmd *adminCommand) setActivated(args []string, activated bool) error {
+	if len(args) != 1 {
+		return errAdminUsage
+	}
+	user, err := cmd.user(args[0])
+	if err != nil {
+		return err
+	}
+
+	user.Activated = activated
+	err = cmd.models.Users.Update(user)
+	if err != nil {
+		return err
+	}
+
+	msg := "user activated"
+	if activated {
+		err = cmd.models.Tokens.DeleteAllByUser(user.ID, data.ScopeActivation)
+	} else {
+		msg = "user deactivated"
+		err = cmd.models.Tokens.DeleteAllForUser(user.ID)
+	}
+	if err != nil {
+		return err
+	}
+
+	cmd.logger.LogInfo(msg, map[string]string{"id": strconv.FormatInt(user.ID, 10), "email": user.Email})
+	return nil
+}
+
+func (cmd *adminCommand) grant(args []string) error {
+	user, codes, err := cmd.userPermissions(args)
+	if err != nil {
+		return err
+	}
+
+	err = cmd.models.Permissions.AddForUser(user.ID, codes...)
+	if err != nil {
+		return err
+	}
+
+	cmd.logger.LogInfo("permissions granted", map[string]string{"email": user.Email, "permissions": strings.Join(codes, ",")})
+	return nil
+}
+
+func (cmd *adminCommand) revoke(args []string) error {
+	user, codes, err := cmd.userPermissions(args)
+	if err != nil {
+		return err
+	}
+
+	err = cmd.models.Permissions.RemoveForUser(user.ID, codes...)
+	if err != nil {
+		return err
+	}
+
+	cmd.logger.LogInfo("permissions revoked", map[string]string{"email": user.Email, "permissions": strings.Join(codes, ",")})
+	return nil
+}
+
+// permissions print the permissions of a user, one per line
+func (cmd *adminCommand) permissions(args []string) error {
+	if len(args) != 1 {
+		return errAdminUsage
+	}
+	user, err := cmd.user(args[0])
+	if err != nil {
+		return err
+	}
+
+	perms, err := cmd.models.Permissions.GetAllForUser(user.ID)
+	if err != nil {
+		return err
+	}
+	sort.Strings(perms)
+	for _, p := range perms {
+		fmt.Fprintln(cmd.out, p)
+	}
+	return nil
+}
+
+func (cmd *adminCommand) revokeTokens(args []string) error {
+	if len(args) != 1 {
+		return errAdminUsage
+	}
+	user, err := cmd.user(args[0])
+	if err != nil {
+		return err
+	}
+
+	err = cmd.models.Tokens.DeleteAllForUser(user.ID)
+	if err != nil {
+		return err
+	}
+
+	cmd.logger.LogInfo("tokens revoked", map[string]string{"id": strconv.FormatInt(user.ID, 10), "email": user.Email})
+	return nil
+}
+
+// resetPassword set a new password and revoke the tokens so the user must authenticate again
+func (cmd *adminCommand) resetPassword(args []string) error {
+	fs := flag.NewFlagSet("reset-password", flag.ContinueOnError)
+	password := fs.String("password", "", "New password, read from stdin when empty")
+	if err := fs.Parse(args); err != nil || fs.NArg() != 1 {
+		return errAdminUsage
+	}
+	user, err := cmd.user(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	pwd, err := cmd.readPassword(*password)
+	if err != nil {
+		return err
+	}
+	v := validator.New()
+	if data.ValidatePasswordPlain(v, pwd); !v.Valid() { //nolint:gocritic
+		return validationError(v)
+	}
+
+	err = user.Password.Set(pwd)
+	if err != nil {
+		return err
+	}
+	err = cmd.models.Users.Update(user)
+	if err != nil {
+		return err
+	}
+	err = cmd.models.Tokens.DeleteAllForUser(user.ID)
+	if err != nil {
+		return err
+	}
+
+	cmd.logger.LogInfo("password reset", map[string]string{"id": strconv.FormatInt(user.ID, 10), "email": user.Email})
+	return nil
+}
+
+// user return the user with the email after validating it
+func (cmd *adminCommand) user(email string) (*data.User, error) {
+	v := validator.New()
+	if data.ValidateEmail(v, email); !v.Valid() { //nolint:gocritic
+		return nil, validationError(v)
+	}
+
+	user, err := cmd.models.Users.GetByEmail(email)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			return nil, fmt.Errorf("user %s not found", email)
+		default:
+			return nil, err
+		}
+	}
+	return user, nil
+}
+
+// userPermissions return the user and the permission codes passed as EMAIL PERMISSION...
+func (cmd *adminCommand) userPermissions(args []string) (*data.User, []string, error) {
+	if len(args) < 2 { //nolint:gomnd
+		return nil, nil, errAdminUsage
+	}
+
+	v := validator.New()
+	if data.ValidatePermissionCodes(v, args[1:]); !v.Valid() { //nolint:gocritic
+		return nil, nil, validationError(v)
+	}
+
+	user, err := cmd.user(args[0])
+	if err != nil {
+		return nil, nil, err
+	}
+	return user, args[1:], nil
+}
+
+// readPassword return the password flag or the first line read from stdin
+func (cmd *adminCommand) readPassword(password string) (string, error) {
+	if password != "" {
+		return password, nil
+	}
+
+	line, err := bufio.NewReader(cmd.in).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// validationError return the validator errors sorted by key as a single error
+func validationError(v *validator.Validator) error {
+	keys := make([]string, 0, len(v.Errors))
+	for k := range v.Errors {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	msgs := make([]string, 0, len(keys))
+	for _, k := range keys {
+		msgs = append(msgs, fmt.Sprintf("%s: %s", k, v.Errors[k]))
+	}
+	return fmt.Errorf("validation failed: %s", strings.Join(msgs, ", "))
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"net"
 	"net/http"
 
 	"github.com/eze8789/movies-api/data"
@@ -9,7 +10,11 @@ import (
 
 type contextKey string
 
-const userContextKey = contextKey("user")
+const (
+	userContextKey        = contextKey("user")
+	permissionsContextKey = contextKey("permissions")
+	connContextKey        = contextKey("conn")
+)
 
 // contextSetUser return a new copy of the request using our own custom key to add the User struct for authentication
 func (app *application) contextSetUser(r *http.Request, user *data.User) *http.Request {
@@ -26,3 +31,27 @@ func (app *application) contextGetUser(r *http.Request) *data.User {
 	}
 	return user
 }
+
+// contextSetPermissions return a new copy of the request with the permissions of the authenticated user
+func (app *application) contextSetPermissions(r *http.Request, perms data.Permissions) *http.Request {
+	ctx := context.WithValue(r.Context(), permissionsContextKey, perms)
+	return r.WithContext(ctx)
+}
+
+// contextGetPermissions return the permissions loaded by reqPermission during the request
+func (app *application) contextGetPermissions(r *http.Request) (data.Permissions, bool) {
+	perms, ok := r.Context().Value(permissionsContextKey).(data.Permissions)
+	return perms, ok
+}
+
+// contextSetConn return the connection context with the connection, it is set by the server ConnContext so the
+// handlers can change the deadlines of their connection
+func contextSetConn(ctx context.Context, c net.Conn) context.Context {
+	return context.WithValue(ctx, connContextKey, c)
+}
+
+// contextGetConn return the connection of the request
+func (app *application) contextGetConn(r *http.Request) (net.Conn, bool) {
+	c, ok := r.Context().Value(connContextKey).(net.Conn)
+	return c, ok
+}
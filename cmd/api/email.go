@@ -0,0 +1,225 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/eze8789/movies-api/data"
+	"github.com/eze8789/movies-api/validator"
+)
+
+// requestEmailChange send a confirmation token to the new address, the email is changed once the token is
+// confirmed so a typo can not lock the user out of the account
+func (app *application) requestEmailChange(w http.ResponseWriter, r *http.Request) {
+	app.logger.LogInfo(fmt.Sprintf("%s - %s: %s", r.RemoteAddr, r.Method, r.URL.String()), nil)
+	var input struct {
+		Email    string `json:"email"`
+		Password string `json:"password"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	data.ValidateEmail(v, input.Email)
+	data.ValidatePasswordPlain(v, input.Password)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	u, ok := app.readCurrentUser(w, r)
+	if !ok {
+		return
+	}
+
+	match, err := u.Password.Match(input.Password)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if !match {
+		v.AddError("password", "does not match")
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if strings.EqualFold(u.Email, input.Email) {
+		v.AddError("email", "must be different from the current email")
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	_, err = app.models.Users.GetByEmail(input.Email)
+	switch {
+	case err == nil:
+		v.AddError("email", "email already registered")
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	case !errors.Is(err, data.ErrRecordNotFound):
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// only the last address requested can be confirmed
+	err = app.models.Tokens.DeleteAllByUser(u.ID, data.ScopeEmailChange)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	token, err := app.models.Tokens.NewForEmail(u.ID, data.EmailChangeTokenDuration, data.ScopeEmailChange, input.Email)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.runBackground(func() {
+		tmplData := map[string]interface{}{
+			"emailChangeToken": token.PlainToken,
+			"userName":         u.Name,
+		}
+		mailErr := app.mailer.Send(input.Email, "email_change.tmpl", tmplData)
+		if mailErr != nil {
+			app.logger.LogError(mailErr, nil)
+		}
+	})
+
+	msg := envelope{"message": "an email will be sent to the new address with confirmation instructions"}
+	err = app.writeJSON(w, http.StatusAccepted, msg, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// confirmEmailChange set the address held by the email-change token, the previous address get a token to
+// revert the change in case the account was taken over
+func (app *application) confirmEmailChange(w http.ResponseWriter, r *http.Request) {
+	app.logger.LogInfo(fmt.Sprintf("%s - %s: %s", r.RemoteAddr, r.Method, r.URL.String()), nil)
+	token, u, ok := app.readEmailToken(w, r, data.ScopeEmailChange)
+	if !ok {
+		return
+	}
+
+	previous := u.Email
+	u.Email = token.Email
+	if !app.updateEmail(w, r, u) {
+		return
+	}
+
+	err := app.models.Tokens.DeleteAllByUser(u.ID, data.ScopeEmailChange)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	revert, err := app.models.Tokens.NewForEmail(u.ID, data.EmailRevertTokenDuration, data.ScopeEmailRevert, previous)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.runBackground(func() {
+		tmplData := map[string]interface{}{
+			"revertToken": revert.PlainToken,
+			"userName":    u.Name,
+			"newEmail":    u.Email,
+		}
+		mailErr := app.mailer.Send(previous, "email_changed.tmpl", tmplData)
+		if mailErr != nil {
+			app.logger.LogError(mailErr, nil)
+		}
+	})
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"user": u}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// revertEmailChange restore the address held by the email-revert token, every token of the user is deleted
+// so whoever changed the email is signed out
+func (app *application) revertEmailChange(w http.ResponseWriter, r *http.Request) {
+	app.logger.LogInfo(fmt.Sprintf("%s - %s: %s", r.RemoteAddr, r.Method, r.URL.String()), nil)
+	token, u, ok := app.readEmailToken(w, r, data.ScopeEmailRevert)
+	if !ok {
+		return
+	}
+
+	u.Email = token.Email
+	if !app.updateEmail(w, r, u) {
+		return
+	}
+
+	err := app.models.Tokens.DeleteAllForUser(u.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	msg := envelope{"message": "email restored, every session was signed out and a password reset is recommended"}
+	err = app.writeJSON(w, http.StatusOK, msg, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// readEmailToken return the token in the request body and its user, the error response is already sent when
+// the token is not valid
+func (app *application) readEmailToken(w http.ResponseWriter, r *http.Request, scope string) (*data.Token, *data.User, bool) {
+	var input struct {
+		TokenPlain string `json:"token"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return nil, nil, false
+	}
+
+	v := validator.New()
+	if data.ValidateTokenPlain(v, input.TokenPlain); !v.Valid() { //nolint:gocritic
+		app.failedValidationResponse(w, r, v.Errors)
+		return nil, nil, false
+	}
+
+	token, err := app.models.Tokens.Get(input.TokenPlain, scope)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("token", "invalid or expired token")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, nil, false
+	}
+
+	// the tokens are deleted with the user so the user exist
+	u, err := app.models.Users.Get(token.UserID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return nil, nil, false
+	}
+	return token, u, true
+}
+
+// updateEmail store the new email of the user, the address can be registered by another user after the token
+// was sent so the duplicated email is checked again
+func (app *application) updateEmail(w http.ResponseWriter, r *http.Request, u *data.User) bool {
+	err := app.models.Users.Update(u)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicatedEmail):
+			v := validator.New()
+			v.AddError("email", "email already registered")
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return false
+	}
+	return true
+}
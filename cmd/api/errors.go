@@ -3,6 +3,7 @@ package main
 import (
 	"fmt"
 	"net/http"
+	"strings"
 )
 
 func (app *application) logError(r *http.Request, err error) {
@@ -53,6 +54,20 @@ func (app *application) editConflictResponse(w http.ResponseWriter, r *http.Requ
 	app.errorResponse(w, r, http.StatusConflict, msg)
 }
 
+func (app *application) patchTestFailedResponse(w http.ResponseWriter, r *http.Request, err error) {
+	app.errorResponse(w, r, http.StatusConflict, err.Error())
+}
+
+func (app *application) preconditionFailedResponse(w http.ResponseWriter, r *http.Request) {
+	msg := "the resource was modified, the If-Match precondition failed"
+	app.errorResponse(w, r, http.StatusPreconditionFailed, msg)
+}
+
+func (app *application) unsupportedMediaTypeResponse(w http.ResponseWriter, r *http.Request, supported ...string) {
+	msg := fmt.Sprintf("unsupported Content-Type, use one of: %s", strings.Join(supported, ", "))
+	app.errorResponse(w, r, http.StatusUnsupportedMediaType, msg)
+}
+
 func (app *application) rateLimitExceedResponse(w http.ResponseWriter, r *http.Request) {
 	msg := "too many requests, rate limit exceeded"
 	app.errorResponse(w, r, http.StatusTooManyRequests, msg)
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/eze8789/movies-api/data"
+	"github.com/eze8789/movies-api/validator"
+)
+
+const (
+	exportNDJSON     = "ndjson"
+	exportCSV        = "csv"
+	exportFlushEvery = 100
+)
+
+// exportFormat return the format requested in the format parameter or the Accept header, NDJSON is the default
+func exportFormat(r *http.Request) string {
+	if format := r.URL.Query().Get("format"); format != "" {
+		return format
+	}
+
+	for _, accept := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(accept))
+		if err != nil {
+			continue
+		}
+		switch mediaType {
+		case contentTypeCSV:
+			return exportCSV
+		case contentTypeNDJSON:
+			return exportNDJSON
+		}
+	}
+	return exportNDJSON
+}
+
+// exportMovies stream the whole catalogue filtered by title and genres as NDJSON or CSV, the rows are read
+// from a database cursor and flushed while they are read. The query is cancelled when the client disconnects.
+// The export must finish before the server write timeout.
+func (app *application) exportMovies(w http.ResponseWriter, r *http.Request) {
+	app.logger.LogInfo(fmt.Sprintf("%s - %s: %s", r.RemoteAddr, r.Method, r.URL.String()), nil)
+	v := validator.New()
+	qs := r.URL.Query()
+
+	title := app.readString(qs, "title", "")
+	genres := app.readCSV(qs, "genres", []string{})
+	format := exportFormat(r)
+	v.Check(v.In(format, exportNDJSON, exportCSV), "format", "must be ndjson or csv")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	index, err := app.models.Genres.Index()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	genres = normalizeGenreFilter(index, genres)
+
+	var write func(*data.Movie) error
+	var flush func() error
+	contentType := contentTypeNDJSON
+	switch format {
+	case exportCSV:
+		cw := csv.NewWriter(w)
+		contentType = contentTypeCSV
+		header := []string{"id", "title", "year", "runtime", "genres", "average_rating", "rating_count", "version",
+			"created_at"}
+		write = func(m *data.Movie) error {
+			return cw.Write([]string{strconv.FormatInt(m.ID, 10), m.Title, strconv.Itoa(int(m.Year)),
+				strconv.Itoa(int(m.Runtime)), strings.Join(m.Genres, "|"),
+				strconv.FormatFloat(float64(m.AverageRating), 'f', -1, 32), strconv.Itoa(int(m.RatingCount)),
+				strconv.Itoa(int(m.Version)), m.CreatedAt.Format(time.RFC3339)})
+		}
+		flush = func() error {
+			cw.Flush()
+			return cw.Error()
+		}
+		// the header is buffered by the writer until the first flush
+		if err := cw.Write(header); err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	default:
+		enc := json.NewEncoder(w)
+		write = func(m *data.Movie) error { return enc.Encode(m) }
+		flush = func() error { return nil }
+	}
+
+	// the headers are sent with the first row so errors before it still get a proper response
+	started := false
+	start := func() {
+		started = true
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"movies.%s\"", format))
+		w.WriteHeader(http.StatusOK)
+	}
+
+	// the server write timeout is too short for a big export, the connection deadline is replaced by the
+	// export timeout and the query is cancelled when it expire
+	if conn, ok := app.contextGetConn(r); ok {
+		err = conn.SetWriteDeadline(time.Now().Add(app.config.export.timeout))
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), app.config.export.timeout)
+	defer cancel()
+
+	flusher, _ := w.(http.Flusher)
+	rows := 0
+	err = app.models.Movies.Export(ctx, title, genres, func(m *data.Movie) error {
+		if !started {
+			start()
+		}
+		if err := write(m); err != nil {
+			return err
+		}
+		rows++
+		if rows%exportFlushEvery == 0 {
+			if err := flush(); err != nil {
+				return err
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+		return nil
+	})
+	if err == nil && !started {
+		start()
+	}
+	if err == nil {
+		err = flush()
+	}
+
+	switch {
+	case err == nil || errors.Is(err, context.Canceled):
+	case !started:
+		app.serverErrorResponse(w, r, err)
+	default:
+		// the response is already in progress, the client gets a truncated export
+		app.logError(r, err)
+	}
+}
@@ -0,0 +1,399 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/eze8789/movies-api/data"
+	"github.com/eze8789/movies-api/jsonlog"
+	"github.com/eze8789/movies-api/mails"
+)
+
+const (
+	testAdminEmail = "admin@example.com"
+	testPassword   = "pa55word1234"
+)
+
+// the metrics middleware publish the expvar counters once, the tests share the application and its handler
+var (
+	testOnce    sync.Once
+	testApp     *application
+	testHandler http.Handler
+)
+
+// newTestApplication return the application on the in-memory backend seeded with an admin and its handler
+func newTestApplication(t *testing.T) (*application, http.Handler) {
+	t.Helper()
+	testOnce.Do(func() {
+		logger := jsonlog.New(io.Discard, jsonlog.LevelOff)
+		testApp = &application{
+			logger:  logger,
+			models:  data.NewMemoryModels(),
+			mailer:  mails.New("localhost", 0, "", "", "movies@example.com"),
+			imports: newImportStore(),
+		}
+		err := seedAdmin(testApp.models, logger, testAdminEmail, testPassword)
+		if err != nil {
+			t.Fatal(err)
+		}
+		testHandler = testApp.routes()
+	})
+	if testHandler == nil {
+		t.Fatal("the test application was not created")
+	}
+	return testApp, testHandler
+}
+
+// testRequest send a request with the bearer token and JSON body to the handler
+func testRequest(t *testing.T, h http.Handler, method, path, token string, body interface{},
+	headers map[string]string) *httptest.ResponseRecorder {
+	t.Helper()
+	var buf bytes.Buffer
+	if body != nil {
+		err := json.NewEncoder(&buf).Encode(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r := httptest.NewRequest(method, path, &buf)
+	if body != nil {
+		r.Header.Set("Content-Type", "application/json")
+	}
+	if token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+	for k, v := range headers {
+		r.Header.Set(k, v)
+	}
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+// decodeResponse read the JSON body of a response checking its status
+func decodeResponse(t *testing.T, w *httptest.ResponseRecorder, status int, dst interface{}) {
+	t.Helper()
+	if w.Code != status {
+		t.Fatalf("got status %d, want %d: %s", w.Code, status, w.Body.String())
+	}
+	if dst == nil {
+		return
+	}
+	err := json.Unmarshal(w.Body.Bytes(), dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// testToken return an authentication token of the admin, the tokens are created with the model because the
+// passwords are slow to compare
+func testToken(t *testing.T, app *application) string {
+	t.Helper()
+	admin, err := app.models.Users.GetByEmail(testAdminEmail)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := app.models.Tokens.New(admin.ID, time.Hour, data.ScopeAuthentication)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token.PlainToken
+}
+
+// createTestMovie create a movie with the admin token and return its id
+func createTestMovie(t *testing.T, h http.Handler, token, title string, genres ...string) int64 {
+	t.Helper()
+	var resp struct {
+		Movie data.Movie `json:"movie"`
+	}
+	movie := map[string]interface{}{"title": title, "year": 2001, "runtime": "120 mins", "genres": genres}
+	w := testRequest(t, h, http.MethodPost, "/v1/movies", token, movie, nil)
+	decodeResponse(t, w, http.StatusOK, &resp)
+	return resp.Movie.ID
+}
+
+type testMovies struct {
+	Movies []*data.Movie `json:"movies"`
+}
+
+// titles return the titles of the movies in the order of the response
+func (m testMovies) titles() []string {
+	titles := make([]string, 0, len(m.Movies))
+	for _, movie := range m.Movies {
+		titles = append(titles, movie.Title)
+	}
+	return titles
+}
+
+func TestMovieVersionConflict(t *testing.T) {
+	app, h := newTestApplication(t)
+	token := testToken(t, app)
+	path := fmt.Sprintf("/v1/movies/%d", createTestMovie(t, h, token, "Version Conflict", "drama"))
+
+	w := testRequest(t, h, http.MethodGet, path, token, nil, nil)
+	decodeResponse(t, w, http.StatusOK, nil)
+	etag := w.Header().Get("ETag")
+	if etag == "" {
+		t.Fatal("the movie has no ETag")
+	}
+
+	w = testRequest(t, h, http.MethodPatch, path, token, map[string]string{"title": "Version Conflict 2"},
+		map[string]string{"If-Match": etag})
+	decodeResponse(t, w, http.StatusOK, nil)
+	if w.Header().Get("ETag") == etag {
+		t.Fatal("the ETag did not change with the version")
+	}
+
+	// the tag read before the update is stale
+	w = testRequest(t, h, http.MethodPatch, path, token, map[string]string{"title": "Version Conflict 3"},
+		map[string]string{"If-Match": etag})
+	decodeResponse(t, w, http.StatusPreconditionFailed, nil)
+
+	w = testRequest(t, h, http.MethodDelete, path, token, nil, map[string]string{"If-Match": etag})
+	decodeResponse(t, w, http.StatusPreconditionFailed, nil)
+
+	var resp struct {
+		Movie data.Movie `json:"movie"`
+	}
+	w = testRequest(t, h, http.MethodGet, path, token, nil, nil)
+	decodeResponse(t, w, http.StatusOK, &resp)
+	if resp.Movie.Title != "Version Conflict 2" || resp.Movie.Version != 2 {
+		t.Fatalf("got %q version %d, want the first update", resp.Movie.Title, resp.Movie.Version)
+	}
+}
+
+func TestRegisterDuplicatedEmail(t *testing.T) {
+	_, h := newTestApplication(t)
+	user := map[string]string{"name": "Bob", "email": "bob@example.com", "password": testPassword}
+
+	w := testRequest(t, h, http.MethodPost, "/v1/users", "", user, nil)
+	decodeResponse(t, w, http.StatusAccepted, nil)
+
+	var resp struct {
+		Error map[string]string `json:"error"`
+	}
+	w = testRequest(t, h, http.MethodPost, "/v1/users", "", user, nil)
+	decodeResponse(t, w, http.StatusUnprocessableEntity, &resp)
+	if resp.Error["email"] != "email already registered" {
+		t.Fatalf("got errors %v, want the email already registered", resp.Error)
+	}
+
+	// the emails are compared ignoring case
+	user["email"] = "BOB@example.com"
+	w = testRequest(t, h, http.MethodPost, "/v1/users", "", user, nil)
+	decodeResponse(t, w, http.StatusUnprocessableEntity, nil)
+}
+
+func TestExpiredToken(t *testing.T) {
+	app, h := newTestApplication(t)
+	admin, err := app.models.Users.GetByEmail(testAdminEmail)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expired, err := app.models.Tokens.New(admin.ID, -time.Minute, data.ScopeAuthentication)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := testRequest(t, h, http.MethodGet, "/v1/movies", expired.PlainToken, nil, nil)
+	decodeResponse(t, w, http.StatusUnauthorized, nil)
+
+	valid, err := app.models.Tokens.New(admin.ID, time.Minute, data.ScopeAuthentication)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w = testRequest(t, h, http.MethodGet, "/v1/movies", valid.PlainToken, nil, nil)
+	decodeResponse(t, w, http.StatusOK, nil)
+}
+
+func TestListMoviesTitleSearch(t *testing.T) {
+	app, h := newTestApplication(t)
+	token := testToken(t, app)
+	createTestMovie(t, h, token, "Zebra Crossing", "comedy")
+	createTestMovie(t, h, token, "The Zebra Returns", "comedy")
+	createTestMovie(t, h, token, "Crossing Lines", "comedy")
+
+	tests := []struct {
+		title string
+		want  []string
+	}{
+		{"zebra", []string{"The Zebra Returns", "Zebra Crossing"}},
+		{"ZEBRA crossing", []string{"Zebra Crossing"}},
+		{"unicorn", []string{}},
+	}
+	for _, tt := range tests {
+		var resp testMovies
+		path := fmt.Sprintf("/v1/movies?sort=title&title=%s", url.QueryEscape(tt.title))
+		w := testRequest(t, h, http.MethodGet, path, token, nil, nil)
+		decodeResponse(t, w, http.StatusOK, &resp)
+		if got := resp.titles(); fmt.Sprint(got) != fmt.Sprint(tt.want) {
+			t.Errorf("title %q: got %v, want %v", tt.title, got, tt.want)
+		}
+	}
+}
+
+func TestListMoviesGenreContainment(t *testing.T) {
+	app, h := newTestApplication(t)
+	token := testToken(t, app)
+	createTestMovie(t, h, token, "Western Space", "western", "sci-fi")
+	createTestMovie(t, h, token, "Western Plain", "western")
+	createTestMovie(t, h, token, "Space Plain", "Science Fiction")
+
+	tests := []struct {
+		genres string
+		want   []string
+	}{
+		{"western", []string{"Western Plain", "Western Space"}},
+		{"western,sci-fi", []string{"Western Space"}},
+		// the filter is normalized with the aliases of the catalogue
+		{"scifi", []string{"Space Plain", "Western Space"}},
+		{"western,horror", []string{}},
+	}
+	for _, tt := range tests {
+		var resp testMovies
+		w := testRequest(t, h, http.MethodGet, "/v1/movies?sort=title&genres="+tt.genres, token, nil, nil)
+		decodeResponse(t, w, http.StatusOK, &resp)
+		if got := resp.titles(); fmt.Sprint(got) != fmt.Sprint(tt.want) {
+			t.Errorf("genres %q: got %v, want %v", tt.genres, got, tt.want)
+		}
+	}
+
+	w := testRequest(t, h, http.MethodPost, "/v1/movies", token,
+		map[string]interface{}{"title": "Unknown", "year": 2001, "runtime": "90 mins", "genres": []string{"polka"}}, nil)
+	decodeResponse(t, w, http.StatusUnprocessableEntity, nil)
+}
+
+func TestReviewsAndRevisions(t *testing.T) {
+	app, h := newTestApplication(t)
+	token := testToken(t, app)
+	path := fmt.Sprintf("/v1/movies/%d", createTestMovie(t, h, token, "Reviewed", "drama"))
+
+	w := testRequest(t, h, http.MethodPost, path+"/reviews", token, map[string]interface{}{"rating": 8}, nil)
+	decodeResponse(t, w, http.StatusCreated, nil)
+	w = testRequest(t, h, http.MethodPost, path+"/reviews", token, map[string]interface{}{"rating": 6}, nil)
+	decodeResponse(t, w, http.StatusUnprocessableEntity, nil)
+
+	var movie struct {
+		Movie data.Movie `json:"movie"`
+	}
+	w = testRequest(t, h, http.MethodGet, path, token, nil, nil)
+	decodeResponse(t, w, http.StatusOK, &movie)
+	if movie.Movie.RatingCount != 1 || movie.Movie.AverageRating != 8 {
+		t.Fatalf("got %d ratings with average %v, want 1 with average 8", movie.Movie.RatingCount,
+			movie.Movie.AverageRating)
+	}
+
+	w = testRequest(t, h, http.MethodPatch, path, token, map[string]string{"title": "Reviewed Again"}, nil)
+	decodeResponse(t, w, http.StatusOK, nil)
+
+	var resp struct {
+		Revisions []*data.Revision `json:"revisions"`
+	}
+	w = testRequest(t, h, http.MethodGet, path+"/revisions", token, nil, nil)
+	decodeResponse(t, w, http.StatusOK, &resp)
+	if len(resp.Revisions) != 2 || resp.Revisions[0].Action != data.RevisionUpdate ||
+		resp.Revisions[1].Action != data.RevisionInsert {
+		t.Fatalf("got %d revisions, want the update and the insert", len(resp.Revisions))
+	}
+	if name := resp.Revisions[0].UserName; name == nil || *name != "Admin" {
+		t.Fatalf("got user name %v, want the admin", name)
+	}
+
+	w = testRequest(t, h, http.MethodPost, path+"/revisions/1/restore", token, nil, nil)
+	decodeResponse(t, w, http.StatusOK, &movie)
+	if movie.Movie.Title != "Reviewed" || movie.Movie.Version != 3 {
+		t.Fatalf("got %q version %d, want the first title in version 3", movie.Movie.Title, movie.Movie.Version)
+	}
+}
+
+func TestUserLists(t *testing.T) {
+	app, h := newTestApplication(t)
+	token := testToken(t, app)
+	movieID := createTestMovie(t, h, token, "Listed", "comedy")
+
+	var resp struct {
+		Lists []*data.List `json:"lists"`
+	}
+	w := testRequest(t, h, http.MethodGet, "/v1/users/me/lists", token, nil, nil)
+	decodeResponse(t, w, http.StatusOK, &resp)
+	if len(resp.Lists) == 0 || !resp.Lists[0].Default || resp.Lists[0].Name != data.DefaultListName {
+		t.Fatalf("got lists %v, want the default watchlist first", resp.Lists)
+	}
+	path := fmt.Sprintf("/v1/users/me/lists/%d", resp.Lists[0].ID)
+
+	// the name of the default list is reserved
+	w = testRequest(t, h, http.MethodPost, "/v1/users/me/lists", token, map[string]string{"name": data.DefaultListName},
+		nil)
+	decodeResponse(t, w, http.StatusUnprocessableEntity, nil)
+
+	var list struct {
+		List data.List `json:"list"`
+	}
+	w = testRequest(t, h, http.MethodPost, path+"/movies", token, map[string]int64{"movie_id": movieID}, nil)
+	decodeResponse(t, w, http.StatusCreated, &list)
+	if len(list.List.Movies) != 1 || list.List.Movies[0].Title != "Listed" {
+		t.Fatalf("got movies %v, want the movie added", list.List.Movies)
+	}
+	w = testRequest(t, h, http.MethodPost, path+"/movies", token, map[string]int64{"movie_id": movieID}, nil)
+	decodeResponse(t, w, http.StatusUnprocessableEntity, nil)
+
+	// the movies moved to the trash are removed from the lists and can be added again once restored
+	w = testRequest(t, h, http.MethodDelete, fmt.Sprintf("/v1/movies/%d", movieID), token, nil, nil)
+	decodeResponse(t, w, http.StatusOK, nil)
+	list.List = data.List{}
+	w = testRequest(t, h, http.MethodGet, path, token, nil, nil)
+	decodeResponse(t, w, http.StatusOK, &list)
+	if list.List.MovieCount != 0 || len(list.List.Movies) != 0 {
+		t.Fatalf("got %d movies in the list, want none", list.List.MovieCount)
+	}
+	w = testRequest(t, h, http.MethodPost, fmt.Sprintf("/v1/movies/%d/restore", movieID), token, nil, nil)
+	decodeResponse(t, w, http.StatusOK, nil)
+	w = testRequest(t, h, http.MethodPost, path+"/movies", token, map[string]int64{"movie_id": movieID}, nil)
+	decodeResponse(t, w, http.StatusCreated, nil)
+}
+
+func TestBackgroundImport(t *testing.T) {
+	app, h := newTestApplication(t)
+	token := testToken(t, app)
+
+	// one row more than the synchronous limit and a row with a bad runtime
+	var body bytes.Buffer
+	body.WriteString("title,year,runtime,genres\n")
+	for i := 0; i < importSyncRows; i++ {
+		fmt.Fprintf(&body, "Imported %d,2001,%d mins,drama\n", i, 90+i%60)
+	}
+	body.WriteString("Broken,2001,long,drama\n")
+	r := httptest.NewRequest(http.MethodPost, "/v1/movies/import", &body)
+	r.Header.Set("Content-Type", contentTypeCSV)
+	r.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+
+	var resp struct {
+		Job importJob `json:"job"`
+	}
+	decodeResponse(t, w, http.StatusAccepted, &resp)
+	for i := 0; resp.Job.Status == importRunning && i < 100; i++ {
+		time.Sleep(50 * time.Millisecond)
+		w = testRequest(t, h, http.MethodGet, "/v1/imports/"+resp.Job.ID, token, nil, nil)
+		decodeResponse(t, w, http.StatusOK, &resp)
+	}
+	if resp.Job.Status != importFinished || resp.Job.Report == nil {
+		t.Fatalf("got job status %q, want %q", resp.Job.Status, importFinished)
+	}
+	report := resp.Job.Report
+	if report.TotalRows != importSyncRows+1 || report.Imported != importSyncRows || len(report.Errors) != 1 {
+		t.Fatalf("got %d rows, %d imported and %d errors, want %d rows, %d imported and 1 error", report.TotalRows,
+			report.Imported, len(report.Errors), importSyncRows+1, importSyncRows)
+	}
+}
@@ -1,6 +1,8 @@
 package main
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -10,17 +12,23 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/eze8789/movies-api/validator"
 	"github.com/julienschmidt/httprouter"
 )
 
 func (app *application) readIDParam(r *http.Request) (int64, error) {
+	return app.readInt64Param(r, "id")
+}
+
+// readInt64Param return the positive integer stored in the named route parameter
+func (app *application) readInt64Param(r *http.Request, name string) (int64, error) {
 	params := httprouter.ParamsFromContext(r.Context())
 
-	id, err := strconv.ParseInt(params.ByName("id"), 10, 64)
+	id, err := strconv.ParseInt(params.ByName(name), 10, 64)
 	if err != nil || id < 1 {
-		return 0, errors.New("invalid id parameter")
+		return 0, fmt.Errorf("invalid %s parameter", name)
 	}
 	return id, nil
 }
@@ -43,6 +51,55 @@ func (app *application) writeJSON(w http.ResponseWriter, status int, data envelo
 	return nil
 }
 
+// etag return a strong entity tag derived from the given values, e.g. the id and version of a record
+func (app *application) etag(values ...interface{}) string {
+	hash := sha256.Sum256([]byte(fmt.Sprint(values...)))
+	return fmt.Sprintf("%q", hex.EncodeToString(hash[:8]))
+}
+
+// etagMatches report if etag is part of the comma separated list of entity tags in the header,
+// weak tags only match when weak comparison is requested
+func etagMatches(header, etag string, weak bool) bool {
+	for _, t := range strings.Split(header, ",") {
+		t = strings.TrimSpace(t)
+		if t == "*" {
+			return true
+		}
+		if strings.HasPrefix(t, "W/") {
+			if !weak {
+				continue
+			}
+			t = strings.TrimPrefix(t, "W/")
+		}
+		if t == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// checkIfMatch report if the request can modify the resource with the given etag, requests without
+// If-Match header are always allowed
+func (app *application) checkIfMatch(r *http.Request, etag string) bool {
+	h := r.Header.Get("If-Match")
+	if h == "" {
+		return true
+	}
+	return etagMatches(h, etag, false)
+}
+
+// notModified send a 304 response when If-None-Match match the current etag, it report if the response was sent
+func (app *application) notModified(w http.ResponseWriter, r *http.Request, etag string) bool {
+	h := r.Header.Get("If-None-Match")
+	if h == "" || !etagMatches(h, etag, true) {
+		return false
+	}
+
+	w.Header().Set("ETag", etag)
+	w.WriteHeader(http.StatusNotModified)
+	return true
+}
+
 func (app *application) readJSON(w http.ResponseWriter, r *http.Request, dst interface{}) error {
 	maxBytes := 1_048_576
 
@@ -140,6 +197,38 @@ func (app *application) readInt(qs url.Values, k string, defaultValue int, v *va
 	return n
 }
 
+func (app *application) readBool(qs url.Values, k string, defaultValue bool, v *validator.Validator) bool {
+	s := qs.Get(k)
+	if s == "" {
+		return defaultValue
+	}
+
+	b, err := strconv.ParseBool(s)
+	if err != nil {
+		v.AddError(k, "must be a boolean value")
+		return defaultValue
+	}
+
+	return b
+}
+
+// readTime return the time in the parameter, RFC 3339 timestamps and dates like 2006-01-02 are accepted
+func (app *application) readTime(qs url.Values, k string, v *validator.Validator) time.Time {
+	s := qs.Get(k)
+	if s == "" {
+		return time.Time{}
+	}
+
+	for _, layout := range []string{time.RFC3339, "2006-01-02"} {
+		t, err := time.Parse(layout, s)
+		if err == nil {
+			return t
+		}
+	}
+	v.AddError(k, "must be a date or a RFC 3339 timestamp")
+	return time.Time{}
+}
+
 func (app *application) readCSV(qs url.Values, k string, defaultValue []string) []string {
 	csv := qs.Get(k)
 
@@ -0,0 +1,451 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/eze8789/movies-api/data"
+	"github.com/eze8789/movies-api/validator"
+	"github.com/julienschmidt/httprouter"
+)
+
+const (
+	importMaxBytes    = 50 << 20
+	importSyncRows    = 1000
+	importJobExpiry   = time.Hour
+	importRunning     = "running"
+	importFinished    = "finished"
+	importFailed      = "failed"
+	contentTypeCSV    = "text/csv"
+	contentTypeNDJSON = "application/x-ndjson"
+)
+
+// importRecord hold a movie read from the import file and the errors found parsing or validating it
+type importRecord struct {
+	row    int
+	movie  *data.Movie
+	errors map[string]string
+}
+
+// importRowError report the errors of a row using the same format as validator.Validator.Errors
+type importRowError struct {
+	Row    int               `json:"row"`
+	Errors map[string]string `json:"errors"`
+}
+
+type importReport struct {
+	DryRun    bool             `json:"dry_run"`
+	Atomic    bool             `json:"atomic"`
+	TotalRows int              `json:"total_rows"`
+	ValidRows int              `json:"valid_rows"`
+	Imported  int              `json:"imported"`
+	Errors    []importRowError `json:"errors"`
+}
+
+type importJob struct {
+	ID         string        `json:"id"`
+	Status     string        `json:"status"`
+	CreatedAt  time.Time     `json:"created_at"`
+	FinishedAt *time.Time    `json:"finished_at,omitempty"`
+	Report     *importReport `json:"report,omitempty"`
+	Error      string        `json:"error,omitempty"`
+	userID     int64
+}
+
+// importStore keep the import jobs in memory, finished jobs are removed after importJobExpiry
+type importStore struct {
+	mu   sync.Mutex
+	jobs map[string]*importJob
+}
+
+func newImportStore() *importStore {
+	return &importStore{jobs: make(map[string]*importJob)}
+}
+
+func (s *importStore) add(userID int64) (*importJob, error) {
+	b := make([]byte, 16)
+	_, err := rand.Read(b)
+	if err != nil {
+		return nil, err
+	}
+
+	job := &importJob{ID: hex.EncodeToString(b), Status: importRunning, CreatedAt: time.Now(), userID: userID}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for k, j := range s.jobs {
+		if j.FinishedAt != nil && time.Since(*j.FinishedAt) > importJobExpiry {
+			delete(s.jobs, k)
+		}
+	}
+	s.jobs[job.ID] = job
+	return job, nil
+}
+
+// get return a copy of the job to avoid reading it while the import is updating it
+func (s *importStore) get(id string, userID int64) (importJob, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	job, ok := s.jobs[id]
+	if !ok || job.userID != userID {
+		return importJob{}, false
+	}
+	return *job, true
+}
+
+func (s *importStore) finish(id string, report *importReport, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	job := s.jobs[id]
+	now := time.Now()
+	job.FinishedAt = &now
+	job.Report = report
+	job.Status = importFinished
+	if err != nil {
+		job.Status = importFailed
+		job.Error = err.Error()
+	}
+}
+
+// importMovies load movies from a CSV or NDJSON body, every row is validated with ValidateMovie.
+// dry_run=true only validate the rows and atomic=true import all the rows in a transaction or none of them.
+// The body is spooled to a temporary file, files with more than importSyncRows lines are parsed and imported in
+// the background and the job can be polled.
+func (app *application) importMovies(w http.ResponseWriter, r *http.Request) {
+	app.logger.LogInfo(fmt.Sprintf("%s - %s: %s", r.RemoteAddr, r.Method, r.URL.String()), nil)
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || (mediaType != contentTypeCSV && mediaType != contentTypeNDJSON) {
+		app.unsupportedMediaTypeResponse(w, r, contentTypeCSV, contentTypeNDJSON)
+		return
+	}
+
+	v := validator.New()
+	qs := r.URL.Query()
+	dryRun := app.readBool(qs, "dry_run", false, v)
+	atomic := app.readBool(qs, "atomic", false, v)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	f, lines, err := spoolImport(http.MaxBytesReader(w, r.Body, importMaxBytes))
+	if err != nil {
+		switch {
+		case err.Error() == "http: request body too large":
+			app.badRequestResponse(w, r, fmt.Errorf("payload must not be larger than %d bytes", importMaxBytes))
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	userID := app.contextGetUser(r).ID
+	if lines <= importSyncRows {
+		defer removeImportFile(f)
+		var records []*importRecord
+		records, err = parseImport(mediaType, f)
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+
+		report, importErr := app.runImport(records, dryRun, atomic, userID)
+		if importErr != nil {
+			app.serverErrorResponse(w, r, importErr)
+			return
+		}
+
+		err = app.writeJSON(w, http.StatusOK, envelope{"report": report}, nil)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	job, err := app.imports.add(userID)
+	if err != nil {
+		removeImportFile(f)
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// copy the job before the import starts updating it
+	created := *job
+	app.runBackground(func() {
+		defer removeImportFile(f)
+		var report *importReport
+		records, importErr := parseImport(mediaType, f)
+		if importErr == nil {
+			report, importErr = app.runImport(records, dryRun, atomic, userID)
+		}
+		if importErr != nil {
+			app.logger.LogError(importErr, map[string]string{"import_job": created.ID})
+		}
+		app.imports.finish(created.ID, report, importErr)
+	})
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/imports/%s", job.ID))
+
+	err = app.writeJSON(w, http.StatusAccepted, envelope{"job": created}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// showImport return the status of a background import started by the authenticated user
+func (app *application) showImport(w http.ResponseWriter, r *http.Request) {
+	app.logger.LogInfo(fmt.Sprintf("%s - %s: %s", r.RemoteAddr, r.Method, r.URL.String()), nil)
+	id := httprouter.ParamsFromContext(r.Context()).ByName("id")
+
+	job, ok := app.imports.get(id, app.contextGetUser(r).ID)
+	if !ok {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	err := app.writeJSON(w, http.StatusOK, envelope{"job": job}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// spoolImport copy the body to a temporary file and return it ready to be read with the amount of lines, the
+// file must be removed with removeImportFile
+func spoolImport(body io.Reader) (*os.File, int, error) {
+	f, err := os.CreateTemp("", "movies-import-*")
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var lines lineCounter
+	_, err = io.Copy(io.MultiWriter(f, &lines), body)
+	if err == nil {
+		_, err = f.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		removeImportFile(f)
+		return nil, 0, err
+	}
+	return f, int(lines), nil
+}
+
+func removeImportFile(f *os.File) {
+	f.Close()           //nolint:errcheck
+	os.Remove(f.Name()) //nolint:errcheck
+}
+
+// lineCounter count the newlines written, the header of a CSV file is counted as a line
+type lineCounter int
+
+func (c *lineCounter) Write(p []byte) (int, error) {
+	*c += lineCounter(bytes.Count(p, []byte("\n")))
+	return len(p), nil
+}
+
+// parseImport read the records of a CSV or NDJSON file
+func parseImport(mediaType string, body io.Reader) ([]*importRecord, error) {
+	if mediaType == contentTypeCSV {
+		return parseImportCSV(body)
+	}
+	return parseImportNDJSON(body)
+}
+
+// runImport validate the records and insert the valid movies, in atomic mode nothing is inserted when a row fails
+func (app *application) runImport(records []*importRecord, dryRun, atomic bool, userID int64) (*importReport, error) {
+	report := &importReport{DryRun: dryRun, Atomic: atomic, TotalRows: len(records), Errors: []importRowError{}}
+
+	index, err := app.models.Genres.Index()
+	if err != nil {
+		return nil, err
+	}
+
+	valid := []*importRecord{}
+	for _, rec := range records {
+		if rec.errors == nil {
+			v := validator.New()
+			app.normalizeGenres(v, index, rec.movie)
+			if data.ValidateMovie(v, rec.movie); !v.Valid() { //nolint:gocritic
+				rec.errors = v.Errors
+			}
+		}
+		if rec.errors != nil {
+			report.Errors = append(report.Errors, importRowError{Row: rec.row, Errors: rec.errors})
+			continue
+		}
+		valid = append(valid, rec)
+	}
+	report.ValidRows = len(valid)
+
+	if dryRun || (atomic && len(report.Errors) > 0) {
+		return report, nil
+	}
+
+	if atomic {
+		movies := make([]*data.Movie, 0, len(valid))
+		for _, rec := range valid {
+			movies = append(movies, rec.movie)
+		}
+		err = app.models.Movies.InsertAll(movies, userID)
+		if err != nil {
+			return report, err
+		}
+		report.Imported = len(movies)
+		return report, nil
+	}
+
+	for _, rec := range valid {
+		err = app.models.Movies.Insert(rec.movie, userID)
+		if err != nil {
+			app.logger.LogError(err, map[string]string{"import_row": strconv.Itoa(rec.row)})
+			report.Errors = append(report.Errors, importRowError{Row: rec.row,
+				Errors: map[string]string{"movie": "unable to store the movie"}})
+			continue
+		}
+		report.Imported++
+	}
+	return report, nil
+}
+
+// parseImportCSV read movies from a CSV file with a title, year, runtime and genres header, genres are
+// separated by "|" and the runtime can be the minutes or the "<minutes> mins" format
+func parseImportCSV(body io.Reader) ([]*importRecord, error) {
+	reader := csv.NewReader(body)
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, errors.New("body can not be empty")
+		}
+		return nil, err
+	}
+
+	columns := make(map[string]int)
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(name))
+		switch name {
+		case "title", "year", "runtime", "genres":
+			columns[name] = i
+		default:
+			return nil, fmt.Errorf("unknown column found: %s", name)
+		}
+	}
+	for _, name := range []string{"title", "year", "runtime", "genres"} {
+		if _, ok := columns[name]; !ok {
+			return nil, fmt.Errorf("missing column: %s", name)
+		}
+	}
+
+	records := []*importRecord{}
+	for row := 1; ; row++ {
+		fields, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			var parseErr *csv.ParseError
+			switch {
+			case errors.Is(err, csv.ErrFieldCount):
+				records = append(records, &importRecord{row: row, errors: map[string]string{"row": "wrong number of fields"}})
+				continue
+			case errors.As(err, &parseErr):
+				return nil, fmt.Errorf("badly-formed CSV at line: %d", parseErr.Line)
+			default:
+				return nil, err
+			}
+		}
+
+		v := validator.New()
+		movie := &data.Movie{Title: fields[columns["title"]]}
+
+		year, err := strconv.ParseInt(fields[columns["year"]], 10, 32)
+		v.Check(err == nil, "year", "must be an integer")
+		movie.Year = int32(year)
+
+		runtime, err := parseImportRuntime(fields[columns["runtime"]])
+		v.Check(err == nil, "runtime", "must be the minutes or use the format \"<minutes> mins\"")
+		movie.Runtime = runtime
+
+		for _, g := range strings.Split(fields[columns["genres"]], "|") {
+			if g = strings.TrimSpace(g); g != "" {
+				movie.Genres = append(movie.Genres, g)
+			}
+		}
+
+		rec := &importRecord{row: row, movie: movie}
+		if !v.Valid() {
+			rec.errors = v.Errors
+		}
+		records = append(records, rec)
+	}
+	return records, nil
+}
+
+func parseImportRuntime(s string) (data.Runtime, error) {
+	s = strings.TrimSpace(s)
+	if n, err := strconv.ParseInt(s, 10, 32); err == nil {
+		return data.Runtime(n), nil
+	}
+
+	var runtime data.Runtime
+	err := runtime.UnmarshalJSON([]byte(strconv.Quote(s)))
+	return runtime, err
+}
+
+// parseImportNDJSON read movies from a newline delimited JSON body, each line use the same fields as
+// the movie creation endpoint, empty lines are ignored
+func parseImportNDJSON(body io.Reader) ([]*importRecord, error) {
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 64*1024), 1<<20)
+
+	records := []*importRecord{}
+	for row := 0; scanner.Scan(); {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		row++
+
+		var input struct {
+			Title   string       `json:"title"`
+			Year    int32        `json:"year"`
+			Runtime data.Runtime `json:"runtime"`
+			Genres  []string     `json:"genres"`
+		}
+		dec := json.NewDecoder(bytes.NewReader(line))
+		dec.DisallowUnknownFields()
+
+		err := dec.Decode(&input)
+		if err != nil {
+			records = append(records, &importRecord{row: row, errors: map[string]string{"json": err.Error()}})
+			continue
+		}
+
+		movie := &data.Movie{Title: input.Title, Year: input.Year, Runtime: input.Runtime, Genres: input.Genres}
+		records = append(records, &importRecord{row: row, movie: movie})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, errors.New("body can not be empty")
+	}
+	return records, nil
+}
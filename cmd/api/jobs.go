@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// runPeriodic execute fn every interval until ctx is cancelled, the job is tracked by app.wg so the
+// graceful shutdown waits for the current execution to finish
+func (app *application) runPeriodic(ctx context.Context, interval time.Duration, fn func()) {
+	app.runBackground(func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				app.runJob(fn)
+			}
+		}
+	})
+}
+
+// runJob execute fn recovering a panic to keep the periodic job running
+func (app *application) runJob(fn func()) {
+	defer func() {
+		if err := recover(); err != nil {
+			app.logger.LogError(fmt.Errorf("%s", err), nil)
+		}
+	}()
+	fn()
+}
+
+// purgeTrash remove permanently the movies in the trash for longer than the configured retention
+func (app *application) purgeTrash() {
+	n, keys, err := app.models.Movies.PurgeDeletedBefore(time.Now().Add(-app.config.trash.retention))
+	if err != nil {
+		app.logger.LogError(err, nil)
+		return
+	}
+	for _, key := range keys {
+		app.removeMedia(key)
+	}
+	if n > 0 {
+		app.logger.LogInfo("movies trash purged", map[string]string{"movies": strconv.FormatInt(n, 10)})
+	}
+}
+
+// purgeAccounts delete the accounts whose grace period ended, the tokens, permissions, reviews and lists are
+// deleted by the database and the data exports are removed from the storage
+func (app *application) purgeAccounts() {
+	ids, err := app.models.Users.DeleteScheduledBefore(time.Now())
+	if err != nil {
+		app.logger.LogError(err, nil)
+		return
+	}
+	for _, id := range ids {
+		app.removeExports(id)
+	}
+	if len(ids) > 0 {
+		app.logger.LogInfo("accounts deleted", map[string]string{"users": strconv.Itoa(len(ids))})
+	}
+}
@@ -3,16 +3,19 @@ package main
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
 	"os"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/eze8789/movies-api/data"
 	"github.com/eze8789/movies-api/jsonlog"
 	"github.com/eze8789/movies-api/mails"
+	"github.com/eze8789/movies-api/storage"
 	_ "github.com/lib/pq"
 )
 
@@ -29,16 +32,37 @@ type config struct {
 	port int
 	env  string
 	db   struct {
-		dsn          string
-		maxOpenConns int
-		maxIdleConns int
-		maxIdleTime  string
+		dsn            string
+		maxOpenConns   int
+		maxIdleConns   int
+		maxIdleTime    string
+		migrateOnStart bool
 	}
 	limiter struct {
 		rps     float64
 		burst   int
 		enabled bool
 	}
+	export struct {
+		timeout time.Duration
+	}
+	trash struct {
+		retention     time.Duration
+		purgeInterval time.Duration
+	}
+	storage struct {
+		dir     string
+		baseURL string
+	}
+	cache struct {
+		ttl  time.Duration
+		size int
+	}
+	account struct {
+		deletionGrace time.Duration
+		purgeInterval time.Duration
+		exportDir     string
+	}
 	smtp struct {
 		host     string
 		port     int
@@ -49,11 +73,14 @@ type config struct {
 }
 
 type application struct {
-	config config
-	logger *jsonlog.Logger
-	models data.Models
-	mailer mails.Mailer
-	wg     sync.WaitGroup
+	config  config
+	logger  *jsonlog.Logger
+	models  data.Models
+	mailer  mails.Mailer
+	imports *importStore
+	storage storage.Storage
+	exports storage.Storage
+	wg      sync.WaitGroup
 }
 
 func main() {
@@ -61,6 +88,18 @@ func main() {
 
 	flag.IntVar(&cfg.port, "port", 8000, "HTTP server port")
 	flag.StringVar(&cfg.env, "env", "dev", "Running environment")
+	flag.DurationVar(&cfg.trash.retention, "trash-retention", 30*24*time.Hour, "Time movies stay in the trash before purge")
+	flag.DurationVar(&cfg.trash.purgeInterval, "trash-purge-interval", time.Hour, "Interval to purge the movies trash")
+	flag.StringVar(&cfg.db.dsn, "db-dsn", "", "Database DSN: postgres://..., sqlite://<path> or memory://, built from POSTGRES_* when empty")
+	flag.BoolVar(&cfg.db.migrateOnStart, "migrate-on-start", false, "Apply the pending migrations before starting the server")
+	flag.DurationVar(&cfg.export.timeout, "movies-export-timeout", 10*time.Minute, "Time allowed to stream a movies export")
+	flag.StringVar(&cfg.storage.dir, "storage-dir", "./media", "Directory to store the uploaded media")
+	flag.StringVar(&cfg.storage.baseURL, "storage-url", "/v1/media", "Base URL of the uploaded media")
+	flag.DurationVar(&cfg.cache.ttl, "auth-cache-ttl", 30*time.Second, "Time the token and permission lookups are cached, 0 disable the cache")
+	flag.IntVar(&cfg.cache.size, "auth-cache-size", 10000, "Maximum token and permission lookups cached")
+	flag.DurationVar(&cfg.account.deletionGrace, "account-deletion-grace", 30*24*time.Hour, "Time a deleted account can be restored")
+	flag.DurationVar(&cfg.account.purgeInterval, "account-purge-interval", time.Hour, "Interval to delete the accounts past the grace period")
+	flag.StringVar(&cfg.account.exportDir, "export-dir", "./exports", "Directory to store the personal data exports, it is not served as media")
 	displayVersion := flag.Bool("version", false, "Display version and exit")
 	flag.Parse()
 
@@ -70,6 +109,19 @@ func main() {
 		os.Exit(0)
 	}
 
+	if cfg.trash.purgeInterval <= 0 {
+		log.Fatal("please set a positive trash purge interval")
+	}
+	if cfg.export.timeout <= 0 {
+		log.Fatal("please set a positive movies export timeout")
+	}
+	if cfg.account.purgeInterval <= 0 {
+		log.Fatal("please set a positive account purge interval")
+	}
+	if cfg.account.deletionGrace < 0 {
+		log.Fatal("please set a positive account deletion grace")
+	}
+
 	logLevel, err := GetInt("MOVIES_API_LOG_LEVEL")
 	if err != nil {
 		log.Fatal("please set a valid log level")
@@ -77,6 +129,70 @@ func main() {
 
 	logger := jsonlog.New(os.Stdout, jsonlog.Level(logLevel))
 
+	// Configure the storage backend from the DSN scheme, the in-memory backend does not need a database
+	var db *sql.DB
+	var models data.Models
+	switch dsnScheme(cfg.db.dsn) {
+	case data.BackendMemory:
+		models = data.NewMemoryModels()
+		logger.LogInfo("using in-memory backend, data is lost on exit", nil)
+		if email := os.Getenv("MEMORY_ADMIN_EMAIL"); email != "" {
+			err = seedAdmin(models, logger, email, os.Getenv("MEMORY_ADMIN_PASSWORD"))
+			if err != nil {
+				logger.LogFatal(err, nil)
+			}
+		}
+	case data.BackendSQLite:
+		db, err = openDB(&cfg)
+		if err != nil {
+			logger.LogFatal(err, nil)
+		}
+		defer db.Close()
+
+		logger.LogInfo("sqlite database opened", nil)
+		models = data.NewSQLiteModels(db)
+	default:
+		configPostgres(&cfg)
+		db, err = openDB(&cfg)
+		if err != nil {
+			logger.LogFatal(err, nil)
+		}
+		defer db.Close()
+
+		logger.LogInfo("database connection established", nil)
+		models = data.NewModels(db)
+	}
+
+	// the migrate and admin subcommands exit once they run, the server is not started
+	if cmd := flag.Arg(0); cmd == "migrate" || cmd == "admin" {
+		if cmd == "migrate" {
+			err = migrate(db, models.Backend, logger, flag.Args()[1:])
+		} else {
+			err = admin(models, logger, flag.Args()[1:])
+		}
+		switch {
+		case errors.Is(err, errMigrateUsage), errors.Is(err, errAdminUsage):
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2) //nolint:gomnd
+		case err != nil:
+			logger.LogFatal(err, nil)
+		}
+		return
+	}
+	if cfg.db.migrateOnStart {
+		err = migrateOnStart(db, models.Backend, logger)
+		if err != nil {
+			logger.LogFatal(err, nil)
+		}
+	}
+
+	// cache the token and permission lookups made on every request, the changes made by the admin subcommand
+	// are seen by the server once the entries expire
+	var cache *data.Cache
+	if cfg.cache.ttl > 0 {
+		models, cache = data.NewCachedModels(models, cfg.cache.ttl, cfg.cache.size)
+	}
+
 	// Configure mailer
 	cfg.smtp.host = os.Getenv("MAILER_SMTP_HOST")
 	cfg.smtp.port, err = GetInt("MAILER_SMTP_PORT")
@@ -101,54 +217,90 @@ func main() {
 	}
 	cfg.limiter.enabled = GetBool("RATE_LIMIT_ENABLED")
 
-	// Configure Postgres DB
-	pgUser := os.Getenv("POSTGRES_USER")
-	pgPWD := os.Getenv("POSTGRES_PWD")
-	pgDB := os.Getenv("POSTGRES_DB")
-	cfg.db.maxOpenConns, err = GetInt("POSTGRES_MAX_OPEN_CONNS")
-	if err != nil {
-		log.Fatal("please set a valid MaxOpenConnections")
-	}
-	cfg.db.maxIdleConns, err = GetInt("POSTGRES_MAX_IDLE_CONNS")
+	media, err := storage.NewLocal(cfg.storage.dir, cfg.storage.baseURL)
 	if err != nil {
-		log.Fatal("please set a valid MaxIdleConnections")
+		logger.LogFatal(err, nil)
 	}
-	cfg.db.maxIdleTime = os.Getenv("POSTGRES_MAX_IDLE_TIME")
-	cfg.db.dsn = fmt.Sprintf("postgres://%s:%s@localhost/%s?sslmode=disable", pgUser, pgPWD, pgDB)
 
-	db, err := openDB(&cfg)
+	exports, err := storage.NewLocal(cfg.account.exportDir, "")
 	if err != nil {
 		logger.LogFatal(err, nil)
 	}
-	defer db.Close()
-
-	logger.LogInfo("database connection established", nil)
 
-	exposeMetrics(db)
+	exposeMetrics(db, cache)
 
 	app := &application{
-		config: cfg,
-		logger: logger,
-		models: data.NewModels(db),
-		mailer: mailer,
+		config:  cfg,
+		logger:  logger,
+		models:  models,
+		mailer:  mailer,
+		imports: newImportStore(),
+		storage: media,
+		exports: exports,
 	}
 
 	app.server()
 }
 
-func openDB(cfg *config) (*sql.DB, error) {
-	db, err := sql.Open("postgres", cfg.db.dsn)
+// configPostgres read the Postgres pool settings from the environment, the DSN is built from the environment
+// when it was not set with -db-dsn
+func configPostgres(cfg *config) {
+	var err error
+	cfg.db.maxOpenConns, err = GetInt("POSTGRES_MAX_OPEN_CONNS")
 	if err != nil {
-		return nil, err
+		log.Fatal("please set a valid MaxOpenConnections")
+	}
+	cfg.db.maxIdleConns, err = GetInt("POSTGRES_MAX_IDLE_CONNS")
+	if err != nil {
+		log.Fatal("please set a valid MaxIdleConnections")
+	}
+	cfg.db.maxIdleTime = os.Getenv("POSTGRES_MAX_IDLE_TIME")
+	if cfg.db.dsn == "" {
+		pgUser := os.Getenv("POSTGRES_USER")
+		pgPWD := os.Getenv("POSTGRES_PWD")
+		pgDB := os.Getenv("POSTGRES_DB")
+		cfg.db.dsn = fmt.Sprintf("postgres://%s:%s@localhost/%s?sslmode=disable", pgUser, pgPWD, pgDB)
+	}
+}
+
+// dsnScheme return the backend selected by the DSN, Postgres is used for any scheme other than sqlite or memory
+func dsnScheme(dsn string) string {
+	switch {
+	case strings.HasPrefix(dsn, "sqlite://"):
+		return data.BackendSQLite
+	case strings.HasPrefix(dsn, "memory://"):
+		return data.BackendMemory
+	default:
+		return data.BackendPostgres
 	}
+}
 
-	db.SetMaxOpenConns(cfg.db.maxOpenConns)
-	db.SetMaxIdleConns(cfg.db.maxIdleConns)
-	t, err := time.ParseDuration(cfg.db.maxIdleTime)
+// openDB open the database selected by the DSN scheme, sqlite://<path> open a SQLite file and the pool
+// settings are only applied when they are set
+func openDB(cfg *config) (*sql.DB, error) {
+	driver, dsn := "postgres", cfg.db.dsn
+	if dsnScheme(dsn) == data.BackendSQLite {
+		driver, dsn = data.SQLiteDriver, data.SQLiteDSN(strings.TrimPrefix(dsn, "sqlite://"))
+	}
+	db, err := sql.Open(driver, dsn)
 	if err != nil {
 		return nil, err
 	}
-	db.SetConnMaxIdleTime(t)
+
+	if cfg.db.maxOpenConns > 0 {
+		db.SetMaxOpenConns(cfg.db.maxOpenConns)
+	}
+	if cfg.db.maxIdleConns > 0 {
+		db.SetMaxIdleConns(cfg.db.maxIdleConns)
+	}
+	if cfg.db.maxIdleTime != "" {
+		var t time.Duration
+		t, err = time.ParseDuration(cfg.db.maxIdleTime)
+		if err != nil {
+			return nil, err
+		}
+		db.SetConnMaxIdleTime(t)
+	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second) //nolint:gomnd
 	defer cancel()
@@ -158,5 +310,11 @@ func openDB(cfg *config) (*sql.DB, error) {
 		return nil, err
 	}
 
+	if driver == data.SQLiteDriver {
+		err = data.CheckSQLite(db)
+		if err != nil {
+			return nil, err
+		}
+	}
 	return db, nil
 }
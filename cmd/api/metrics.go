@@ -5,18 +5,27 @@ import (
 	"expvar"
 	"runtime"
 	"time"
+
+	"github.com/eze8789/movies-api/data"
 )
 
-func exposeMetrics(db *sql.DB) {
+func exposeMetrics(db *sql.DB, cache *data.Cache) {
 	expvar.NewString("version").Set(version)
 
 	expvar.Publish("goroutines", expvar.Func(func() interface{} {
 		return runtime.NumGoroutine()
 	}))
 
-	expvar.Publish("db_status", expvar.Func(func() interface{} {
-		return db.Stats()
-	}))
+	// the in-memory backend has no database
+	if db != nil {
+		expvar.Publish("db_status", expvar.Func(func() interface{} {
+			return db.Stats()
+		}))
+	}
+
+	if cache != nil {
+		expvar.Publish("auth_cache", cache.Metrics())
+	}
 
 	expvar.Publish("timestamp", expvar.Func(func() interface{} {
 		return time.Now().Unix()
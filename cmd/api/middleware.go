@@ -151,13 +151,19 @@ func (app *application) reqActivatedUser(next http.HandlerFunc) http.HandlerFunc
 	return app.reqAuthenticatedUser(fn)
 }
 
+// reqPermission validate the user has the permission, the permissions are kept in the request context so the
+// handlers do not load them again
 func (app *application) reqPermission(perm string, next http.HandlerFunc) http.HandlerFunc {
 	fn := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		u := app.contextGetUser(r)
-		userPerms, err := app.models.Permissions.GetAllForUser(u.ID)
-		if err != nil {
-			app.serverErrorResponse(w, r, err)
-			return
+		userPerms, ok := app.contextGetPermissions(r)
+		if !ok {
+			var err error
+			userPerms, err = app.models.Permissions.GetAllForUser(app.contextGetUser(r).ID)
+			if err != nil {
+				app.serverErrorResponse(w, r, err)
+				return
+			}
+			r = app.contextSetPermissions(r, userPerms)
 		}
 		if !userPerms.Include(perm) {
 			app.unauthorizedResponse(w, r)
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/eze8789/movies-api/jsonlog"
+	"github.com/eze8789/movies-api/migrations"
+)
+
+const migrateUsage = "usage: movies-api [flags] migrate up|down [N]|goto N|force N|status"
+
+var errMigrateUsage = errors.New(migrateUsage)
+
+// migrate run the migrate subcommand with the database configured by the flags, down revert one migration
+// unless N is set and force only set the version to recover from a failed migration
+func migrate(db *sql.DB, backend string, logger *jsonlog.Logger, args []string) error {
+	if db == nil {
+		return errors.New("migrations need a postgres or sqlite database")
+	}
+	m, err := migrations.New(db, backend)
+	if err != nil {
+		return err
+	}
+	if len(args) == 0 {
+		return errMigrateUsage
+	}
+
+	var n int
+	if len(args) > 1 {
+		n, err = strconv.Atoi(args[1])
+		if err != nil || n < 0 {
+			return errMigrateUsage
+		}
+	}
+
+	ctx := context.Background()
+	applied := 0
+	switch {
+	case args[0] == "up" && len(args) == 1:
+		applied, err = m.Up(ctx)
+	case args[0] == "down" && len(args) == 1:
+		applied, err = m.Down(ctx, 1)
+	case args[0] == "down" && len(args) == 2: //nolint:gomnd
+		applied, err = m.Down(ctx, n)
+	case args[0] == "goto" && len(args) == 2: //nolint:gomnd
+		applied, err = m.Goto(ctx, int64(n))
+	case args[0] == "force" && len(args) == 2: //nolint:gomnd
+		err = m.Force(ctx, int64(n))
+	case args[0] == "status" && len(args) == 1:
+		return migrateStatus(ctx, m)
+	default:
+		return errMigrateUsage
+	}
+	if err != nil {
+		return err
+	}
+
+	v, _, err := m.Version(ctx)
+	if err != nil {
+		return err
+	}
+	logger.LogInfo("migrations completed", map[string]string{
+		"command": args[0],
+		"applied": strconv.Itoa(applied),
+		"version": strconv.FormatInt(v, 10),
+	})
+	return nil
+}
+
+// migrateStatus print the version applied and the state of every migration
+func migrateStatus(ctx context.Context, m *migrations.Migrator) error {
+	v, dirty, err := m.Version(ctx)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Version:\t%d\n", v)
+	fmt.Printf("Dirty:\t\t%t\n\n", dirty)
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0) //nolint:gomnd
+	fmt.Fprintln(w, "VERSION\tNAME\tSTATUS")
+	for _, mig := range m.Migrations {
+		status := "pending"
+		if mig.Version <= v {
+			status = "applied"
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\n", mig.Version, mig.Name, status)
+	}
+	return w.Flush()
+}
+
+// migrateOnStart apply the pending migrations before the server start, the migrator lock prevent replicas
+// started at the same time from running the same migrations
+func migrateOnStart(db *sql.DB, backend string, logger *jsonlog.Logger) error {
+	if db == nil {
+		return nil
+	}
+	m, err := migrations.New(db, backend)
+	if err != nil {
+		return err
+	}
+
+	applied, err := m.Up(context.Background())
+	if err != nil {
+		return err
+	}
+	logger.LogInfo("migrations applied on start", map[string]string{"applied": strconv.Itoa(applied)})
+	return nil
+}
@@ -1,8 +1,11 @@
 package main
 
 import (
+	"bytes"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"mime"
 	"net/http"
 
 	"github.com/eze8789/movies-api/data"
@@ -24,6 +27,12 @@ func (app *application) createMovieHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
+	index, err := app.models.Genres.Index()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
 	v := validator.New()
 	// copy json to struct to validate input before create the movie in the database
 	movie := &data.Movie{
@@ -33,13 +42,14 @@ func (app *application) createMovieHandler(w http.ResponseWriter, r *http.Reques
 		Genres:  input.Genres,
 	}
 
+	app.normalizeGenres(v, index, movie)
 	if data.ValidateMovie(v, movie); !v.Valid() { //nolint:gocritic
 		app.logError(r, errors.New("movie validation error"))
 		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
 
-	err = app.models.Movies.Insert(movie)
+	err = app.models.Movies.Insert(movie, app.contextGetUser(r).ID)
 	if err != nil {
 		app.logError(r, err)
 		app.serverErrorResponse(w, r, err)
@@ -56,6 +66,15 @@ func (app *application) createMovieHandler(w http.ResponseWriter, r *http.Reques
 	}
 }
 
+// movieFieldsSafe hold the fields that can be requested with the fields parameter
+var movieFieldsSafe = []string{"id", "title", "year", "runtime", "genres", "version", "average_rating", "rating_count",
+	"poster"}
+
+// movieIncludeSafe hold the related resources that can be embedded with the include parameter
+var movieIncludeSafe = []string{"credits"}
+
+// showMovie return a movie with its credits, fields and include can be used to shape the response and then
+// the credits are only embedded when they are included
 func (app *application) showMovie(w http.ResponseWriter, r *http.Request) {
 	app.logger.LogInfo(fmt.Sprintf("%s - %s: %s", r.RemoteAddr, r.Method, r.URL.String()), nil)
 	id, err := app.readIDParam(r)
@@ -65,7 +84,24 @@ func (app *application) showMovie(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	movie, err := app.models.Movies.Get(id)
+	v := validator.New()
+	qs := r.URL.Query()
+	fields := app.readCSV(qs, "fields", []string{})
+	include := app.readCSV(qs, "include", []string{})
+	data.ValidateSafe(v, "fields", fields, movieFieldsSafe)
+	data.ValidateSafe(v, "include", include, movieIncludeSafe)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	_, hasFields := qs["fields"]
+	_, hasInclude := qs["include"]
+	shaped := hasFields || hasInclude
+	if !shaped {
+		include = movieIncludeSafe
+	}
+
+	movie, err := app.models.Movies.GetFields(id, fields)
 	if err != nil {
 		app.logger.LogError(err, nil)
 		switch {
@@ -77,7 +113,30 @@ func (app *application) showMovie(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = app.writeJSON(w, http.StatusOK, envelope{"movie": movie}, nil)
+	var credits []*data.Credit
+	if v.In("credits", include...) {
+		credits, err = app.models.Credits.GetForMovie(movie.ID)
+		if err != nil {
+			app.logError(r, err)
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	etag := app.movieETag(movie, credits)
+	if shaped {
+		etag = app.movieETag(movie, credits, fields, include)
+	}
+	if app.notModified(w, r, etag) {
+		return
+	}
+	movie.Credits = credits
+	movie.Project(fields)
+
+	headers := make(http.Header)
+	headers.Set("ETag", etag)
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"movie": movie}, headers)
 	if err != nil {
 		app.logError(r, err)
 		app.serverErrorResponse(w, r, err)
@@ -106,44 +165,57 @@ func (app *application) updateMovie(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var input struct {
-		Title   *string       `json:"title"`
-		Year    *int32        `json:"year"`
-		Runtime *data.Runtime `json:"runtime"`
-		Genres  []string      `json:"genres"`
-	}
-
-	err = app.readJSON(w, r, &input)
+	credits, err := app.models.Credits.GetForMovie(movie.ID)
 	if err != nil {
-		app.logError(r, err)
-		app.badRequestResponse(w, r, err)
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if !app.checkIfMatch(r, app.movieETag(movie, credits)) {
+		app.preconditionFailedResponse(w, r)
 		return
 	}
 
-	if input.Title != nil {
-		movie.Title = *input.Title
+	mediaType := contentTypeJSON
+	if ct := r.Header.Get("Content-Type"); ct != "" {
+		mediaType, _, err = mime.ParseMediaType(ct)
 	}
-	if input.Year != nil {
-		movie.Year = *input.Year
+	if err != nil || (mediaType != contentTypeJSON && mediaType != contentTypeJSONPatch &&
+		mediaType != contentTypeMergePatch) {
+		app.unsupportedMediaTypeResponse(w, r, contentTypeJSON, contentTypeJSONPatch, contentTypeMergePatch)
+		return
 	}
-	if input.Runtime != nil {
-		movie.Runtime = *input.Runtime
+
+	err = app.readMovieUpdate(w, r, mediaType, movie)
+	if err != nil {
+		switch {
+		case errors.Is(err, errPatchTestFailed):
+			app.patchTestFailedResponse(w, r, err)
+		default:
+			app.badRequestResponse(w, r, err)
+		}
+		return
 	}
-	if input.Genres != nil {
-		movie.Genres = input.Genres
+
+	index, err := app.models.Genres.Index()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
 	}
 
 	v := validator.New()
+	app.normalizeGenres(v, index, movie)
 	if data.ValidateMovie(v, movie); !v.Valid() { //nolint:gocritic
 		app.logError(r, err)
 		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
 
-	err = app.models.Movies.Update(movie)
+	err = app.models.Movies.Update(movie, app.contextGetUser(r).ID)
 	if err != nil {
 		app.logError(r, err)
 		switch {
+		case errors.Is(err, data.ErrEditConflict) && r.Header.Get("If-Match") != "":
+			app.preconditionFailedResponse(w, r)
 		case errors.Is(err, data.ErrEditConflict):
 			app.editConflictResponse(w, r)
 		default:
@@ -152,13 +224,102 @@ func (app *application) updateMovie(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = app.writeJSON(w, http.StatusOK, envelope{"movie": movie}, nil)
+	headers := make(http.Header)
+	headers.Set("ETag", app.movieETag(movie, credits))
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"movie": movie}, headers)
 	if err != nil {
 		app.logError(r, err)
 		app.serverErrorResponse(w, r, err)
 	}
 }
 
+// readMovieUpdate apply the request body to the movie, the body can be a JSON object with the fields to change,
+// a JSON Patch or a JSON Merge Patch. Patches are applied to the JSON representation of the editable fields.
+func (app *application) readMovieUpdate(w http.ResponseWriter, r *http.Request, mediaType string,
+	movie *data.Movie) error {
+	type fields struct {
+		Title   string       `json:"title"`
+		Year    int32        `json:"year"`
+		Runtime data.Runtime `json:"runtime"`
+		Genres  []string     `json:"genres"`
+	}
+
+	if mediaType == contentTypeJSON {
+		var input struct {
+			Title   *string       `json:"title"`
+			Year    *int32        `json:"year"`
+			Runtime *data.Runtime `json:"runtime"`
+			Genres  []string      `json:"genres"`
+		}
+		err := app.readJSON(w, r, &input)
+		if err != nil {
+			return err
+		}
+
+		if input.Title != nil {
+			movie.Title = *input.Title
+		}
+		if input.Year != nil {
+			movie.Year = *input.Year
+		}
+		if input.Runtime != nil {
+			movie.Runtime = *input.Runtime
+		}
+		if input.Genres != nil {
+			movie.Genres = input.Genres
+		}
+		return nil
+	}
+
+	current, err := json.Marshal(fields{Title: movie.Title, Year: movie.Year, Runtime: movie.Runtime,
+		Genres: movie.Genres})
+	if err != nil {
+		return err
+	}
+	var doc interface{}
+	err = json.Unmarshal(current, &doc)
+	if err != nil {
+		return err
+	}
+
+	if mediaType == contentTypeJSONPatch {
+		var ops []patchOperation
+		err = app.readJSON(w, r, &ops)
+		if err != nil {
+			return err
+		}
+		doc, err = applyJSONPatch(doc, ops)
+		if err != nil {
+			return err
+		}
+	} else {
+		var patch interface{}
+		err = app.readJSON(w, r, &patch)
+		if err != nil {
+			return err
+		}
+		doc = applyMergePatch(doc, patch)
+	}
+
+	patched, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	dec := json.NewDecoder(bytes.NewReader(patched))
+	dec.DisallowUnknownFields()
+
+	// removed fields are left empty and rejected by the movie validation
+	var result fields
+	err = dec.Decode(&result)
+	if err != nil {
+		return fmt.Errorf("the patched movie is invalid: %w", err)
+	}
+
+	movie.Title, movie.Year, movie.Runtime, movie.Genres = result.Title, result.Year, result.Runtime, result.Genres
+	return nil
+}
+
 func (app *application) deleteMovie(w http.ResponseWriter, r *http.Request) {
 	app.logger.LogInfo(fmt.Sprintf("%s - %s: %s", r.RemoteAddr, r.Method, r.URL.String()), nil)
 	id, err := app.readIDParam(r)
@@ -168,7 +329,7 @@ func (app *application) deleteMovie(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = app.models.Movies.Delete(id)
+	movie, err := app.models.Movies.Get(id)
 	if err != nil {
 		app.logError(r, err)
 		switch {
@@ -179,7 +340,37 @@ func (app *application) deleteMovie(w http.ResponseWriter, r *http.Request) {
 		}
 		return
 	}
-	err = app.writeJSON(w, http.StatusOK, envelope{"message": "movie successfully deleted"}, nil)
+
+	// the credits are only needed to evaluate the If-Match precondition
+	conditional := r.Header.Get("If-Match") != ""
+	if conditional {
+		var credits []*data.Credit
+		credits, err = app.models.Credits.GetForMovie(movie.ID)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		if !app.checkIfMatch(r, app.movieETag(movie, credits)) {
+			app.preconditionFailedResponse(w, r)
+			return
+		}
+	}
+
+	// the movie is only deleted if it did not change since it was read, so the precondition still hold
+	err = app.models.Movies.Delete(movie, app.contextGetUser(r).ID)
+	if err != nil {
+		app.logError(r, err)
+		switch {
+		case errors.Is(err, data.ErrEditConflict) && conditional:
+			app.preconditionFailedResponse(w, r)
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "movie successfully moved to the trash"}, nil)
 	if err != nil {
 		app.logError(r, err)
 		app.serverErrorResponse(w, r, err)
@@ -189,9 +380,11 @@ func (app *application) deleteMovie(w http.ResponseWriter, r *http.Request) {
 func (app *application) listMovie(w http.ResponseWriter, r *http.Request) {
 	app.logger.LogInfo(fmt.Sprintf("%s - %s: %s", r.RemoteAddr, r.Method, r.URL.String()), nil)
 	var input struct {
-		Title   string
-		Genres  []string
-		Filters data.Filters
+		Title    string
+		Genres   []string
+		PersonID int64
+		Include  []string
+		Filters  data.Filters
 	}
 
 	v := validator.New()
@@ -199,27 +392,201 @@ func (app *application) listMovie(w http.ResponseWriter, r *http.Request) {
 
 	input.Title = app.readString(qs, "title", "")
 	input.Genres = app.readCSV(qs, "genres", []string{})
+	input.PersonID = int64(app.readInt(qs, "person", 0, v))
 	input.Filters.Page = app.readInt(qs, "page", 1, v)
 	input.Filters.PageSize = app.readInt(qs, "page_size", 10, v)
 	input.Filters.Sort = app.readString(qs, "sort", "id")
-	input.Filters.SortSafe = []string{"id", "-id", "title", "-title", "year", "-year", "runtime", "-runtime"}
+	input.Filters.SortSafe = []string{"id", "-id", "title", "-title", "year", "-year", "runtime", "-runtime",
+		"rating", "-rating", "relevance"}
+	// the presence of the cursor parameter enables keyset pagination, an empty value returns the first page
+	_, input.Filters.CursorMode = qs["cursor"]
+	input.Filters.Cursor = app.readString(qs, "cursor", "")
+	input.Filters.SkipCount = !app.readBool(qs, "count", true, v)
+	input.Filters.Fields = app.readCSV(qs, "fields", []string{})
+	input.Filters.FieldsSafe = append(movieFieldsSafe[:len(movieFieldsSafe):len(movieFieldsSafe)], "match")
+	input.Include = app.readCSV(qs, "include", []string{})
+	input.Filters.Facets = app.readCSV(qs, "facets", []string{})
+	input.Filters.Decade = app.readInt(qs, "decade", 0, v)
+	input.Filters.RuntimeBucket = app.readString(qs, "runtime_bucket", "")
+	input.Filters.YearMin = app.readInt(qs, "year_min", 0, v)
+	input.Filters.YearMax = app.readInt(qs, "year_max", 0, v)
+	input.Filters.RuntimeMin = app.readInt(qs, "runtime_min", 0, v)
+	input.Filters.RuntimeMax = app.readInt(qs, "runtime_max", 0, v)
+	input.Filters.CreatedAfter = app.readTime(qs, "created_after", v)
+	input.Filters.CreatedBefore = app.readTime(qs, "created_before", v)
+	input.Filters.GenresMode = app.readString(qs, "genres_mode", data.GenresAll)
+	data.ValidateSafe(v, "include", input.Include, movieIncludeSafe)
 
+	v.Check(input.PersonID >= 0, "person", "must be a positive integer")
 	if data.ValidateFilter(v, input.Filters); !v.Valid() { //nolint:gocritic
 		app.logError(r, errors.New("unable to validate data"))
 		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
 
-	movies, metadata, err := app.models.Movies.GetAll(input.Title, input.Genres, input.Filters)
+	index, err := app.models.Genres.Index()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	input.Genres = normalizeGenreFilter(index, input.Genres)
+
+	movies, metadata, err := app.models.Movies.GetAll(input.Title, input.Genres, input.PersonID, input.Filters)
 	if err != nil {
 		app.logError(r, err)
 		app.serverErrorResponse(w, r, err)
 		return
 	}
 
-	err = app.writeJSON(w, http.StatusOK, envelope{"metadata": metadata, "movies": movies}, nil)
+	// the facets are counted over the same movies, the trigram search is used when GetAll fell back to it
+	facets, err := app.models.Movies.GetFacets(input.Title, input.Genres, input.PersonID, metadata.Fuzzy,
+		input.Filters)
 	if err != nil {
 		app.logError(r, err)
 		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if v.In("credits", input.Include...) && len(movies) > 0 {
+		ids := make([]int64, 0, len(movies))
+		for _, m := range movies {
+			ids = append(ids, m.ID)
+		}
+		var credits map[int64][]*data.Credit
+		credits, err = app.models.Credits.GetForMovies(ids)
+		if err != nil {
+			app.logError(r, err)
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		for _, m := range movies {
+			m.Credits = credits[m.ID]
+		}
+	}
+
+	// the list etag change when any movie listed, the metadata or the facets change
+	etagValues := []interface{}{metadata, input.Filters.Fields, input.Include, facets}
+	for _, m := range movies {
+		etagValues = append(etagValues, app.movieETag(m, m.Credits))
+	}
+	etag := app.etag(etagValues...)
+	if app.notModified(w, r, etag) {
+		return
+	}
+
+	for _, m := range movies {
+		m.Project(input.Filters.Fields)
+	}
+
+	headers := make(http.Header)
+	headers.Set("ETag", etag)
+
+	env := envelope{"metadata": metadata, "movies": movies}
+	if len(input.Filters.Facets) > 0 {
+		env["facets"] = facets
+	}
+
+	err = app.writeJSON(w, http.StatusOK, env, headers)
+	if err != nil {
+		app.logError(r, err)
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// listTrash list the movies moved to the trash, they are purged after the configured retention
+func (app *application) listTrash(w http.ResponseWriter, r *http.Request) {
+	app.logger.LogInfo(fmt.Sprintf("%s - %s: %s", r.RemoteAddr, r.Method, r.URL.String()), nil)
+	var filters data.Filters
+	v := validator.New()
+	qs := r.URL.Query()
+
+	filters.Page = app.readInt(qs, "page", 1, v)
+	filters.PageSize = app.readInt(qs, "page_size", 10, v)
+	filters.Sort = app.readString(qs, "sort", "-deleted_at")
+	filters.SortSafe = []string{"id", "-id", "title", "-title", "deleted_at", "-deleted_at"}
+
+	if data.ValidateFilter(v, filters); !v.Valid() { //nolint:gocritic
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	movies, metadata, err := app.models.Movies.GetTrash(filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"metadata": metadata, "movies": movies}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// restoreMovie move a movie out of the trash
+func (app *application) restoreMovie(w http.ResponseWriter, r *http.Request) {
+	app.logger.LogInfo(fmt.Sprintf("%s - %s: %s", r.RemoteAddr, r.Method, r.URL.String()), nil)
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	err = app.models.Movies.Restore(id, app.contextGetUser(r).ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	movie, err := app.models.Movies.Get(id)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"movie": movie}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// purgeMovie remove permanently a movie in the trash
+func (app *application) purgeMovie(w http.ResponseWriter, r *http.Request) {
+	app.logger.LogInfo(fmt.Sprintf("%s - %s: %s", r.RemoteAddr, r.Method, r.URL.String()), nil)
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	key, err := app.models.Movies.Purge(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	app.removeMedia(key)
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "movie permanently deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// movieETag return the etag of a movie, the ratings are changed by the reviews and the credits by their own
+// endpoints without a new version of the movie so they are part of the etag
+func (app *application) movieETag(movie *data.Movie, credits []*data.Credit, values ...interface{}) string {
+	etagValues := []interface{}{movie.ID, movie.Version, movie.AverageRating, movie.RatingCount}
+	for _, c := range credits {
+		etagValues = append(etagValues, c.ID, c.PersonID, c.PersonName, c.Role, c.Character, c.BillingOrder)
 	}
+	return app.etag(append(etagValues, values...)...)
 }
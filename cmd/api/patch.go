@@ -0,0 +1,206 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+const (
+	contentTypeJSON       = "application/json"
+	contentTypeJSONPatch  = "application/json-patch+json"
+	contentTypeMergePatch = "application/merge-patch+json"
+)
+
+var errPatchTestFailed = errors.New("the test operation failed")
+
+// patchOperation is an operation of a RFC 6902 JSON Patch document, Value is nil when it is not present
+type patchOperation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	Value json.RawMessage `json:"value"`
+}
+
+// applyJSONPatch apply the add, remove, replace and test operations to a document decoded as interface{},
+// the operations are applied in order and the first failure stop the patch
+func applyJSONPatch(doc interface{}, ops []patchOperation) (interface{}, error) {
+	for i, op := range ops {
+		tokens, err := parsePointer(op.Path)
+		if err != nil {
+			return nil, fmt.Errorf("operation %d: %w", i, err)
+		}
+
+		var value interface{}
+		if op.Op == "add" || op.Op == "replace" || op.Op == "test" {
+			if op.Value == nil {
+				return nil, fmt.Errorf("operation %d: value must be provided", i)
+			}
+			err = json.Unmarshal(op.Value, &value)
+			if err != nil {
+				return nil, fmt.Errorf("operation %d: invalid value", i)
+			}
+		}
+
+		switch op.Op {
+		case "add", "replace", "remove":
+			doc, err = patchSet(doc, tokens, value, op.Op)
+		case "test":
+			var current interface{}
+			current, err = patchGet(doc, tokens)
+			if err == nil && !reflect.DeepEqual(current, value) {
+				err = errPatchTestFailed
+			}
+		default:
+			err = fmt.Errorf("unsupported op %q, use add, remove, replace or test", op.Op)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("operation %d: %w", i, err)
+		}
+	}
+	return doc, nil
+}
+
+// parsePointer split a RFC 6901 JSON Pointer in its reference tokens
+func parsePointer(path string) ([]string, error) {
+	if path == "" {
+		return []string{}, nil
+	}
+	if !strings.HasPrefix(path, "/") {
+		return nil, fmt.Errorf("invalid path %q", path)
+	}
+
+	tokens := strings.Split(path[1:], "/")
+	for i, t := range tokens {
+		tokens[i] = strings.ReplaceAll(strings.ReplaceAll(t, "~1", "/"), "~0", "~")
+	}
+	return tokens, nil
+}
+
+// patchIndex return the array index in a token, max is the highest index allowed
+func patchIndex(token string, max int) (int, error) {
+	i, err := strconv.Atoi(token)
+	if err != nil || i > max || token[0] < '0' || token[0] > '9' || (len(token) > 1 && token[0] == '0') {
+		return 0, fmt.Errorf("invalid array index %q", token)
+	}
+	return i, nil
+}
+
+func patchGet(doc interface{}, tokens []string) (interface{}, error) {
+	for _, t := range tokens {
+		switch d := doc.(type) {
+		case map[string]interface{}:
+			v, ok := d[t]
+			if !ok {
+				return nil, fmt.Errorf("path not found: %s", t)
+			}
+			doc = v
+		case []interface{}:
+			i, err := patchIndex(t, len(d)-1)
+			if err != nil {
+				return nil, err
+			}
+			doc = d[i]
+		default:
+			return nil, fmt.Errorf("path not found: %s", t)
+		}
+	}
+	return doc, nil
+}
+
+// patchSet run an add, replace or remove operation and return the modified document, arrays can be
+// reallocated so the parent always store the returned value
+func patchSet(doc interface{}, tokens []string, value interface{}, op string) (interface{}, error) {
+	if len(tokens) == 0 {
+		if op == "remove" {
+			return nil, errors.New("the whole document can not be removed")
+		}
+		return value, nil
+	}
+	t := tokens[0]
+
+	switch d := doc.(type) {
+	case map[string]interface{}:
+		child, ok := d[t]
+		if len(tokens) == 1 {
+			switch {
+			case !ok && op != "add":
+				return nil, fmt.Errorf("path not found: %s", t)
+			case op == "remove":
+				delete(d, t)
+			default:
+				d[t] = value
+			}
+			return d, nil
+		}
+		if !ok {
+			return nil, fmt.Errorf("path not found: %s", t)
+		}
+		child, err := patchSet(child, tokens[1:], value, op)
+		if err != nil {
+			return nil, err
+		}
+		d[t] = child
+		return d, nil
+	case []interface{}:
+		if len(tokens) == 1 {
+			if t == "-" && op == "add" {
+				return append(d, value), nil
+			}
+			max := len(d) - 1
+			if op == "add" {
+				max = len(d)
+			}
+			i, err := patchIndex(t, max)
+			if err != nil {
+				return nil, err
+			}
+			switch op {
+			case "add":
+				d = append(d, nil)
+				copy(d[i+1:], d[i:])
+				d[i] = value
+			case "remove":
+				d = append(d[:i], d[i+1:]...)
+			default:
+				d[i] = value
+			}
+			return d, nil
+		}
+		i, err := patchIndex(t, len(d)-1)
+		if err != nil {
+			return nil, err
+		}
+		child, err := patchSet(d[i], tokens[1:], value, op)
+		if err != nil {
+			return nil, err
+		}
+		d[i] = child
+		return d, nil
+	default:
+		return nil, fmt.Errorf("path not found: %s", t)
+	}
+}
+
+// applyMergePatch apply a RFC 7396 JSON Merge Patch, null values remove the member from the target
+func applyMergePatch(target, patch interface{}) interface{} {
+	p, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	t, ok := target.(map[string]interface{})
+	if !ok {
+		t = make(map[string]interface{})
+	}
+
+	for k, v := range p {
+		if v == nil {
+			delete(t, k)
+			continue
+		}
+		t[k] = applyMergePatch(t[k], v)
+	}
+	return t
+}
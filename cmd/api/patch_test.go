@@ -0,0 +1,197 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/eze8789/movies-api/data"
+)
+
+func TestApplyJSONPatch(t *testing.T) {
+	const doc = `{"genres":["sci-fi","horror"],"title":"Alien","year":1979}`
+
+	tests := []struct {
+		name    string
+		ops     string
+		want    string
+		wantErr error
+	}{
+		{"replace", `[{"op":"replace","path":"/title","value":"Aliens"}]`,
+			`{"genres":["sci-fi","horror"],"title":"Aliens","year":1979}`, nil},
+		{"append", `[{"op":"add","path":"/genres/-","value":"thriller"}]`,
+			`{"genres":["sci-fi","horror","thriller"],"title":"Alien","year":1979}`, nil},
+		{"insert", `[{"op":"add","path":"/genres/0","value":"drama"}]`,
+			`{"genres":["drama","sci-fi","horror"],"title":"Alien","year":1979}`, nil},
+		{"insert at the end", `[{"op":"add","path":"/genres/2","value":"drama"}]`,
+			`{"genres":["sci-fi","horror","drama"],"title":"Alien","year":1979}`, nil},
+		{"remove", `[{"op":"remove","path":"/genres/0"}]`, `{"genres":["horror"],"title":"Alien","year":1979}`, nil},
+		{"add member", `[{"op":"add","path":"/a~1b~0c","value":1}]`,
+			`{"a/b~c":1,"genres":["sci-fi","horror"],"title":"Alien","year":1979}`, nil},
+		{"test and replace", `[{"op":"test","path":"/year","value":1979},{"op":"replace","path":"/year","value":1986}]`,
+			`{"genres":["sci-fi","horror"],"title":"Alien","year":1986}`, nil},
+		{"test failed", `[{"op":"replace","path":"/year","value":1986},{"op":"test","path":"/year","value":1979}]`, "",
+			errPatchTestFailed},
+		{"index out of range", `[{"op":"add","path":"/genres/3","value":"drama"}]`, "", nil},
+		{"leading zero", `[{"op":"replace","path":"/genres/01","value":"drama"}]`, "", nil},
+		{"append replace", `[{"op":"replace","path":"/genres/-","value":"drama"}]`, "", nil},
+		{"missing member", `[{"op":"remove","path":"/runtime"}]`, "", nil},
+		{"missing value", `[{"op":"replace","path":"/title"}]`, "", nil},
+		{"invalid path", `[{"op":"replace","path":"title","value":"Aliens"}]`, "", nil},
+		{"remove document", `[{"op":"remove","path":""}]`, "", nil},
+		{"unsupported op", `[{"op":"move","from":"/title","path":"/name"}]`, "", nil},
+	}
+	for _, tt := range tests {
+		var target interface{}
+		err := json.Unmarshal([]byte(doc), &target)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var ops []patchOperation
+		err = json.Unmarshal([]byte(tt.ops), &ops)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := applyJSONPatch(target, ops)
+		if tt.want == "" {
+			if err == nil {
+				t.Errorf("%s: got no error, want the patch to fail", tt.name)
+			} else if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Errorf("%s: got error %v, want %v", tt.name, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: got error %v", tt.name, err)
+			continue
+		}
+		b, err := json.Marshal(got)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.name, b, tt.want)
+		}
+	}
+}
+
+func TestParsePointer(t *testing.T) {
+	tests := []struct {
+		path    string
+		want    []string
+		wantErr bool
+	}{
+		{"", []string{}, false},
+		{"/", []string{""}, false},
+		{"/genres/-", []string{"genres", "-"}, false},
+		{"/a~1b/c~0d", []string{"a/b", "c~d"}, false},
+		// ~01 is decoded to ~1 and not to /
+		{"/~01", []string{"~1"}, false},
+		{"genres", nil, true},
+	}
+	for _, tt := range tests {
+		got, err := parsePointer(tt.path)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("path %q: got error %v, want error %t", tt.path, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && fmt.Sprintf("%q", got) != fmt.Sprintf("%q", tt.want) {
+			t.Errorf("path %q: got %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestPatchIndex(t *testing.T) {
+	tests := []struct {
+		token   string
+		max     int
+		want    int
+		wantErr bool
+	}{
+		{"0", 0, 0, false},
+		{"2", 2, 2, false},
+		{"3", 2, 0, true},
+		{"01", 2, 0, true},
+		{"-1", 2, 0, true},
+		{"+1", 2, 0, true},
+		{"-", 2, 0, true},
+		{"a", 2, 0, true},
+	}
+	for _, tt := range tests {
+		got, err := patchIndex(tt.token, tt.max)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("token %q max %d: got %d and error %v, want %d and error %t", tt.token, tt.max, got, err,
+				tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestApplyMergePatch(t *testing.T) {
+	tests := []struct {
+		target string
+		patch  string
+		want   string
+	}{
+		{`{"title":"Alien","year":1979}`, `{"title":"Aliens"}`, `{"title":"Aliens","year":1979}`},
+		{`{"title":"Alien","year":1979}`, `{"year":null}`, `{"title":"Alien"}`},
+		{`{"genres":["sci-fi","horror"]}`, `{"genres":["drama"]}`, `{"genres":["drama"]}`},
+		{`{"a":{"b":1,"c":2}}`, `{"a":{"b":null,"d":3}}`, `{"a":{"c":2,"d":3}}`},
+		{`{"a":1}`, `{"a":{"b":null}}`, `{"a":{}}`},
+		{`{"a":1}`, `["b"]`, `["b"]`},
+		{`["a"]`, `{"b":1}`, `{"b":1}`},
+	}
+	for _, tt := range tests {
+		var target, patch interface{}
+		err := json.Unmarshal([]byte(tt.target), &target)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = json.Unmarshal([]byte(tt.patch), &patch)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		b, err := json.Marshal(applyMergePatch(target, patch))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != tt.want {
+			t.Errorf("target %s patch %s: got %s, want %s", tt.target, tt.patch, b, tt.want)
+		}
+	}
+}
+
+func TestUpdateMovieJSONPatch(t *testing.T) {
+	app, h := newTestApplication(t)
+	token := testToken(t, app)
+	path := fmt.Sprintf("/v1/movies/%d", createTestMovie(t, h, token, "Patched", "drama"))
+	jsonPatch := map[string]string{"Content-Type": contentTypeJSONPatch}
+
+	var resp struct {
+		Movie data.Movie `json:"movie"`
+	}
+	ops := []map[string]interface{}{{"op": "add", "path": "/genres/-", "value": "comedy"}}
+	w := testRequest(t, h, http.MethodPatch, path, token, ops, jsonPatch)
+	decodeResponse(t, w, http.StatusOK, &resp)
+	if fmt.Sprint(resp.Movie.Genres) != "[drama comedy]" {
+		t.Fatalf("got genres %v, want [drama comedy]", resp.Movie.Genres)
+	}
+
+	// a failed test operation does not change the movie
+	ops = []map[string]interface{}{
+		{"op": "replace", "path": "/title", "value": "Not Patched"},
+		{"op": "test", "path": "/year", "value": 1999},
+	}
+	w = testRequest(t, h, http.MethodPatch, path, token, ops, jsonPatch)
+	decodeResponse(t, w, http.StatusConflict, nil)
+
+	resp.Movie = data.Movie{}
+	w = testRequest(t, h, http.MethodGet, path, token, nil, nil)
+	decodeResponse(t, w, http.StatusOK, &resp)
+	if resp.Movie.Title != "Patched" || resp.Movie.Version != 2 {
+		t.Fatalf("got %q version %d, want the movie of the first patch", resp.Movie.Title, resp.Movie.Version)
+	}
+}
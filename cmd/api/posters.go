@@ -0,0 +1,312 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	_ "image/gif" // register the decoder used by image.Decode
+	"image/jpeg"
+	_ "image/png" // register the decoder used by image.Decode
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/eze8789/movies-api/data"
+)
+
+const (
+	posterMaxBytes  = 10 << 20
+	posterMaxPixels = 16_000_000
+	posterDecodes   = 2
+	thumbnailJPEG   = 85
+)
+
+var errInvalidPoster = errors.New("invalid image")
+
+// posterSlots limit the posters decoded at the same time, an image take 4 bytes per pixel once decoded and
+// the same again to be flattened
+var posterSlots = make(chan struct{}, posterDecodes)
+
+// posterSizes hold the width in pixels of every thumbnail generated, images are never enlarged
+var posterSizes = []struct {
+	Name  string
+	Width int
+}{
+	{Name: "w185", Width: 185},
+	{Name: "w342", Width: 342},
+	{Name: "w780", Width: 780},
+}
+
+// posterTypes hold the extension of the image types accepted, the type is sniffed from the content
+var posterTypes = map[string]string{
+	"image/jpeg": "jpg",
+	"image/png":  "png",
+	"image/gif":  "gif",
+}
+
+// uploadPoster replace the poster of a movie with the image sent in the poster field of a multipart form,
+// the original image is stored along with the thumbnails
+func (app *application) uploadPoster(w http.ResponseWriter, r *http.Request) {
+	app.logger.LogInfo(fmt.Sprintf("%s - %s: %s", r.RemoteAddr, r.Method, r.URL.String()), nil)
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	movie, err := app.models.Movies.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	credits, err := app.models.Credits.GetForMovie(movie.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if !app.checkIfMatch(r, app.movieETag(movie, credits)) {
+		app.preconditionFailedResponse(w, r)
+		return
+	}
+
+	content, err := app.readPoster(w, r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	contentType := http.DetectContentType(content)
+	ext, ok := posterTypes[contentType]
+	if !ok {
+		app.unsupportedMediaTypeResponse(w, r, "image/jpeg", "image/png", "image/gif")
+		return
+	}
+
+	posterSlots <- struct{}{}
+	poster, key, err := app.processPoster(movie.ID, content, contentType, ext)
+	<-posterSlots
+	if err != nil {
+		switch {
+		case errors.Is(err, errInvalidPoster):
+			app.badRequestResponse(w, r, err)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	movie.Poster = poster
+	previous, err := app.models.Movies.SetPoster(movie, key, app.contextGetUser(r).ID)
+	if err != nil {
+		app.removeMedia(key)
+		switch {
+		case errors.Is(err, data.ErrEditConflict) && r.Header.Get("If-Match") != "":
+			app.preconditionFailedResponse(w, r)
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	app.removeMedia(previous)
+
+	headers := make(http.Header)
+	headers.Set("ETag", app.movieETag(movie, credits))
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"movie": movie}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// readPoster return the content of the poster field, the body is limited to posterMaxBytes like readJSON
+func (app *application) readPoster(w http.ResponseWriter, r *http.Request) ([]byte, error) {
+	r.Body = http.MaxBytesReader(w, r.Body, posterMaxBytes)
+
+	err := r.ParseMultipartForm(1 << 20) //nolint:gomnd
+	if err != nil {
+		switch {
+		case err.Error() == "http: request body too large":
+			return nil, fmt.Errorf("payload must not be larger than %d bytes", posterMaxBytes)
+		case errors.Is(err, http.ErrNotMultipart):
+			return nil, errors.New("body must be a multipart form")
+		default:
+			return nil, err
+		}
+	}
+	defer r.MultipartForm.RemoveAll() //nolint:errcheck
+
+	f, _, err := r.FormFile("poster")
+	if err != nil {
+		return nil, errors.New("the poster field must contain the image")
+	}
+	defer f.Close()
+
+	return io.ReadAll(f)
+}
+
+// processPoster decode the image and store it with the thumbnails under a new key, nothing is stored when the
+// image is not valid
+func (app *application) processPoster(movieID int64, content []byte, contentType, ext string) (data.Poster, string, error) {
+	img, err := decodePoster(content)
+	if err != nil {
+		return nil, "", err
+	}
+
+	key, err := posterKey(movieID)
+	if err != nil {
+		return nil, "", err
+	}
+	poster, err := app.storePoster(key, content, contentType, ext, img)
+	if err != nil {
+		app.removeMedia(key)
+		return nil, "", err
+	}
+	return poster, key, nil
+}
+
+// decodePoster decode the image checking the dimensions first, so big images are not decoded in memory
+func decodePoster(content []byte) (image.Image, error) {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(content))
+	if err != nil {
+		return nil, errInvalidPoster
+	}
+	if cfg.Width < 1 || cfg.Height < 1 || cfg.Width*cfg.Height > posterMaxPixels {
+		return nil, fmt.Errorf("%w: must not have more than %d pixels", errInvalidPoster, posterMaxPixels)
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(content))
+	if err != nil {
+		return nil, errInvalidPoster
+	}
+	return img, nil
+}
+
+// posterKey return a new storage prefix for the poster of a movie, every upload use a different prefix so
+// the cached files of the previous poster are never served for the new one
+func posterKey(movieID int64) (string, error) {
+	b := make([]byte, 8) //nolint:gomnd
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("posters/%d/%s", movieID, hex.EncodeToString(b)), nil
+}
+
+// storePoster store the original image and the thumbnails under the key and return their urls
+func (app *application) storePoster(key string, content []byte, contentType, ext string,
+	img image.Image) (data.Poster, error) {
+	poster := data.Poster{}
+
+	original := fmt.Sprintf("%s/original.%s", key, ext)
+	err := app.storage.Put(original, content, contentType)
+	if err != nil {
+		return nil, err
+	}
+	poster["original"] = app.storage.URL(original)
+
+	src := flatten(img)
+	for _, size := range posterSizes {
+		var buf bytes.Buffer
+		err = jpeg.Encode(&buf, resize(src, size.Width), &jpeg.Options{Quality: thumbnailJPEG})
+		if err != nil {
+			return nil, err
+		}
+
+		thumbnail := fmt.Sprintf("%s/%s.jpg", key, size.Name)
+		err = app.storage.Put(thumbnail, buf.Bytes(), "image/jpeg")
+		if err != nil {
+			return nil, err
+		}
+		poster[size.Name] = app.storage.URL(thumbnail)
+	}
+	return poster, nil
+}
+
+// removeMedia remove the files stored under the key, errors are only logged because the files are not
+// referenced anymore
+func (app *application) removeMedia(key string) {
+	if key == "" {
+		return
+	}
+	err := app.storage.DeletePrefix(key)
+	if err != nil {
+		app.logger.LogError(err, map[string]string{"key": key})
+	}
+}
+
+// serveMedia serve the files of the local storage, directories are not listed
+func (app *application) serveMedia(dir string) http.Handler {
+	fs := http.StripPrefix("/v1/media", http.FileServer(http.Dir(dir)))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/") {
+			app.notFoundResponse(w, r)
+			return
+		}
+		w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+		fs.ServeHTTP(w, r)
+	})
+}
+
+// flatten draw the image over a white background, the thumbnails are encoded as JPEG without transparency
+func flatten(img image.Image) *image.RGBA {
+	b := img.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(dst, dst.Bounds(), image.White, image.Point{}, draw.Src)
+	draw.Draw(dst, dst.Bounds(), img, b.Min, draw.Over)
+	return dst
+}
+
+// resize scale the image to the given width keeping the aspect ratio, every pixel is the average of the
+// source pixels it covers. Images narrower than width keep their size.
+func resize(src *image.RGBA, width int) image.Image {
+	sw, sh := src.Rect.Dx(), src.Rect.Dy()
+	if width > sw {
+		width = sw
+	}
+	height := sh * width / sw
+	if height < 1 {
+		height = 1
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		y0, y1 := y*sh/height, (y+1)*sh/height
+		if y1 == y0 {
+			y1 = y0 + 1
+		}
+		for x := 0; x < width; x++ {
+			x0, x1 := x*sw/width, (x+1)*sw/width
+			if x1 == x0 {
+				x1 = x0 + 1
+			}
+
+			var sum [4]int
+			for sy := y0; sy < y1; sy++ {
+				row := src.Pix[sy*src.Stride+x0*4 : sy*src.Stride+x1*4]
+				for i := 0; i < len(row); i += 4 {
+					sum[0] += int(row[i])
+					sum[1] += int(row[i+1])
+					sum[2] += int(row[i+2])
+					sum[3] += int(row[i+3])
+				}
+			}
+			n := (y1 - y0) * (x1 - x0)
+			p := dst.Pix[y*dst.Stride+x*4:]
+			for i := range sum {
+				p[i] = uint8(sum[i] / n)
+			}
+		}
+	}
+	return dst
+}
@@ -18,22 +18,122 @@ func (app *application) routes() http.Handler {
 	// Movies Endpoints, for this access user activated and authenticated is required
 	rtr.HandlerFunc(http.MethodGet, "/v1/movies", app.reqPermission("movies:read", app.listMovie))
 	rtr.HandlerFunc(http.MethodPost, "/v1/movies", app.reqPermission("movies:write", app.createMovieHandler))
-	rtr.HandlerFunc(http.MethodGet, "/v1/movies/:id", app.reqPermission("movies:read", app.showMovie))
+	rtr.HandlerFunc(http.MethodPost, "/v1/movies/:id", app.staticOr(map[string]http.HandlerFunc{
+		"import": app.reqPermission("movies:write", app.importMovies),
+	}, app.notFoundResponse))
+	rtr.HandlerFunc(http.MethodGet, "/v1/imports/:id", app.reqPermission("movies:write", app.showImport))
+	rtr.HandlerFunc(http.MethodGet, "/v1/movies/:id", app.staticOr(map[string]http.HandlerFunc{
+		"trash":  app.reqPermission("movies:write", app.listTrash),
+		"export": app.reqPermission("movies:read", app.exportMovies),
+	}, app.reqPermission("movies:read", app.showMovie)))
 	rtr.HandlerFunc(http.MethodPatch, "/v1/movies/:id", app.reqPermission("movies:write", app.updateMovie))
 	rtr.HandlerFunc(http.MethodDelete, "/v1/movies/:id", app.reqPermission("movies:write", app.deleteMovie))
+	rtr.HandlerFunc(http.MethodPost, "/v1/movies/:id/restore", app.reqPermission("movies:write", app.restoreMovie))
+	rtr.HandlerFunc(http.MethodDelete, "/v1/movies/:id/purge", app.reqPermission("movies:admin", app.purgeMovie))
+	rtr.HandlerFunc(http.MethodPut, "/v1/movies/:id/poster", app.reqPermission("movies:write", app.uploadPoster))
+
+	// Genres Endpoints, the catalogue is managed by the movies admins
+	rtr.HandlerFunc(http.MethodGet, "/v1/genres", app.reqPermission("movies:read", app.listGenres))
+	rtr.HandlerFunc(http.MethodPost, "/v1/genres", app.reqPermission("movies:admin", app.createGenre))
+	rtr.HandlerFunc(http.MethodGet, "/v1/genres/:id", app.reqPermission("movies:read", app.showGenre))
+	rtr.HandlerFunc(http.MethodPatch, "/v1/genres/:id", app.reqPermission("movies:admin", app.updateGenre))
+	rtr.HandlerFunc(http.MethodDelete, "/v1/genres/:id", app.reqPermission("movies:admin", app.deleteGenre))
+	rtr.HandlerFunc(http.MethodPost, "/v1/genres/:id/merge", app.reqPermission("movies:admin", app.mergeGenre))
 
 	// Users Endpoints
 	rtr.HandlerFunc(http.MethodPost, "/v1/users", app.registerUser)
 	rtr.HandlerFunc(http.MethodPut, "/v1/users/activate", app.activateUser)
 	rtr.HandlerFunc(http.MethodPut, "/v1/users/password", app.passwordReset)
+	rtr.HandlerFunc(http.MethodGet, "/v1/users/me", app.reqAuthenticatedUser(app.showCurrentUser))
+	rtr.HandlerFunc(http.MethodPatch, "/v1/users/me", app.reqAuthenticatedUser(app.updateCurrentUser))
+	rtr.HandlerFunc(http.MethodDelete, "/v1/users/me", app.reqAuthenticatedUser(app.deleteCurrentUser))
+	rtr.HandlerFunc(http.MethodPost, "/v1/users/me/restore", app.reqAuthenticatedUser(app.restoreCurrentUser))
+	rtr.HandlerFunc(http.MethodGet, "/v1/users/me/export", app.reqAuthenticatedUser(app.exportCurrentUser))
+	rtr.HandlerFunc(http.MethodGet, "/v1/users/me/export/:token", app.reqAuthenticatedUser(app.downloadExport))
+	rtr.HandlerFunc(http.MethodPost, "/v1/users/me/email", app.reqActivatedUser(app.requestEmailChange))
+	rtr.HandlerFunc(http.MethodPut, "/v1/users/email", app.confirmEmailChange)
+	rtr.HandlerFunc(http.MethodPut, "/v1/users/email/revert", app.revertEmailChange)
+
+	// Permissions Endpoints, roles bundle permissions and grant them to every user assigned
+	rtr.HandlerFunc(http.MethodGet, "/v1/permissions", app.reqPermission("permissions:admin", app.listPermissions))
+	rtr.HandlerFunc(http.MethodGet, "/v1/roles", app.reqPermission("permissions:admin", app.listRoles))
+	rtr.HandlerFunc(http.MethodPost, "/v1/roles", app.reqPermission("permissions:admin", app.createRole))
+	rtr.HandlerFunc(http.MethodGet, "/v1/roles/:id", app.reqPermission("permissions:admin", app.showRole))
+	rtr.HandlerFunc(http.MethodPatch, "/v1/roles/:id", app.reqPermission("permissions:admin", app.updateRole))
+	rtr.HandlerFunc(http.MethodDelete, "/v1/roles/:id", app.reqPermission("permissions:admin", app.deleteRole))
+	rtr.HandlerFunc(http.MethodGet, "/v1/admin/users/:id/permissions",
+		app.reqPermission("permissions:admin", app.showUserPermissions))
+	rtr.HandlerFunc(http.MethodPut, "/v1/admin/users/:id/permissions/:code",
+		app.reqPermission("permissions:admin", app.grantUserPermission))
+	rtr.HandlerFunc(http.MethodDelete, "/v1/admin/users/:id/permissions/:code",
+		app.reqPermission("permissions:admin", app.revokeUserPermission))
+	rtr.HandlerFunc(http.MethodPut, "/v1/admin/users/:id/roles/:role_id",
+		app.reqPermission("permissions:admin", app.assignUserRole))
+	rtr.HandlerFunc(http.MethodDelete, "/v1/admin/users/:id/roles/:role_id",
+		app.reqPermission("permissions:admin", app.unassignUserRole))
+
+	// Revisions Endpoints, every change of a movie is recorded with the user who made it
+	rtr.HandlerFunc(http.MethodGet, "/v1/movies/:id/revisions", app.reqPermission("movies:read", app.listRevisions))
+	rtr.HandlerFunc(http.MethodGet, "/v1/movies/:id/revisions/:version",
+		app.reqPermission("movies:read", app.showRevision))
+	rtr.HandlerFunc(http.MethodGet, "/v1/movies/:id/revisions/:version/diff",
+		app.reqPermission("movies:read", app.diffRevisions))
+	rtr.HandlerFunc(http.MethodPost, "/v1/movies/:id/revisions/:version/restore",
+		app.reqPermission("movies:write", app.restoreRevision))
+	rtr.HandlerFunc(http.MethodPost, "/v1/movies/:id/credits", app.reqPermission("movies:write", app.createCredit))
+	rtr.HandlerFunc(http.MethodDelete, "/v1/movies/:id/credits/:credit_id",
+		app.reqPermission("movies:write", app.deleteCredit))
+
+	// Reviews Endpoints, any activated user can review a movie
+	rtr.HandlerFunc(http.MethodGet, "/v1/movies/:id/reviews", app.reqPermission("movies:read", app.listReviews))
+	rtr.HandlerFunc(http.MethodPost, "/v1/movies/:id/reviews", app.reqActivatedUser(app.createReview))
+	rtr.HandlerFunc(http.MethodPut, "/v1/movies/:id/reviews", app.reqActivatedUser(app.updateReview))
+	rtr.HandlerFunc(http.MethodDelete, "/v1/movies/:id/reviews", app.reqActivatedUser(app.deleteReview))
+
+	// People Endpoints, cast and crew share the movies permissions
+	rtr.HandlerFunc(http.MethodGet, "/v1/people", app.reqPermission("movies:read", app.listPeople))
+	rtr.HandlerFunc(http.MethodPost, "/v1/people", app.reqPermission("movies:write", app.createPerson))
+	rtr.HandlerFunc(http.MethodGet, "/v1/people/:id", app.reqPermission("movies:read", app.showPerson))
+	rtr.HandlerFunc(http.MethodPatch, "/v1/people/:id", app.reqPermission("movies:write", app.updatePerson))
+	rtr.HandlerFunc(http.MethodDelete, "/v1/people/:id", app.reqPermission("movies:write", app.deletePerson))
+	rtr.HandlerFunc(http.MethodGet, "/v1/people/:id/movies", app.reqPermission("movies:read", app.listPersonMovies))
+
+	// Lists Endpoints, lists are owned by the authenticated user and can be shared using the slug
+	rtr.HandlerFunc(http.MethodGet, "/v1/users/me/lists", app.reqActivatedUser(app.listUserLists))
+	rtr.HandlerFunc(http.MethodPost, "/v1/users/me/lists", app.reqActivatedUser(app.createUserList))
+	rtr.HandlerFunc(http.MethodGet, "/v1/users/me/lists/:list_id", app.reqActivatedUser(app.showUserList))
+	rtr.HandlerFunc(http.MethodPatch, "/v1/users/me/lists/:list_id", app.reqActivatedUser(app.updateUserList))
+	rtr.HandlerFunc(http.MethodDelete, "/v1/users/me/lists/:list_id", app.reqActivatedUser(app.deleteUserList))
+	rtr.HandlerFunc(http.MethodPost, "/v1/users/me/lists/:list_id/movies", app.reqActivatedUser(app.addUserListMovie))
+	rtr.HandlerFunc(http.MethodPut, "/v1/users/me/lists/:list_id/movies", app.reqActivatedUser(app.reorderUserList))
+	rtr.HandlerFunc(http.MethodPatch, "/v1/users/me/lists/:list_id/movies/:movie_id",
+		app.reqActivatedUser(app.markUserListMovie))
+	rtr.HandlerFunc(http.MethodDelete, "/v1/users/me/lists/:list_id/movies/:movie_id",
+		app.reqActivatedUser(app.removeUserListMovie))
+	rtr.HandlerFunc(http.MethodGet, "/v1/lists/:slug", app.showSharedList)
 
 	// Tokens Endpoints
 	rtr.HandlerFunc(http.MethodPost, "/v1/tokens/activation", app.createActivationToken)
 	rtr.HandlerFunc(http.MethodPost, "/v1/tokens/authentication", app.createAuthenticationToken)
 	rtr.HandlerFunc(http.MethodPost, "/v1/tokens/password-reset", app.createPasswordResetToken)
 
+	// Media Endpoints, the files of the local storage are public so they can be used in image tags
+	rtr.Handler(http.MethodGet, "/v1/media/*filepath", app.serveMedia(app.config.storage.dir))
+
 	// metrics
 	rtr.Handler(http.MethodGet, "/v1/metrics", expvar.Handler())
 
 	return app.metrics(app.recoverPanic(app.rateLimiter(app.authenticate(rtr))))
 }
+
+// staticOr serve the static path segments that can not be registered next to the :id wildcard,
+// httprouter does not allow both in the same position
+func (app *application) staticOr(static map[string]http.HandlerFunc, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if h, ok := static[httprouter.ParamsFromContext(r.Context()).ByName("id")]; ok {
+			h(w, r)
+			return
+		}
+		next(w, r)
+	}
+}
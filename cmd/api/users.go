@@ -213,3 +213,131 @@ func (app *application) passwordReset(w http.ResponseWriter, r *http.Request) {
 		app.serverErrorResponse(w, r, err)
 	}
 }
+
+// readCurrentUser return the authenticated user read from the database, the user in the request context can
+// be cached and have an old version
+func (app *application) readCurrentUser(w http.ResponseWriter, r *http.Request) (*data.User, bool) {
+	u, err := app.models.Users.Get(app.contextGetUser(r).ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.invalidAuthTokenResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+	return u, true
+}
+
+// writeCurrentUser send the profile and permissions of the authenticated user, the ETag change with the user
+// version so it can be used with If-Match to update the profile
+func (app *application) writeCurrentUser(w http.ResponseWriter, r *http.Request, u *data.User) {
+	perms, err := app.models.Permissions.GetAllForUser(u.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("ETag", app.etag(u.ID, u.Version))
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"user": u, "permissions": perms}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// showCurrentUser return the profile and permissions of the authenticated user
+func (app *application) showCurrentUser(w http.ResponseWriter, r *http.Request) {
+	app.logger.LogInfo(fmt.Sprintf("%s - %s: %s", r.RemoteAddr, r.Method, r.URL.String()), nil)
+	u, ok := app.readCurrentUser(w, r)
+	if !ok {
+		return
+	}
+	app.writeCurrentUser(w, r, u)
+}
+
+// updateCurrentUser change the name or the password of the authenticated user, the current password is
+// required to set a new one
+func (app *application) updateCurrentUser(w http.ResponseWriter, r *http.Request) {
+	app.logger.LogInfo(fmt.Sprintf("%s - %s: %s", r.RemoteAddr, r.Method, r.URL.String()), nil)
+	u, ok := app.readCurrentUser(w, r)
+	if !ok {
+		return
+	}
+
+	if !app.checkIfMatch(r, app.etag(u.ID, u.Version)) {
+		app.preconditionFailedResponse(w, r)
+		return
+	}
+
+	var input struct {
+		Name            *string `json:"name"`
+		Password        *string `json:"password"`
+		CurrentPassword string  `json:"current_password"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	if input.Password != nil {
+		v.Check(input.CurrentPassword != "", "current_password", "must be provided to change the password")
+		data.ValidatePasswordPlain(v, *input.Password)
+		if !v.Valid() {
+			app.failedValidationResponse(w, r, v.Errors)
+			return
+		}
+
+		var match bool
+		match, err = u.Password.Match(input.CurrentPassword)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		if !match {
+			v.AddError("current_password", "does not match")
+			app.failedValidationResponse(w, r, v.Errors)
+			return
+		}
+
+		err = u.Password.Set(*input.Password)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+	if input.Name != nil {
+		u.Name = *input.Name
+	}
+
+	if data.ValidateUser(v, u); !v.Valid() { //nolint:gocritic
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Users.Update(u)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// the password reset tokens requested with the previous password are no longer valid
+	if input.Password != nil {
+		err = app.models.Tokens.DeleteAllByUser(u.ID, data.ScopePasswordReset)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	app.writeCurrentUser(w, r, u)
+}
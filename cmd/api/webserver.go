@@ -19,8 +19,14 @@ func (app *application) server() {
 		IdleTimeout:  time.Minute,
 		ReadTimeout:  10 * time.Second,
 		WriteTimeout: 30 * time.Second,
+		ConnContext:  contextSetConn,
 	}
 
+	// background jobs stop when the context is cancelled on shutdown
+	jobsCtx, stopJobs := context.WithCancel(context.Background())
+	app.runPeriodic(jobsCtx, app.config.trash.purgeInterval, app.purgeTrash)
+	app.runPeriodic(jobsCtx, app.config.account.purgeInterval, app.purgeAccounts)
+
 	done := make(chan bool, 1)
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM)
@@ -29,6 +35,7 @@ func (app *application) server() {
 	go func() {
 		sig := <-quit
 		app.logger.LogInfo("shutting down webserver, waiting for background tasks", map[string]string{"signal": sig.String()})
+		stopJobs()
 		ctx, cancel := context.WithTimeout(context.Background(), webserverTimeout*time.Second)
 		defer cancel()
 
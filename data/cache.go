@@ -0,0 +1,290 @@
+package data
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"expvar"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Cache keep the users of the authentication tokens and the permissions of the users in memory, it is used
+// by the repositories returned by NewCachedModels. Every change made through those repositories invalidate the
+// entries affected, changes made by other processes like the admin subcommand are seen once the TTL expire.
+type Cache struct {
+	tokens      *lruCache
+	permissions *lruCache
+	metrics     *expvar.Map
+}
+
+// NewCachedModels return the models with the users, tokens, permissions and roles repositories wrapped by a cache
+// of size entries per lookup kept up to ttl, the cache is returned to publish its metrics
+func NewCachedModels(m Models, ttl time.Duration, size int) (Models, *Cache) {
+	metrics := new(expvar.Map).Init()
+	c := &Cache{
+		tokens:      newLRUCache(ttl, size, metrics, "tokens"),
+		permissions: newLRUCache(ttl, size, metrics, "permissions"),
+		metrics:     metrics,
+	}
+
+	m.Users = &cachedUsers{UserRepository: m.Users, cache: c}
+	m.Tokens = &cachedTokens{TokenRepository: m.Tokens, cache: c}
+	m.Permissions = &cachedPermissions{PermissionRepository: m.Permissions, cache: c}
+	m.Roles = &cachedRoles{RoleRepository: m.Roles, cache: c}
+	return m, c
+}
+
+// Metrics return the hits, misses and evictions of the token and permission lookups
+func (c *Cache) Metrics() expvar.Var {
+	return c.metrics
+}
+
+// InvalidateUser remove the tokens and permissions cached for a user
+func (c *Cache) InvalidateUser(userID int64) {
+	c.tokens.deleteFunc(func(v interface{}) bool { return v.(*User).ID == userID })
+	c.permissions.delete(strconv.FormatInt(userID, 10))
+}
+
+type cachedUsers struct {
+	UserRepository
+	cache *Cache
+}
+
+func (cu *cachedUsers) Update(user *User) error {
+	err := cu.UserRepository.Update(user)
+	// the cached users hold the previous password and activation status
+	cu.cache.InvalidateUser(user.ID)
+	return err
+}
+
+// GetForToken cache the users of the authentication tokens, the other scopes are looked up once
+func (cu *cachedUsers) GetForToken(token, scope string) (*User, error) {
+	if scope != ScopeAuthentication {
+		return cu.UserRepository.GetForToken(token, scope)
+	}
+
+	tokenHash := sha256.Sum256([]byte(token))
+	key := string(tokenHash[:])
+	v, ok, gen := cu.cache.tokens.get(key)
+	if ok {
+		u := *v.(*User)
+		return &u, nil
+	}
+
+	user, err := cu.UserRepository.GetForToken(token, scope)
+	if err != nil {
+		return nil, err
+	}
+	// the handlers can change the user in the request context so a copy is stored, the entry does not outlive
+	// the token
+	u := *user
+	cu.cache.tokens.set(key, &u, gen, user.tokenExpiry)
+	return user, nil
+}
+
+func (cu *cachedUsers) DeleteScheduledBefore(t time.Time) ([]int64, error) {
+	ids, err := cu.UserRepository.DeleteScheduledBefore(t)
+	for _, id := range ids {
+		cu.cache.InvalidateUser(id)
+	}
+	return ids, err
+}
+
+type cachedTokens struct {
+	TokenRepository
+	cache *Cache
+}
+
+func (ct *cachedTokens) DeleteAllByUser(userID int64, scope string) error {
+	err := ct.TokenRepository.DeleteAllByUser(userID, scope)
+	ct.cache.InvalidateUser(userID)
+	return err
+}
+
+func (ct *cachedTokens) DeleteAllForUser(userID int64) error {
+	err := ct.TokenRepository.DeleteAllForUser(userID)
+	ct.cache.InvalidateUser(userID)
+	return err
+}
+
+type cachedPermissions struct {
+	PermissionRepository
+	cache *Cache
+}
+
+func (cp *cachedPermissions) GetAllForUser(id int64) (Permissions, error) {
+	key := strconv.FormatInt(id, 10)
+	v, ok, gen := cp.cache.permissions.get(key)
+	if ok {
+		return append(Permissions{}, v.(Permissions)...), nil
+	}
+
+	perms, err := cp.PermissionRepository.GetAllForUser(id)
+	if err != nil {
+		return nil, err
+	}
+	cp.cache.permissions.set(key, append(Permissions{}, perms...), gen, time.Time{})
+	return perms, nil
+}
+
+func (cp *cachedPermissions) AddForUser(id int64, perms ...string) error {
+	err := cp.PermissionRepository.AddForUser(id, perms...)
+	cp.cache.permissions.delete(strconv.FormatInt(id, 10))
+	return err
+}
+
+func (cp *cachedPermissions) RemoveForUser(id int64, perms ...string) error {
+	err := cp.PermissionRepository.RemoveForUser(id, perms...)
+	cp.cache.permissions.delete(strconv.FormatInt(id, 10))
+	return err
+}
+
+// cachedRoles invalidate the permissions of the users of a role when it change, the users of a role are not
+// known by the cache so every permission is removed
+type cachedRoles struct {
+	RoleRepository
+	cache *Cache
+}
+
+func (cr *cachedRoles) Update(role *Role) error {
+	err := cr.RoleRepository.Update(role)
+	cr.cache.permissions.clear()
+	return err
+}
+
+func (cr *cachedRoles) Delete(id int64) error {
+	err := cr.RoleRepository.Delete(id)
+	cr.cache.permissions.clear()
+	return err
+}
+
+func (cr *cachedRoles) AddForUser(userID, roleID int64) error {
+	err := cr.RoleRepository.AddForUser(userID, roleID)
+	cr.cache.permissions.delete(strconv.FormatInt(userID, 10))
+	return err
+}
+
+func (cr *cachedRoles) RemoveForUser(userID, roleID int64) error {
+	err := cr.RoleRepository.RemoveForUser(userID, roleID)
+	cr.cache.permissions.delete(strconv.FormatInt(userID, 10))
+	return err
+}
+
+// lruCache is a cache bounded to size entries that evict the least recently used entry, the entries expire
+// after the TTL. Every invalidation increase the generation so a value read from the database before an
+// invalidation is not stored after it.
+type lruCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	size    int
+	gen     uint64
+	entries *list.List
+	keys    map[string]*list.Element
+
+	hits, misses, evictions string
+	metrics                 *expvar.Map
+}
+
+type lruEntry struct {
+	key    string
+	value  interface{}
+	expiry time.Time
+}
+
+func newLRUCache(ttl time.Duration, size int, metrics *expvar.Map, name string) *lruCache {
+	c := &lruCache{
+		ttl:       ttl,
+		size:      size,
+		entries:   list.New(),
+		keys:      make(map[string]*list.Element),
+		hits:      name + "_hits",
+		misses:    name + "_misses",
+		evictions: name + "_evictions",
+		metrics:   metrics,
+	}
+	// publish the counters before the first lookup
+	metrics.Add(c.hits, 0)
+	metrics.Add(c.misses, 0)
+	metrics.Add(c.evictions, 0)
+	return c
+}
+
+// get return the value of a key and the generation to pass to set when the value was not found
+func (c *lruCache) get(key string) (interface{}, bool, uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.keys[key]
+	if !ok || time.Now().After(e.Value.(*lruEntry).expiry) {
+		if ok {
+			c.remove(e)
+		}
+		c.metrics.Add(c.misses, 1)
+		return nil, false, c.gen
+	}
+	c.entries.MoveToFront(e)
+	c.metrics.Add(c.hits, 1)
+	return e.Value.(*lruEntry).value, true, c.gen
+}
+
+// set store the value unless the cache was invalidated since the generation was returned by get, the entry
+// expire after the TTL or at expiry when it is set and earlier
+func (c *lruCache) set(key string, value interface{}, gen uint64, expiry time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if gen != c.gen || c.size < 1 {
+		return
+	}
+	if e, ok := c.keys[key]; ok {
+		c.remove(e)
+	}
+	if ttlExpiry := time.Now().Add(c.ttl); expiry.IsZero() || ttlExpiry.Before(expiry) {
+		expiry = ttlExpiry
+	}
+	c.keys[key] = c.entries.PushFront(&lruEntry{key: key, value: value, expiry: expiry})
+	for c.entries.Len() > c.size {
+		c.remove(c.entries.Back())
+		c.metrics.Add(c.evictions, 1)
+	}
+}
+
+func (c *lruCache) delete(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.gen++
+	if e, ok := c.keys[key]; ok {
+		c.remove(e)
+	}
+}
+
+// deleteFunc remove the entries with a value matching fn
+func (c *lruCache) deleteFunc(fn func(interface{}) bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.gen++
+	for e := c.entries.Front(); e != nil; {
+		next := e.Next()
+		if fn(e.Value.(*lruEntry).value) {
+			c.remove(e)
+		}
+		e = next
+	}
+}
+
+func (c *lruCache) clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.gen++
+	c.entries.Init()
+	c.keys = make(map[string]*list.Element)
+}
+
+func (c *lruCache) remove(e *list.Element) {
+	c.entries.Remove(e)
+	delete(c.keys, e.Value.(*lruEntry).key)
+}
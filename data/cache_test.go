@@ -0,0 +1,119 @@
+package data
+
+import (
+	"errors"
+	"expvar"
+	"sync"
+	"testing"
+	"time"
+)
+
+func testLRUCache(ttl time.Duration, size int) (*lruCache, *expvar.Map) {
+	metrics := new(expvar.Map).Init()
+	return newLRUCache(ttl, size, metrics, "test"), metrics
+}
+
+func TestLRUCacheEviction(t *testing.T) {
+	c, metrics := testLRUCache(time.Hour, 2)
+	for _, key := range []string{"a", "b"} {
+		_, _, gen := c.get(key)
+		c.set(key, key, gen, time.Time{})
+	}
+	// reading a make b the least recently used entry
+	c.get("a")
+	_, _, gen := c.get("c")
+	c.set("c", "c", gen, time.Time{})
+
+	tests := []struct {
+		key  string
+		want bool
+	}{
+		{"a", true},
+		{"b", false},
+		{"c", true},
+	}
+	for _, tt := range tests {
+		if _, ok, _ := c.get(tt.key); ok != tt.want {
+			t.Errorf("key %s: got cached %t, want %t", tt.key, ok, tt.want)
+		}
+	}
+	if got := metrics.Get("test_evictions").String(); got != "1" {
+		t.Errorf("got %s evictions, want 1", got)
+	}
+}
+
+func TestLRUCacheExpiry(t *testing.T) {
+	tests := []struct {
+		name   string
+		ttl    time.Duration
+		expiry time.Time
+		want   bool
+	}{
+		{"ttl", time.Millisecond, time.Time{}, false},
+		{"expiry before ttl", time.Hour, time.Now().Add(time.Millisecond), false},
+		{"expiry after ttl", time.Millisecond, time.Now().Add(time.Hour), false},
+		{"not expired", time.Hour, time.Now().Add(time.Hour), true},
+	}
+	for _, tt := range tests {
+		c, _ := testLRUCache(tt.ttl, 10)
+		_, _, gen := c.get("key")
+		c.set("key", "value", gen, tt.expiry)
+		time.Sleep(5 * time.Millisecond)
+		if _, ok, _ := c.get("key"); ok != tt.want {
+			t.Errorf("%s: got cached %t, want %t", tt.name, ok, tt.want)
+		}
+	}
+}
+
+// TestLRUCacheGeneration check the values read before an invalidation are not stored after it, the values are set
+// concurrently to run the guard with the race detector
+func TestLRUCacheGeneration(t *testing.T) {
+	c, _ := testLRUCache(time.Hour, 10)
+	_, _, stale := c.get("key")
+	c.deleteFunc(func(v interface{}) bool { return v == "other" })
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c.set("key", "stale", stale, time.Time{})
+			c.delete("other")
+		}()
+	}
+	wg.Wait()
+	if _, ok, _ := c.get("key"); ok {
+		t.Fatal("got a value stored with the generation of before the invalidation")
+	}
+
+	_, _, gen := c.get("key")
+	c.set("key", "fresh", gen, time.Time{})
+	if v, ok, _ := c.get("key"); !ok || v != "fresh" {
+		t.Fatalf("got %v, want the value stored with the current generation", v)
+	}
+}
+
+func TestCachedUsersTokenExpiry(t *testing.T) {
+	models, _ := NewCachedModels(NewMemoryModels(), time.Hour, 10)
+	user := &User{Name: "Tom", Email: "tom@example.com", Activated: true}
+	user.Password.hashedPWD = []byte("not a hash")
+	err := models.Users.Insert(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := models.Tokens.New(user.ID, 50*time.Millisecond, ScopeAuthentication)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = models.Users.GetForToken(token.PlainToken, ScopeAuthentication)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the cached user expire with the token before the TTL
+	time.Sleep(100 * time.Millisecond)
+	_, err = models.Users.GetForToken(token.PlainToken, ScopeAuthentication)
+	if !errors.Is(err, ErrRecordNotFound) {
+		t.Fatalf("got %v reading the user of an expired token, want ErrRecordNotFound", err)
+	}
+}
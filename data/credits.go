@@ -0,0 +1,187 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/eze8789/movies-api/validator"
+	"github.com/lib/pq"
+)
+
+const (
+	RoleActor    = "actor"
+	RoleDirector = "director"
+	RoleWriter   = "writer"
+)
+
+// Credit link a person to a movie, the movie or person details are only filled depending on
+// the side the credit is read from
+type Credit struct {
+	ID           int64  `json:"id"`
+	MovieID      int64  `json:"movie_id"`
+	PersonID     int64  `json:"person_id"`
+	PersonName   string `json:"person_name,omitempty"`
+	MovieTitle   string `json:"movie_title,omitempty"`
+	MovieYear    int32  `json:"movie_year,omitempty"`
+	Role         string `json:"role"`
+	Character    string `json:"character,omitempty"`
+	BillingOrder int32  `json:"billing_order"`
+}
+
+type CreditModel struct {
+	*sql.DB
+}
+
+func ValidateCredit(v *validator.Validator, credit *Credit) {
+	v.Check(credit.PersonID > 0, "person_id", "must be provided")
+
+	v.Check(credit.Role != "", "role", "must be provided")
+	v.Check(v.In(credit.Role, RoleActor, RoleDirector, RoleWriter), "role", "must be actor, director or writer")
+
+	v.Check(len(credit.Character) <= 500, "character", "must not be more than 500 bytes long") //nolint:gomnd
+	v.Check(credit.Character == "" || credit.Role == RoleActor, "character", "only actors can play a character")
+
+	v.Check(credit.BillingOrder >= 0, "billing_order", "must be a positive integer")
+}
+
+func (cm *CreditModel) Insert(credit *Credit) error {
+	stmt := `INSERT INTO credits (movie_id, person_id, role, character, billing_order)
+	VALUES ($1, $2, $3, $4, $5)
+	RETURNING id`
+	args := []interface{}{credit.MovieID, credit.PersonID, credit.Role, credit.Character, credit.BillingOrder}
+
+	ctx, cancel := context.WithTimeout(context.Background(), QueryTimeOut*time.Second)
+	defer cancel()
+
+	return cm.DB.QueryRowContext(ctx, stmt, args...).Scan(&credit.ID)
+}
+
+// GetForMovie return the cast and crew of a movie sorted by billing order
+func (cm *CreditModel) GetForMovie(movieID int64) ([]*Credit, error) {
+	stmt := `SELECT credits.id, credits.movie_id, credits.person_id, people.name, credits.role,
+	credits.character, credits.billing_order
+	FROM credits
+	INNER JOIN people ON people.id = credits.person_id
+	WHERE credits.movie_id = $1
+	ORDER BY credits.billing_order, credits.id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), QueryTimeOut*time.Second)
+	defer cancel()
+
+	rows, err := cm.DB.QueryContext(ctx, stmt, movieID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	credits := []*Credit{}
+	for rows.Next() {
+		var c Credit
+		err = rows.Scan(&c.ID, &c.MovieID, &c.PersonID, &c.PersonName, &c.Role, &c.Character, &c.BillingOrder)
+		if err != nil {
+			return nil, err
+		}
+		credits = append(credits, &c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return credits, nil
+}
+
+// GetForMovies return the cast and crew of several movies grouped by movie, used to embed the credits in lists
+func (cm *CreditModel) GetForMovies(movieIDs []int64) (map[int64][]*Credit, error) {
+	stmt := `SELECT credits.id, credits.movie_id, credits.person_id, people.name, credits.role,
+	credits.character, credits.billing_order
+	FROM credits
+	INNER JOIN people ON people.id = credits.person_id
+	WHERE credits.movie_id = ANY($1)
+	ORDER BY credits.movie_id, credits.billing_order, credits.id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), QueryTimeOut*time.Second)
+	defer cancel()
+
+	rows, err := cm.DB.QueryContext(ctx, stmt, pq.Array(movieIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	credits := make(map[int64][]*Credit, len(movieIDs))
+	for rows.Next() {
+		var c Credit
+		err = rows.Scan(&c.ID, &c.MovieID, &c.PersonID, &c.PersonName, &c.Role, &c.Character, &c.BillingOrder)
+		if err != nil {
+			return nil, err
+		}
+		credits[c.MovieID] = append(credits[c.MovieID], &c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return credits, nil
+}
+
+// GetForPerson return the filmography of a person sorted from the newest movie, roles can be used
+// to only return the credits for some roles
+func (cm *CreditModel) GetForPerson(personID int64, roles []string) ([]*Credit, error) {
+	stmt := `SELECT credits.id, credits.movie_id, credits.person_id, movies.title, movies.year, credits.role,
+	credits.character, credits.billing_order
+	FROM credits
+	INNER JOIN movies ON movies.id = credits.movie_id
+	WHERE credits.person_id = $1 AND movies.deleted_at IS NULL
+	AND (credits.role = ANY($2) OR $2 = '{}')
+	ORDER BY movies.year DESC, movies.id, credits.billing_order`
+	args := []interface{}{personID, pq.Array(roles)}
+
+	ctx, cancel := context.WithTimeout(context.Background(), QueryTimeOut*time.Second)
+	defer cancel()
+
+	rows, err := cm.DB.QueryContext(ctx, stmt, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	credits := []*Credit{}
+	for rows.Next() {
+		var c Credit
+		err = rows.Scan(&c.ID, &c.MovieID, &c.PersonID, &c.MovieTitle, &c.MovieYear, &c.Role,
+			&c.Character, &c.BillingOrder)
+		if err != nil {
+			return nil, err
+		}
+		credits = append(credits, &c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return credits, nil
+}
+
+// Delete remove a credit from a movie
+func (cm *CreditModel) Delete(movieID, id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	stmt := `DELETE FROM credits WHERE id = $1 AND movie_id = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), QueryTimeOut*time.Second)
+	defer cancel()
+
+	r, err := cm.DB.ExecContext(ctx, stmt, id, movieID)
+	if err != nil {
+		return err
+	}
+
+	rows, err := r.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+package data
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+// MovieFacets hold the facets that can be counted over the movies listed
+var MovieFacets = []string{"genres", "decade", "runtime_bucket"}
+
+// RuntimeBucket is a range of runtimes in minutes used by the runtime_bucket facet, Max is not included
+type RuntimeBucket struct {
+	Name string
+	Min  int32
+	Max  int32
+}
+
+// RuntimeBuckets hold the runtime ranges in ascending order
+var RuntimeBuckets = []RuntimeBucket{
+	{Name: "0-89", Min: 0, Max: 90},
+	{Name: "90-119", Min: 90, Max: 120},
+	{Name: "120-149", Min: 120, Max: 150},
+	{Name: "150+", Min: 150, Max: math.MaxInt32},
+}
+
+// FacetCount hold the amount of movies listed with a facet value
+type FacetCount struct {
+	Value string `json:"value"`
+	Count int    `json:"count"`
+}
+
+// RuntimeBucketNames return the name of every runtime bucket
+func RuntimeBucketNames() []string {
+	names := make([]string, 0, len(RuntimeBuckets))
+	for _, b := range RuntimeBuckets {
+		names = append(names, b.Name)
+	}
+	return names
+}
+
+// runtimeBucket return the bucket with the given name, an empty bucket that does not filter is returned for
+// unknown names
+func runtimeBucket(name string) RuntimeBucket {
+	for _, b := range RuntimeBuckets {
+		if b.Name == name {
+			return b
+		}
+	}
+	return RuntimeBucket{}
+}
+
+// facetExpressions return the SQL expression grouped to count each facet
+func facetExpressions() map[string]string {
+	bucket := "CASE"
+	for _, b := range RuntimeBuckets[:len(RuntimeBuckets)-1] {
+		bucket += fmt.Sprintf(" WHEN runtime < %d THEN '%s'", b.Max, b.Name)
+	}
+	bucket += fmt.Sprintf(" ELSE '%s' END", RuntimeBuckets[len(RuntimeBuckets)-1].Name)
+
+	return map[string]string{
+		"genres":         "unnest(genres)",
+		"decade":         "(year / 10 * 10)::text",
+		"runtime_bucket": bucket,
+	}
+}
+
+// GetFacets count the movies matching the same filters used by GetAll for every value of the requested facets.
+// fuzzy must be set when GetAll used the trigram search. The genres are filtered with the GIN index and the
+// counts of all the facets are calculated in a single query.
+//
+//nolint:gosec
+func (m *MovieModel) GetFacets(title string, genres []string, personID int64, fuzzy bool,
+	filters Filters) (map[string][]FacetCount, error) {
+	facets := make(map[string][]FacetCount, len(filters.Facets))
+	var b whereBuilder
+	movieConditions(&b, title, fuzzy, genres, personID, filters)
+	expressions := facetExpressions()
+	queries := []string{}
+	for _, f := range filters.Facets {
+		expression, ok := expressions[f]
+		if _, seen := facets[f]; seen || !ok {
+			continue
+		}
+		facets[f] = []FacetCount{}
+		queries = append(queries, fmt.Sprintf(`SELECT '%s' AS facet, value, count(*) AS total
+		FROM (SELECT %s AS value FROM movies WHERE %s) AS facet_values
+		GROUP BY value`, f, expression, b.String()))
+	}
+	if len(queries) == 0 {
+		return facets, nil
+	}
+	stmt := strings.Join(queries, "\nUNION ALL\n") + "\nORDER BY facet, total DESC, value"
+
+	ctx, cancel := context.WithTimeout(context.Background(), QueryTimeOut*time.Second)
+	defer cancel()
+
+	r, err := m.DB.QueryContext(ctx, stmt, b.args...)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	for r.Next() {
+		var facet string
+		var fc FacetCount
+		err := r.Scan(&facet, &fc.Value, &fc.Count)
+		if err != nil {
+			return nil, err
+		}
+		facets[facet] = append(facets[facet], fc)
+	}
+	if err := r.Err(); err != nil {
+		return nil, err
+	}
+	return facets, nil
+}
@@ -1,8 +1,13 @@
 package data
 
 import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
 	"math"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/eze8789/movies-api/validator"
 )
@@ -12,24 +17,88 @@ type Filters struct {
 	PageSize int
 	Sort     string
 	SortSafe []string
+	// Cursor enables keyset pagination when CursorMode is set, an empty Cursor starts from the first row
+	Cursor     string
+	CursorMode bool
+	SkipCount  bool
+	// Fields is the sparse fieldset requested, every field is returned when it is empty
+	Fields     []string
+	FieldsSafe []string
+	// Facets hold the facets to count, Decade and RuntimeBucket filter by a facet value when they are set
+	Facets        []string
+	Decade        int
+	RuntimeBucket string
+	// the ranges are only applied when the values are set, GenresMode select how the genres are matched
+	YearMin       int
+	YearMax       int
+	RuntimeMin    int
+	RuntimeMax    int
+	CreatedAfter  time.Time
+	CreatedBefore time.Time
+	GenresMode    string
 }
 
 type Metadata struct {
-	CurrentPage  int `json:"current_page,omitempty"`
-	PageSize     int `json:"page_size,omitempty"`
-	FirstPage    int `json:"first_page,omitempty"`
-	LastPage     int `json:"last_page,omitempty"`
-	TotalRecords int `json:"total_records,omitempty"`
+	CurrentPage  int    `json:"current_page,omitempty"`
+	PageSize     int    `json:"page_size,omitempty"`
+	FirstPage    int    `json:"first_page,omitempty"`
+	LastPage     int    `json:"last_page,omitempty"`
+	TotalRecords int    `json:"total_records,omitempty"`
+	NextCursor   string `json:"next_cursor,omitempty"`
+	Fuzzy        bool   `json:"fuzzy,omitempty"`
+}
+
+// cursor hold the position of the last row returned, the value of the sort column
+// and the id used as tie-breaker
+type cursor struct {
+	Sort  string `json:"s"`
+	Value string `json:"v"`
+	ID    int64  `json:"id"`
 }
 
 func ValidateFilter(v *validator.Validator, f Filters) {
-	v.Check(f.Page > 0, "page", "page needs to be greater than 0")
-	v.Check(f.Page <= 1000, "page", "page needs to be lower than 1000") //nolint:gomnd
+	if f.CursorMode {
+		if f.Cursor != "" {
+			c, err := decodeCursor(f.Cursor)
+			v.Check(err == nil, "cursor", "invalid cursor value")
+			v.Check(err != nil || c.Sort == f.Sort, "cursor", "cursor does not match the sort value")
+			v.Check(err != nil || c.validValue(f.sortColumn()), "cursor", "invalid cursor value")
+		}
+	} else {
+		v.Check(f.Page > 0, "page", "page needs to be greater than 0")
+		v.Check(f.Page <= 1000, "page", "page needs to be lower than 1000") //nolint:gomnd
+	}
 
 	v.Check(f.PageSize >= 1, "page_size", "page_size can not be less than 1")
 	v.Check(f.PageSize <= 100, "page_size", "page_size can not be greater than 100") //nolint:gomnd
 
 	v.Check(v.In(f.Sort, f.SortSafe...), "sort", "invalid sort value")
+
+	ValidateSafe(v, "fields", f.Fields, f.FieldsSafe)
+	ValidateSafe(v, "facets", f.Facets, MovieFacets)
+
+	v.Check(f.Decade == 0 || (f.Decade >= 1900 && f.Decade%10 == 0), "decade", "must be a decade like 1990") //nolint:gomnd
+	v.Check(f.RuntimeBucket == "" || v.In(f.RuntimeBucket, RuntimeBucketNames()...), "runtime_bucket",
+		fmt.Sprintf("must be one of %s", strings.Join(RuntimeBucketNames(), ", ")))
+
+	v.Check(f.YearMin >= 0, "year_min", "must be a positive integer")
+	v.Check(f.YearMax >= 0, "year_max", "must be a positive integer")
+	v.Check(f.YearMin == 0 || f.YearMax == 0 || f.YearMin <= f.YearMax, "year_min", "must be less or equal than year_max")
+	v.Check(f.RuntimeMin >= 0, "runtime_min", "must be a positive integer")
+	v.Check(f.RuntimeMax >= 0, "runtime_max", "must be a positive integer")
+	v.Check(f.RuntimeMin == 0 || f.RuntimeMax == 0 || f.RuntimeMin <= f.RuntimeMax, "runtime_min",
+		"must be less or equal than runtime_max")
+	v.Check(f.CreatedAfter.IsZero() || f.CreatedBefore.IsZero() || f.CreatedAfter.Before(f.CreatedBefore),
+		"created_after", "must be before created_before")
+	v.Check(f.GenresMode == "" || v.In(f.GenresMode, GenresAll, GenresAny, GenresNone), "genres_mode",
+		"must be all, any or none")
+}
+
+// ValidateSafe check every value of a multi-value parameter like fields or include is in the safe values
+func ValidateSafe(v *validator.Validator, key string, values, safe []string) {
+	for _, val := range values {
+		v.Check(v.In(val, safe...), key, fmt.Sprintf("invalid %s value: %s", key, val))
+	}
 }
 
 //nolint:gocritic
@@ -47,13 +116,25 @@ func (f Filters) sortColumn() string {
 	return s[1]
 }
 
+// sortDirection return the order for the sort column, relevance is always sorted from the best match
 func (f Filters) sortDirection() string {
+	if f.sortColumn() == "relevance" {
+		return "DESC"
+	}
 	if strings.HasPrefix(f.Sort, "-") {
 		return "DESC"
 	}
 	return "ASC"
 }
 
+// keysetOperator return the comparison used to fetch the rows after the cursor
+func (f Filters) keysetOperator() string {
+	if f.sortDirection() == "DESC" {
+		return "<"
+	}
+	return ">"
+}
+
 func (f Filters) limit() int {
 	return f.PageSize
 }
@@ -62,6 +143,41 @@ func (f Filters) offset() int {
 	return (f.Page - 1) * f.PageSize
 }
 
+// validValue check the value can be compared with the sort column, the id column use the id of the cursor
+func (c *cursor) validValue(column string) bool {
+	var err error
+	switch column {
+	case "year", "runtime":
+		_, err = strconv.ParseInt(c.Value, 10, 32)
+	case "rating", "relevance":
+		_, err = strconv.ParseFloat(c.Value, 32)
+	}
+	return err == nil
+}
+
+// encodeCursor return an opaque cursor pointing to the given sort value and id
+func encodeCursor(sort, value string, id int64) string {
+	b, err := json.Marshal(cursor{Sort: sort, Value: value, ID: id})
+	if err != nil {
+		return ""
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeCursor(s string) (*cursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+
+	var c cursor
+	err = json.Unmarshal(b, &c)
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
 func calcMetadata(totalRecords, page, pageSize int) Metadata {
 	if totalRecords == 0 {
 		return Metadata{}
@@ -74,3 +190,12 @@ func calcMetadata(totalRecords, page, pageSize int) Metadata {
 		TotalRecords: totalRecords,
 	}
 }
+
+// calcCursorMetadata return metadata for keyset pagination, totalRecords is omitted when the count was skipped
+func calcCursorMetadata(totalRecords, pageSize int, nextCursor string) Metadata {
+	return Metadata{
+		PageSize:     pageSize,
+		TotalRecords: totalRecords,
+		NextCursor:   nextCursor,
+	}
+}
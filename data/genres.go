@@ -0,0 +1,392 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/eze8789/movies-api/validator"
+	"github.com/lib/pq"
+)
+
+const ErrGenreSlugConstraint = `pq: duplicate key value violates unique constraint "genres_slug_key"`
+
+var (
+	SlugRX         = regexp.MustCompile("^[a-z0-9]+(-[a-z0-9]+)*$")
+	nonSlugCharsRX = regexp.MustCompile("[^a-z0-9]+")
+)
+
+// Genre is an entry of the genres catalogue, movies store the slug and the name and aliases are normalized to it
+type Genre struct {
+	ID        int64     `json:"id"`
+	CreatedAt time.Time `json:"-"`
+	Slug      string    `json:"slug"`
+	Name      string    `json:"name"`
+	Aliases   []string  `json:"aliases"`
+	Version   int32     `json:"version"`
+}
+
+// defaultGenres is the catalogue created by the migrations, the in-memory backend start with it
+var defaultGenres = []Genre{
+	{Slug: "action", Name: "Action", Aliases: []string{}},
+	{Slug: "adventure", Name: "Adventure", Aliases: []string{}},
+	{Slug: "animation", Name: "Animation", Aliases: []string{"animated"}},
+	{Slug: "comedy", Name: "Comedy", Aliases: []string{}},
+	{Slug: "crime", Name: "Crime", Aliases: []string{}},
+	{Slug: "documentary", Name: "Documentary", Aliases: []string{"doc"}},
+	{Slug: "drama", Name: "Drama", Aliases: []string{}},
+	{Slug: "family", Name: "Family", Aliases: []string{}},
+	{Slug: "fantasy", Name: "Fantasy", Aliases: []string{}},
+	{Slug: "history", Name: "History", Aliases: []string{"historical"}},
+	{Slug: "horror", Name: "Horror", Aliases: []string{}},
+	{Slug: "music", Name: "Music", Aliases: []string{"musical"}},
+	{Slug: "mystery", Name: "Mystery", Aliases: []string{}},
+	{Slug: "romance", Name: "Romance", Aliases: []string{"romantic"}},
+	{Slug: "sci-fi", Name: "Sci-Fi", Aliases: []string{"science fiction", "science-fiction", "scifi"}},
+	{Slug: "thriller", Name: "Thriller", Aliases: []string{}},
+	{Slug: "war", Name: "War", Aliases: []string{}},
+	{Slug: "western", Name: "Western", Aliases: []string{}},
+}
+
+type GenreModel struct {
+	*sql.DB
+}
+
+// GenreIndex normalize the genres sent by the clients to the slugs of the catalogue
+type GenreIndex map[string]string
+
+// Slugify return the slug for a genre name, the same rules are used to backfill the catalogue
+func Slugify(s string) string {
+	return strings.Trim(nonSlugCharsRX.ReplaceAllString(strings.ToLower(strings.TrimSpace(s)), "-"), "-")
+}
+
+func ValidateGenre(v *validator.Validator, genre *Genre) {
+	v.Check(genre.Slug != "", "slug", "must be provided")
+	v.Check(validator.Matches(genre.Slug, SlugRX), "slug", "must only contain lowercase letters, numbers and dashes")
+	v.Check(len(genre.Slug) <= 100, "slug", "must not be more than 100 bytes long") //nolint:gomnd
+
+	v.Check(genre.Name != "", "name", "must be provided")
+	v.Check(len(genre.Name) <= 100, "name", "must not be more than 100 bytes long") //nolint:gomnd
+
+	aliases := genre.normalizeAliases()
+	v.Check(v.Unique(aliases), "aliases", "aliases must be unique")
+	v.Check(len(aliases) <= 20, "aliases", "must not contain more than 20 aliases") //nolint:gomnd
+	for _, a := range aliases {
+		v.Check(a != "", "aliases", "aliases can not be empty")
+		v.Check(a != genre.Slug, "aliases", "aliases can not be the slug")
+	}
+}
+
+// normalizeAliases store the aliases in lowercase, they are compared ignoring case
+func (g *Genre) normalizeAliases() []string {
+	aliases := make([]string, 0, len(g.Aliases))
+	for _, a := range g.Aliases {
+		aliases = append(aliases, strings.ToLower(strings.TrimSpace(a)))
+	}
+	return aliases
+}
+
+// MergeAliases add the slug, name and aliases of another genre to the aliases of the genre, the aliases are
+// validated with ValidateGenre before the genres are merged
+func (g *Genre) MergeAliases(other *Genre) {
+	aliases := []string{}
+	for _, a := range append(append(g.normalizeAliases(), other.Slug, strings.ToLower(other.Name)), other.normalizeAliases()...) {
+		if a != g.Slug && !containsString(aliases, a) {
+			aliases = append(aliases, a)
+		}
+	}
+	g.Aliases = aliases
+}
+
+// replaceGenre return the genres of a movie with the slug from replaced by to, the genre is only kept once
+func replaceGenre(genres []string, from, to string) []string {
+	replaced := []string{}
+	for _, g := range genres {
+		if g == from {
+			g = to
+		}
+		if !containsString(replaced, g) {
+			replaced = append(replaced, g)
+		}
+	}
+	return replaced
+}
+
+// Normalize return the slugs of the genres and the genres that are not part of the catalogue, duplicated
+// genres are removed keeping the first one
+func (gi GenreIndex) Normalize(genres []string) (slugs, unknown []string) {
+	seen := make(map[string]bool, len(genres))
+	for _, g := range genres {
+		slug, ok := gi[strings.ToLower(strings.TrimSpace(g))]
+		if !ok {
+			unknown = append(unknown, g)
+			continue
+		}
+		if !seen[slug] {
+			seen[slug] = true
+			slugs = append(slugs, slug)
+		}
+	}
+	return slugs, unknown
+}
+
+// Index return the catalogue indexed by slug, name and aliases
+func (gm *GenreModel) Index() (GenreIndex, error) {
+	genres, err := gm.GetAll()
+	if err != nil {
+		return nil, err
+	}
+	return indexGenres(genres), nil
+}
+
+// indexGenres index the genres by slug, name and aliases
+func indexGenres(genres []*Genre) GenreIndex {
+	index := make(GenreIndex)
+	for _, g := range genres {
+		index[strings.ToLower(g.Name)] = g.Slug
+		for _, a := range g.Aliases {
+			index[a] = g.Slug
+		}
+	}
+	// the slugs are added last so they win over a name or alias with the same value
+	for _, g := range genres {
+		index[g.Slug] = g.Slug
+	}
+	return index
+}
+
+// aliasTaken report if the slug, name or aliases of a genre are already used by another genre
+func (gm *GenreModel) aliasTaken(genre *Genre) (bool, error) {
+	stmt := `SELECT EXISTS (
+		SELECT 1 FROM genres
+		WHERE id <> $1 AND (slug = ANY($2) OR lower(name) = ANY($2) OR aliases && $2))`
+	values := append(genre.normalizeAliases(), genre.Slug, strings.ToLower(genre.Name))
+
+	ctx, cancel := context.WithTimeout(context.Background(), QueryTimeOut*time.Second)
+	defer cancel()
+
+	var taken bool
+	err := gm.DB.QueryRowContext(ctx, stmt, genre.ID, pq.Array(values)).Scan(&taken)
+	return taken, err
+}
+
+// Insert add a genre to the catalogue, ErrDuplicatedGenre is returned when the slug, name or an alias
+// is used by another genre
+func (gm *GenreModel) Insert(genre *Genre) error {
+	taken, err := gm.aliasTaken(genre)
+	if err != nil {
+		return err
+	}
+	if taken {
+		return ErrDuplicatedGenre
+	}
+
+	stmt := `INSERT INTO genres (slug, name, aliases)
+	VALUES ($1, $2, $3)
+	RETURNING id, created_at, version`
+	genre.Aliases = genre.normalizeAliases()
+	args := []interface{}{genre.Slug, genre.Name, pq.Array(genre.Aliases)}
+
+	ctx, cancel := context.WithTimeout(context.Background(), QueryTimeOut*time.Second)
+	defer cancel()
+
+	err = gm.DB.QueryRowContext(ctx, stmt, args...).Scan(&genre.ID, &genre.CreatedAt, &genre.Version)
+	if err != nil {
+		switch {
+		case err.Error() == ErrGenreSlugConstraint:
+			return ErrDuplicatedGenre
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+// GetAll return the whole catalogue sorted by name
+func (gm *GenreModel) GetAll() ([]*Genre, error) {
+	stmt := `SELECT id, created_at, slug, name, aliases, version
+	FROM genres
+	ORDER BY name, id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), QueryTimeOut*time.Second)
+	defer cancel()
+
+	rows, err := gm.DB.QueryContext(ctx, stmt)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	genres := []*Genre{}
+	for rows.Next() {
+		var g Genre
+		err = rows.Scan(&g.ID, &g.CreatedAt, &g.Slug, &g.Name, pq.Array(&g.Aliases), &g.Version)
+		if err != nil {
+			return nil, err
+		}
+		genres = append(genres, &g)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return genres, nil
+}
+
+func (gm *GenreModel) Get(id int64) (*Genre, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+	stmt := `SELECT id, created_at, slug, name, aliases, version
+	FROM genres
+	WHERE id = $1`
+
+	var g Genre
+
+	ctx, cancel := context.WithTimeout(context.Background(), QueryTimeOut*time.Second)
+	defer cancel()
+
+	err := gm.DB.QueryRowContext(ctx, stmt, id).Scan(&g.ID, &g.CreatedAt, &g.Slug, &g.Name, pq.Array(&g.Aliases),
+		&g.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &g, nil
+}
+
+// Update change the name and aliases of a genre, the slug can not be changed because the movies store it
+func (gm *GenreModel) Update(genre *Genre) error {
+	taken, err := gm.aliasTaken(genre)
+	if err != nil {
+		return err
+	}
+	if taken {
+		return ErrDuplicatedGenre
+	}
+
+	stmt := `UPDATE genres
+	SET name = $1, aliases = $2, version = version + 1
+	WHERE id = $3 AND version = $4
+	RETURNING version`
+	genre.Aliases = genre.normalizeAliases()
+	args := []interface{}{genre.Name, pq.Array(genre.Aliases), genre.ID, genre.Version}
+
+	ctx, cancel := context.WithTimeout(context.Background(), QueryTimeOut*time.Second)
+	defer cancel()
+
+	err = gm.DB.QueryRowContext(ctx, stmt, args...).Scan(&genre.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+// Delete remove a genre from the catalogue, ErrGenreInUse is returned while a movie use it, including the
+// movies in the trash
+func (gm *GenreModel) Delete(id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+	stmt := `DELETE FROM genres
+	WHERE id = $1 AND NOT EXISTS (SELECT 1 FROM movies WHERE movies.genres @> ARRAY[genres.slug])`
+
+	ctx, cancel := context.WithTimeout(context.Background(), QueryTimeOut*time.Second)
+	defer cancel()
+
+	r, err := gm.DB.ExecContext(ctx, stmt, id)
+	if err != nil {
+		return err
+	}
+
+	rows, err := r.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		// the genre does not exist or it is used by a movie
+		_, err = gm.Get(id)
+		if err != nil {
+			return err
+		}
+		return ErrGenreInUse
+	}
+	return nil
+}
+
+// Merge move the movies of source to the genre and delete source, the aliases of the genre are stored as they are
+// so MergeAliases must be called first. The movies changed get a new version and the amount is returned,
+// ErrEditConflict is returned when any genre changed after it was read.
+func (gm *GenreModel) Merge(genre, source *Genre, userID int64) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), QueryTimeOut*time.Second)
+	defer cancel()
+
+	tx, err := gm.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback() //nolint:errcheck
+
+	// the source is deleted first so the genre can take its slug, name and aliases
+	r, err := tx.ExecContext(ctx, `DELETE FROM genres WHERE id = $1 AND version = $2`, source.ID, source.Version)
+	if err != nil {
+		return 0, err
+	}
+	rows, err := r.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	if rows == 0 {
+		return 0, ErrEditConflict
+	}
+
+	stmt := `
+	WITH merged AS (
+		UPDATE movies SET genres = ARRAY(
+			SELECT slug FROM (
+				SELECT CASE WHEN g = $2::text THEN $1::text ELSE g END AS slug, min(ord) AS ord
+				FROM unnest(movies.genres) WITH ORDINALITY AS t(g, ord)
+				GROUP BY 1
+			) AS normalized
+			ORDER BY ord
+		), version = version + 1
+		WHERE genres @> ARRAY[$2]::text[]
+		RETURNING id, version, title, year, runtime, genres
+	)
+	INSERT INTO movie_revisions (movie_id, version, action, user_id, title, year, runtime, genres)
+	SELECT id, version, 'update', NULLIF($3::bigint, 0), title, year, runtime, genres FROM merged`
+	r, err = tx.ExecContext(ctx, stmt, genre.Slug, source.Slug, userID)
+	if err != nil {
+		return 0, err
+	}
+	movies, err := r.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	stmt = `UPDATE genres
+	SET aliases = $1, version = version + 1
+	WHERE id = $2 AND version = $3
+	RETURNING version`
+	err = tx.QueryRowContext(ctx, stmt, pq.Array(genre.Aliases), genre.ID, genre.Version).Scan(&genre.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return 0, ErrEditConflict
+		default:
+			return 0, err
+		}
+	}
+	return movies, tx.Commit()
+}
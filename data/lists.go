@@ -0,0 +1,337 @@
+package data
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base32"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/eze8789/movies-api/validator"
+	"github.com/lib/pq"
+)
+
+const (
+	DefaultListName       = "watchlist"
+	ErrListNameConstraint = `pq: duplicate key value violates unique constraint "lists_user_id_name_key"`
+	ErrListItemConstraint = `pq: duplicate key value violates unique constraint "list_items_pkey"`
+)
+
+type List struct {
+	ID         int64       `json:"id"`
+	CreatedAt  time.Time   `json:"created_at"`
+	UserID     int64       `json:"-"`
+	Name       string      `json:"name"`
+	Default    bool        `json:"default"`
+	Slug       *string     `json:"slug,omitempty"`
+	MovieCount int         `json:"movie_count"`
+	Movies     []*ListItem `json:"movies,omitempty"`
+	Version    int32       `json:"version"`
+}
+
+type ListItem struct {
+	MovieID   int64      `json:"movie_id"`
+	Title     string     `json:"title"`
+	Year      int32      `json:"year"`
+	Position  int32      `json:"position"`
+	AddedAt   time.Time  `json:"added_at"`
+	WatchedAt *time.Time `json:"watched_at,omitempty"`
+}
+
+type ListModel struct {
+	*sql.DB
+}
+
+// generateSlug return an unguessable slug to share a list publicly, generated like the tokens
+func generateSlug() (string, error) {
+	// read random bytes form CSPRNG from the OS
+	randomBytes := make([]byte, 16)
+	_, err := rand.Read(randomBytes)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.ToLower(base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(randomBytes)), nil
+}
+
+func ValidateList(v *validator.Validator, list *List) {
+	v.Check(list.Name != "", "name", "must be provided")
+	v.Check(list.Default || list.Name != DefaultListName, "name", "is reserved for the default list")
+	v.Check(len(list.Name) <= 100, "name", "must not be more than 100 bytes long") //nolint:gomnd
+}
+
+// SetPublic generate a share slug for the list or remove it to make the list private again
+func (l *List) SetPublic(public bool) error {
+	if !public {
+		l.Slug = nil
+		return nil
+	}
+	if l.Slug != nil {
+		return nil
+	}
+
+	slug, err := generateSlug()
+	if err != nil {
+		return err
+	}
+	l.Slug = &slug
+	return nil
+}
+
+// EnsureDefault create the default watchlist of a user if it does not exist yet
+func (lm *ListModel) EnsureDefault(userID int64) error {
+	stmt := `INSERT INTO lists (user_id, name, is_default)
+	VALUES ($1, $2, true)
+	ON CONFLICT DO NOTHING`
+
+	ctx, cancel := context.WithTimeout(context.Background(), QueryTimeOut*time.Second)
+	defer cancel()
+
+	_, err := lm.DB.ExecContext(ctx, stmt, userID, DefaultListName)
+	return err
+}
+
+func (lm *ListModel) Insert(list *List) error {
+	stmt := `INSERT INTO lists (user_id, name)
+	VALUES ($1, $2)
+	RETURNING id, created_at, version`
+	args := []interface{}{list.UserID, list.Name}
+
+	ctx, cancel := context.WithTimeout(context.Background(), QueryTimeOut*time.Second)
+	defer cancel()
+
+	err := lm.DB.QueryRowContext(ctx, stmt, args...).Scan(&list.ID, &list.CreatedAt, &list.Version)
+	if err != nil {
+		switch {
+		case err.Error() == ErrListNameConstraint:
+			return ErrDuplicatedListName
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+// GetAllForUser return the lists of a user with the amount of movies, the default list is returned first
+func (lm *ListModel) GetAllForUser(userID int64) ([]*List, error) {
+	stmt := `SELECT lists.id, lists.created_at, lists.user_id, lists.name, lists.is_default, lists.slug,
+	lists.version, count(movies.id)
+	FROM lists
+	LEFT JOIN list_items ON list_items.list_id = lists.id
+	LEFT JOIN movies ON movies.id = list_items.movie_id AND movies.deleted_at IS NULL
+	WHERE lists.user_id = $1
+	GROUP BY lists.id
+	ORDER BY lists.is_default DESC, lists.id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), QueryTimeOut*time.Second)
+	defer cancel()
+
+	rows, err := lm.DB.QueryContext(ctx, stmt, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	lists := []*List{}
+	for rows.Next() {
+		var l List
+		err = rows.Scan(&l.ID, &l.CreatedAt, &l.UserID, &l.Name, &l.Default, &l.Slug, &l.Version, &l.MovieCount)
+		if err != nil {
+			return nil, err
+		}
+		lists = append(lists, &l)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return lists, nil
+}
+
+// Get return a list owned by the user
+func (lm *ListModel) Get(id, userID int64) (*List, error) {
+	stmt := `SELECT lists.id, lists.created_at, lists.user_id, lists.name, lists.is_default, lists.slug,
+	lists.version, (SELECT count(*) FROM list_items INNER JOIN movies ON movies.id = list_items.movie_id
+		WHERE list_items.list_id = lists.id AND movies.deleted_at IS NULL)
+	FROM lists
+	WHERE lists.id = $1 AND lists.user_id = $2`
+
+	return lm.get(stmt, id, userID)
+}
+
+// GetBySlug return a list shared publicly
+func (lm *ListModel) GetBySlug(slug string) (*List, error) {
+	stmt := `SELECT lists.id, lists.created_at, lists.user_id, lists.name, lists.is_default, lists.slug,
+	lists.version, (SELECT count(*) FROM list_items INNER JOIN movies ON movies.id = list_items.movie_id
+		WHERE list_items.list_id = lists.id AND movies.deleted_at IS NULL)
+	FROM lists
+	WHERE lists.slug = $1`
+
+	return lm.get(stmt, slug)
+}
+
+func (lm *ListModel) get(stmt string, args ...interface{}) (*List, error) {
+	var l List
+
+	ctx, cancel := context.WithTimeout(context.Background(), QueryTimeOut*time.Second)
+	defer cancel()
+
+	err := lm.DB.QueryRowContext(ctx, stmt, args...).Scan(&l.ID, &l.CreatedAt, &l.UserID, &l.Name, &l.Default,
+		&l.Slug, &l.Version, &l.MovieCount)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &l, nil
+}
+
+func (lm *ListModel) Update(list *List) error {
+	stmt := `UPDATE lists
+	SET name = $1, slug = $2, version = version + 1
+	WHERE id = $3 AND user_id = $4 AND version = $5
+	RETURNING version`
+	args := []interface{}{list.Name, list.Slug, list.ID, list.UserID, list.Version}
+
+	ctx, cancel := context.WithTimeout(context.Background(), QueryTimeOut*time.Second)
+	defer cancel()
+
+	err := lm.DB.QueryRowContext(ctx, stmt, args...).Scan(&list.Version)
+	if err != nil {
+		switch {
+		case err.Error() == ErrListNameConstraint:
+			return ErrDuplicatedListName
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+// Delete remove a custom list of the user, the default list can not be removed
+func (lm *ListModel) Delete(id, userID int64) error {
+	stmt := `DELETE FROM lists WHERE id = $1 AND user_id = $2 AND NOT is_default`
+
+	ctx, cancel := context.WithTimeout(context.Background(), QueryTimeOut*time.Second)
+	defer cancel()
+
+	r, err := lm.DB.ExecContext(ctx, stmt, id, userID)
+	if err != nil {
+		return err
+	}
+
+	rows, err := r.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// GetItems return the movies of a list in the user defined order
+func (lm *ListModel) GetItems(listID int64) ([]*ListItem, error) {
+	stmt := `SELECT list_items.movie_id, movies.title, movies.year, list_items.position, list_items.added_at,
+	list_items.watched_at
+	FROM list_items
+	INNER JOIN movies ON movies.id = list_items.movie_id
+	WHERE list_items.list_id = $1 AND movies.deleted_at IS NULL
+	ORDER BY list_items.position, list_items.added_at`
+
+	ctx, cancel := context.WithTimeout(context.Background(), QueryTimeOut*time.Second)
+	defer cancel()
+
+	rows, err := lm.DB.QueryContext(ctx, stmt, listID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := []*ListItem{}
+	for rows.Next() {
+		var i ListItem
+		err = rows.Scan(&i.MovieID, &i.Title, &i.Year, &i.Position, &i.AddedAt, &i.WatchedAt)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, &i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// AddItem append a movie at the end of a list
+func (lm *ListModel) AddItem(listID, movieID int64) error {
+	stmt := `INSERT INTO list_items (list_id, movie_id, position)
+	SELECT $1, $2, COALESCE(MAX(position), 0) + 1 FROM list_items WHERE list_id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), QueryTimeOut*time.Second)
+	defer cancel()
+
+	_, err := lm.DB.ExecContext(ctx, stmt, listID, movieID)
+	if err != nil {
+		switch {
+		case err.Error() == ErrListItemConstraint:
+			return ErrDuplicatedListItem
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+// RemoveItem remove a movie from a list
+func (lm *ListModel) RemoveItem(listID, movieID int64) error {
+	stmt := `DELETE FROM list_items WHERE list_id = $1 AND movie_id = $2`
+
+	return lm.execItem(stmt, listID, movieID)
+}
+
+// SetWatched mark a movie of a list as watched at the given time, a nil time mark it as not watched
+func (lm *ListModel) SetWatched(listID, movieID int64, watchedAt *time.Time) error {
+	stmt := `UPDATE list_items SET watched_at = $3 WHERE list_id = $1 AND movie_id = $2`
+
+	return lm.execItem(stmt, listID, movieID, watchedAt)
+}
+
+func (lm *ListModel) execItem(stmt string, args ...interface{}) error {
+	ctx, cancel := context.WithTimeout(context.Background(), QueryTimeOut*time.Second)
+	defer cancel()
+
+	r, err := lm.DB.ExecContext(ctx, stmt, args...)
+	if err != nil {
+		return err
+	}
+
+	rows, err := r.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// Reorder set the position of the movies of a list following the order of movieIDs
+func (lm *ListModel) Reorder(listID int64, movieIDs []int64) error {
+	stmt := `UPDATE list_items
+	SET position = new_order.position
+	FROM unnest($2::bigint[]) WITH ORDINALITY AS new_order(movie_id, position)
+	WHERE list_items.list_id = $1 AND list_items.movie_id = new_order.movie_id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), QueryTimeOut*time.Second)
+	defer cancel()
+
+	_, err := lm.DB.ExecContext(ctx, stmt, listID, pq.Array(movieIDs))
+	return err
+}
@@ -0,0 +1,384 @@
+package data
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// memoryStore hold the data of the in-memory backend, every repository share the store so the movies can be
+// filtered by credits, the genres in use can be checked and the removals cascade like the database constraints
+type memoryStore struct {
+	mu          sync.RWMutex
+	sequences   map[string]int64
+	movies      map[int64]*Movie
+	posterKeys  map[int64]string
+	users       map[int64]*User
+	tokens      []*Token
+	permissions map[int64]Permissions
+	roles       map[int64]*Role
+	userRoles   map[int64][]int64
+	genres      map[int64]*Genre
+	credits     map[int64]*Credit
+	people      map[int64]*Person
+	reviews     map[int64]*Review
+	lists       map[int64]*List
+	listItems   map[int64][]*ListItem
+	revisions   []*Revision
+}
+
+// NewMemoryModels return repositories that keep the data in memory, the data is lost when the process exit.
+// It is meant to run the API without a database in development and integration tests.
+func NewMemoryModels() Models {
+	s := &memoryStore{
+		sequences:   make(map[string]int64),
+		movies:      make(map[int64]*Movie),
+		posterKeys:  make(map[int64]string),
+		users:       make(map[int64]*User),
+		permissions: make(map[int64]Permissions),
+		roles:       make(map[int64]*Role),
+		userRoles:   make(map[int64][]int64),
+		genres:      make(map[int64]*Genre),
+		credits:     make(map[int64]*Credit),
+		people:      make(map[int64]*Person),
+		reviews:     make(map[int64]*Review),
+		lists:       make(map[int64]*List),
+		listItems:   make(map[int64][]*ListItem),
+	}
+	// the roles created by the migrations
+	editor := &Role{ID: s.nextID("roles"), CreatedAt: time.Now().Truncate(time.Second), Name: "editor",
+		Permissions: Permissions{"movies:read", "movies:write"}, Version: 1}
+	s.roles[editor.ID] = editor
+	for i := range defaultGenres {
+		g := copyGenre(&defaultGenres[i])
+		g.ID, g.CreatedAt, g.Version = s.nextID("genres"), editor.CreatedAt, 1
+		s.genres[g.ID] = g
+	}
+
+	return Models{
+		Backend:     BackendMemory,
+		Movies:      &memoryMovies{s},
+		Users:       &memoryUsers{s},
+		Tokens:      &memoryTokens{s},
+		Permissions: &memoryPermissionsModel{s},
+		Roles:       &memoryRoles{s},
+		People:      &memoryPeople{s},
+		Credits:     &memoryCredits{s},
+		Reviews:     &memoryReviews{s},
+		Lists:       &memoryLists{s},
+		Revisions:   &memoryRevisions{s},
+		Genres:      &memoryGenres{s},
+	}
+}
+
+// nextID return a new id from the sequence of a resource like bigserial
+func (s *memoryStore) nextID(sequence string) int64 {
+	s.sequences[sequence]++
+	return s.sequences[sequence]
+}
+
+type memoryUsers struct {
+	*memoryStore
+}
+
+// emailTaken report if the email is used by another user, emails are compared ignoring case like citext
+func (mu *memoryUsers) emailTaken(user *User) bool {
+	for _, u := range mu.users {
+		if u.ID != user.ID && strings.EqualFold(u.Email, user.Email) {
+			return true
+		}
+	}
+	return false
+}
+
+func (mu *memoryUsers) Insert(user *User) error {
+	mu.mu.Lock()
+	defer mu.mu.Unlock()
+
+	if mu.emailTaken(user) {
+		return ErrDuplicatedEmail
+	}
+	user.ID = mu.nextID("users")
+	user.CreatedAT = time.Now().Truncate(time.Second)
+	user.Version = 1
+
+	u := *user
+	mu.users[u.ID] = &u
+	return nil
+}
+
+func (mu *memoryUsers) Update(user *User) error {
+	mu.mu.Lock()
+	defer mu.mu.Unlock()
+
+	stored, ok := mu.users[user.ID]
+	if !ok || stored.Version != user.Version {
+		return ErrEditConflict
+	}
+	if mu.emailTaken(user) {
+		return ErrDuplicatedEmail
+	}
+	user.Version++
+
+	u := *user
+	mu.users[u.ID] = &u
+	return nil
+}
+
+func (mu *memoryUsers) Get(id int64) (*User, error) {
+	mu.mu.RLock()
+	defer mu.mu.RUnlock()
+
+	u, ok := mu.users[id]
+	if !ok {
+		return nil, ErrRecordNotFound
+	}
+	user := *u
+	return &user, nil
+}
+
+func (mu *memoryUsers) GetByEmail(e string) (*User, error) {
+	mu.mu.RLock()
+	defer mu.mu.RUnlock()
+
+	for _, u := range mu.users {
+		if strings.EqualFold(u.Email, e) {
+			user := *u
+			return &user, nil
+		}
+	}
+	return nil, ErrRecordNotFound
+}
+
+func (mu *memoryUsers) GetForToken(token, scope string) (*User, error) {
+	tokenHash := sha256.Sum256([]byte(token))
+
+	mu.mu.RLock()
+	defer mu.mu.RUnlock()
+
+	now := time.Now()
+	for _, t := range mu.tokens {
+		if bytes.Equal(t.HashedToken, tokenHash[:]) && t.Scope == scope && t.Expiry.After(now) {
+			u, ok := mu.users[t.UserID]
+			if !ok {
+				break
+			}
+			user := *u
+			user.tokenExpiry = t.Expiry
+			return &user, nil
+		}
+	}
+	return nil, ErrRecordNotFound
+}
+
+// DeleteScheduledBefore remove the users and their tokens, permissions, roles, reviews and lists like the cascade
+// of the database backends, the revisions made by the users are kept without the user
+func (mu *memoryUsers) DeleteScheduledBefore(t time.Time) ([]int64, error) {
+	mu.mu.Lock()
+	defer mu.mu.Unlock()
+
+	ids := []int64{}
+	for id, u := range mu.users {
+		if u.DeleteAfter != nil && !u.DeleteAfter.After(t) {
+			ids = append(ids, id)
+			delete(mu.users, id)
+			delete(mu.permissions, id)
+			delete(mu.userRoles, id)
+		}
+	}
+
+	for id, r := range mu.reviews {
+		if _, ok := mu.users[r.UserID]; !ok {
+			delete(mu.reviews, id)
+			mu.aggregateRatings(r.MovieID)
+		}
+	}
+	for id, l := range mu.lists {
+		if _, ok := mu.users[l.UserID]; !ok {
+			delete(mu.lists, id)
+			delete(mu.listItems, id)
+		}
+	}
+	for _, r := range mu.revisions {
+		if r.UserID == nil {
+			continue
+		}
+		if _, ok := mu.users[*r.UserID]; !ok {
+			r.UserID = nil
+		}
+	}
+
+	tokens := mu.tokens[:0]
+	for _, tk := range mu.tokens {
+		if _, ok := mu.users[tk.UserID]; ok {
+			tokens = append(tokens, tk)
+		}
+	}
+	mu.tokens = tokens
+	return ids, nil
+}
+
+type memoryTokens struct {
+	*memoryStore
+}
+
+func (mt *memoryTokens) Insert(token *Token) error {
+	mt.mu.Lock()
+	defer mt.mu.Unlock()
+
+	if _, ok := mt.users[token.UserID]; !ok {
+		return ErrRecordNotFound
+	}
+	t := *token
+	mt.tokens = append(mt.tokens, &t)
+	return nil
+}
+
+func (mt *memoryTokens) New(userID int64, ttl time.Duration, scope string) (*Token, error) {
+	token, err := generateToken(userID, ttl, scope)
+	if err != nil {
+		return nil, err
+	}
+
+	err = mt.Insert(token)
+	return token, err
+}
+
+func (mt *memoryTokens) NewForEmail(userID int64, ttl time.Duration, scope, email string) (*Token, error) {
+	token, err := generateToken(userID, ttl, scope)
+	if err != nil {
+		return nil, err
+	}
+	token.Email = email
+
+	err = mt.Insert(token)
+	return token, err
+}
+
+func (mt *memoryTokens) Get(tokenPlain, scope string) (*Token, error) {
+	tokenHash := sha256.Sum256([]byte(tokenPlain))
+
+	mt.mu.RLock()
+	defer mt.mu.RUnlock()
+
+	now := time.Now()
+	for _, t := range mt.tokens {
+		if bytes.Equal(t.HashedToken, tokenHash[:]) && t.Scope == scope && t.Expiry.After(now) {
+			token := *t
+			return &token, nil
+		}
+	}
+	return nil, ErrRecordNotFound
+}
+
+func (mt *memoryTokens) GetAllForUser(userID int64) ([]*Token, error) {
+	mt.mu.RLock()
+	defer mt.mu.RUnlock()
+
+	now := time.Now()
+	tokens := []*Token{}
+	for _, t := range mt.tokens {
+		if t.UserID == userID && t.Expiry.After(now) {
+			token := *t
+			tokens = append(tokens, &token)
+		}
+	}
+	sort.Slice(tokens, func(i, j int) bool { return tokens[i].Expiry.After(tokens[j].Expiry) })
+	return tokens, nil
+}
+
+func (mt *memoryTokens) DeleteAllForUser(userID int64) error {
+	mt.mu.Lock()
+	defer mt.mu.Unlock()
+
+	tokens := mt.tokens[:0]
+	for _, t := range mt.tokens {
+		if t.UserID != userID {
+			tokens = append(tokens, t)
+		}
+	}
+	mt.tokens = tokens
+	return nil
+}
+
+func (mt *memoryTokens) DeleteAllByUser(userID int64, scope string) error {
+	mt.mu.Lock()
+	defer mt.mu.Unlock()
+
+	tokens := mt.tokens[:0]
+	for _, t := range mt.tokens {
+		if t.UserID != userID || t.Scope != scope {
+			tokens = append(tokens, t)
+		}
+	}
+	mt.tokens = tokens
+	return nil
+}
+
+type memoryPermissionsModel struct {
+	*memoryStore
+}
+
+func (mp *memoryPermissionsModel) GetAll() (Permissions, error) {
+	perms := append(Permissions{}, PermissionCodes...)
+	sort.Strings(perms)
+	return perms, nil
+}
+
+func (mp *memoryPermissionsModel) GetAllForUser(id int64) (Permissions, error) {
+	mp.mu.RLock()
+	defer mp.mu.RUnlock()
+
+	perms := append(Permissions{}, mp.permissions[id]...)
+	for _, roleID := range mp.userRoles[id] {
+		for _, p := range mp.roles[roleID].Permissions {
+			if !perms.Include(p) {
+				perms = append(perms, p)
+			}
+		}
+	}
+	sort.Strings(perms)
+	return perms, nil
+}
+
+func (mp *memoryPermissionsModel) GetGrantedForUser(id int64) (Permissions, error) {
+	mp.mu.RLock()
+	defer mp.mu.RUnlock()
+
+	perms := append(Permissions{}, mp.permissions[id]...)
+	sort.Strings(perms)
+	return perms, nil
+}
+
+func (mp *memoryPermissionsModel) AddForUser(id int64, perms ...string) error {
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+
+	if _, ok := mp.users[id]; !ok {
+		return ErrRecordNotFound
+	}
+	// unknown codes are ignored like the Postgres backend does
+	for _, p := range perms {
+		if containsString(PermissionCodes, p) && !mp.permissions[id].Include(p) {
+			mp.permissions[id] = append(mp.permissions[id], p)
+		}
+	}
+	return nil
+}
+
+func (mp *memoryPermissionsModel) RemoveForUser(id int64, perms ...string) error {
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+
+	kept := Permissions{}
+	for _, p := range mp.permissions[id] {
+		if !containsString(perms, p) {
+			kept = append(kept, p)
+		}
+	}
+	mp.permissions[id] = kept
+	return nil
+}
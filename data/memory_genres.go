@@ -0,0 +1,256 @@
+package data
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+type memoryGenres struct {
+	*memoryStore
+}
+
+func copyGenre(g *Genre) *Genre {
+	c := *g
+	c.Aliases = append([]string{}, g.Aliases...)
+	return &c
+}
+
+func (mg *memoryGenres) Index() (GenreIndex, error) {
+	genres, err := mg.GetAll()
+	if err != nil {
+		return nil, err
+	}
+	return indexGenres(genres), nil
+}
+
+// aliasTaken report if the slug, name or aliases of a genre are already used by another genre
+func (mg *memoryGenres) aliasTaken(genre *Genre) bool {
+	values := append(genre.normalizeAliases(), genre.Slug, strings.ToLower(genre.Name))
+	for _, g := range mg.genres {
+		if g.ID == genre.ID {
+			continue
+		}
+		if containsString(values, g.Slug) || containsString(values, strings.ToLower(g.Name)) {
+			return true
+		}
+		for _, a := range g.Aliases {
+			if containsString(values, a) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (mg *memoryGenres) Insert(genre *Genre) error {
+	mg.mu.Lock()
+	defer mg.mu.Unlock()
+
+	if mg.aliasTaken(genre) {
+		return ErrDuplicatedGenre
+	}
+	genre.Aliases = genre.normalizeAliases()
+	genre.ID = mg.nextID("genres")
+	genre.CreatedAt = time.Now().Truncate(time.Second)
+	genre.Version = 1
+	mg.genres[genre.ID] = copyGenre(genre)
+	return nil
+}
+
+func (mg *memoryGenres) GetAll() ([]*Genre, error) {
+	mg.mu.RLock()
+	defer mg.mu.RUnlock()
+
+	genres := []*Genre{}
+	for _, g := range mg.genres {
+		genres = append(genres, copyGenre(g))
+	}
+	sort.Slice(genres, func(i, j int) bool {
+		if genres[i].Name != genres[j].Name {
+			return genres[i].Name < genres[j].Name
+		}
+		return genres[i].ID < genres[j].ID
+	})
+	return genres, nil
+}
+
+func (mg *memoryGenres) Get(id int64) (*Genre, error) {
+	mg.mu.RLock()
+	defer mg.mu.RUnlock()
+
+	g, ok := mg.genres[id]
+	if !ok {
+		return nil, ErrRecordNotFound
+	}
+	return copyGenre(g), nil
+}
+
+func (mg *memoryGenres) Update(genre *Genre) error {
+	mg.mu.Lock()
+	defer mg.mu.Unlock()
+
+	if mg.aliasTaken(genre) {
+		return ErrDuplicatedGenre
+	}
+	stored, ok := mg.genres[genre.ID]
+	if !ok || stored.Version != genre.Version {
+		return ErrEditConflict
+	}
+	genre.Aliases = genre.normalizeAliases()
+	genre.Version++
+	stored.Name = genre.Name
+	stored.Aliases = append([]string{}, genre.Aliases...)
+	stored.Version = genre.Version
+	return nil
+}
+
+func (mg *memoryGenres) Delete(id int64) error {
+	mg.mu.Lock()
+	defer mg.mu.Unlock()
+
+	g, ok := mg.genres[id]
+	if !ok {
+		return ErrRecordNotFound
+	}
+	for _, m := range mg.movies {
+		if containsString(m.Genres, g.Slug) {
+			return ErrGenreInUse
+		}
+	}
+	delete(mg.genres, id)
+	return nil
+}
+
+func (mg *memoryGenres) Merge(genre, source *Genre, userID int64) (int64, error) {
+	mg.mu.Lock()
+	defer mg.mu.Unlock()
+
+	stored, ok := mg.genres[genre.ID]
+	merged, found := mg.genres[source.ID]
+	if !ok || !found || stored.Version != genre.Version || merged.Version != source.Version {
+		return 0, ErrEditConflict
+	}
+	delete(mg.genres, source.ID)
+
+	var movies int64
+	for _, m := range mg.movies {
+		if containsString(m.Genres, source.Slug) {
+			m.Genres = replaceGenre(m.Genres, source.Slug, genre.Slug)
+			m.Version++
+			mg.recordRevision(m, RevisionUpdate, userID)
+			movies++
+		}
+	}
+
+	genre.Version++
+	stored.Aliases = append([]string{}, genre.Aliases...)
+	stored.Version = genre.Version
+	return movies, nil
+}
+
+// memoryCredits keep the credits in memory, the person name is read from the people when the credits are listed
+type memoryCredits struct {
+	*memoryStore
+}
+
+func (mc *memoryCredits) Insert(credit *Credit) error {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+
+	if _, ok := mc.movies[credit.MovieID]; !ok {
+		return ErrRecordNotFound
+	}
+	if _, ok := mc.people[credit.PersonID]; !ok {
+		return ErrRecordNotFound
+	}
+	credit.ID = mc.nextID("credits")
+	c := *credit
+	c.PersonName, c.MovieTitle, c.MovieYear = "", "", 0
+	mc.credits[c.ID] = &c
+	return nil
+}
+
+// forMovies return the credits of the movies sorted by billing order, the store must be locked by the caller
+func (mc *memoryCredits) forMovies(movieIDs ...int64) []*Credit {
+	credits := []*Credit{}
+	for _, c := range mc.credits {
+		for _, id := range movieIDs {
+			if c.MovieID == id {
+				credit := *c
+				credit.PersonName = mc.people[c.PersonID].Name
+				credits = append(credits, &credit)
+			}
+		}
+	}
+	sort.Slice(credits, func(i, j int) bool {
+		a, b := credits[i], credits[j]
+		switch {
+		case a.MovieID != b.MovieID:
+			return a.MovieID < b.MovieID
+		case a.BillingOrder != b.BillingOrder:
+			return a.BillingOrder < b.BillingOrder
+		default:
+			return a.ID < b.ID
+		}
+	})
+	return credits
+}
+
+func (mc *memoryCredits) GetForMovie(movieID int64) ([]*Credit, error) {
+	mc.mu.RLock()
+	defer mc.mu.RUnlock()
+
+	return mc.forMovies(movieID), nil
+}
+
+func (mc *memoryCredits) GetForMovies(movieIDs []int64) (map[int64][]*Credit, error) {
+	mc.mu.RLock()
+	defer mc.mu.RUnlock()
+
+	credits := make(map[int64][]*Credit, len(movieIDs))
+	for _, c := range mc.forMovies(movieIDs...) {
+		credits[c.MovieID] = append(credits[c.MovieID], c)
+	}
+	return credits, nil
+}
+
+func (mc *memoryCredits) GetForPerson(personID int64, roles []string) ([]*Credit, error) {
+	mc.mu.RLock()
+	defer mc.mu.RUnlock()
+
+	credits := []*Credit{}
+	for _, c := range mc.credits {
+		m, ok := mc.movies[c.MovieID]
+		if c.PersonID != personID || !ok || m.DeletedAt != nil || (len(roles) > 0 && !containsString(roles, c.Role)) {
+			continue
+		}
+		credit := *c
+		credit.MovieTitle, credit.MovieYear = m.Title, m.Year
+		credits = append(credits, &credit)
+	}
+	sort.Slice(credits, func(i, j int) bool {
+		a, b := credits[i], credits[j]
+		switch {
+		case a.MovieYear != b.MovieYear:
+			return a.MovieYear > b.MovieYear
+		case a.MovieID != b.MovieID:
+			return a.MovieID < b.MovieID
+		default:
+			return a.BillingOrder < b.BillingOrder
+		}
+	})
+	return credits, nil
+}
+
+func (mc *memoryCredits) Delete(movieID, id int64) error {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+
+	c, ok := mc.credits[id]
+	if !ok || c.MovieID != movieID {
+		return ErrRecordNotFound
+	}
+	delete(mc.credits, id)
+	return nil
+}
@@ -0,0 +1,272 @@
+package data
+
+import (
+	"sort"
+	"time"
+)
+
+// memoryLists keep the lists in memory, the items are stored by list and the title and year of the movies are
+// read when the items are listed
+type memoryLists struct {
+	*memoryStore
+}
+
+// copyList return a copy of a stored list with the amount of movies out of the trash, the store must be locked by
+// the caller
+func (ml *memoryLists) copyList(l *List) *List {
+	list := *l
+	if l.Slug != nil {
+		slug := *l.Slug
+		list.Slug = &slug
+	}
+	list.Movies = nil
+	list.MovieCount = len(ml.items(l.ID))
+	return &list
+}
+
+// nameTaken report if another list of the user has the name
+func (ml *memoryLists) nameTaken(list *List) bool {
+	for _, l := range ml.lists {
+		if l.ID != list.ID && l.UserID == list.UserID && l.Name == list.Name {
+			return true
+		}
+	}
+	return false
+}
+
+func (ml *memoryLists) EnsureDefault(userID int64) error {
+	ml.mu.Lock()
+	defer ml.mu.Unlock()
+
+	if _, ok := ml.users[userID]; !ok {
+		return ErrRecordNotFound
+	}
+	list := &List{UserID: userID, Name: DefaultListName, Default: true}
+	for _, l := range ml.lists {
+		if l.UserID == userID && (l.Default || l.Name == list.Name) {
+			return nil
+		}
+	}
+	ml.insert(list)
+	return nil
+}
+
+func (ml *memoryLists) Insert(list *List) error {
+	ml.mu.Lock()
+	defer ml.mu.Unlock()
+
+	if _, ok := ml.users[list.UserID]; !ok {
+		return ErrRecordNotFound
+	}
+	if ml.nameTaken(list) {
+		return ErrDuplicatedListName
+	}
+	list.Default, list.Slug = false, nil
+	ml.insert(list)
+	return nil
+}
+
+// insert store a new list, the store must be locked by the caller
+func (ml *memoryLists) insert(list *List) {
+	list.ID = ml.nextID("lists")
+	list.CreatedAt = time.Now().Truncate(time.Second)
+	list.Version = 1
+
+	l := *list
+	l.Movies, l.MovieCount = nil, 0
+	ml.lists[l.ID] = &l
+}
+
+func (ml *memoryLists) GetAllForUser(userID int64) ([]*List, error) {
+	ml.mu.RLock()
+	defer ml.mu.RUnlock()
+
+	lists := []*List{}
+	for _, l := range ml.lists {
+		if l.UserID == userID {
+			lists = append(lists, ml.copyList(l))
+		}
+	}
+	sort.Slice(lists, func(i, j int) bool {
+		if lists[i].Default != lists[j].Default {
+			return lists[i].Default
+		}
+		return lists[i].ID < lists[j].ID
+	})
+	return lists, nil
+}
+
+func (ml *memoryLists) Get(id, userID int64) (*List, error) {
+	ml.mu.RLock()
+	defer ml.mu.RUnlock()
+
+	l, ok := ml.lists[id]
+	if !ok || l.UserID != userID {
+		return nil, ErrRecordNotFound
+	}
+	return ml.copyList(l), nil
+}
+
+func (ml *memoryLists) GetBySlug(slug string) (*List, error) {
+	ml.mu.RLock()
+	defer ml.mu.RUnlock()
+
+	for _, l := range ml.lists {
+		if l.Slug != nil && *l.Slug == slug {
+			return ml.copyList(l), nil
+		}
+	}
+	return nil, ErrRecordNotFound
+}
+
+func (ml *memoryLists) Update(list *List) error {
+	ml.mu.Lock()
+	defer ml.mu.Unlock()
+
+	stored, ok := ml.lists[list.ID]
+	if !ok || stored.UserID != list.UserID || stored.Version != list.Version {
+		return ErrEditConflict
+	}
+	if ml.nameTaken(list) {
+		return ErrDuplicatedListName
+	}
+	stored.Name = list.Name
+	stored.Slug = nil
+	if list.Slug != nil {
+		slug := *list.Slug
+		stored.Slug = &slug
+	}
+	stored.Version++
+	list.Version = stored.Version
+	return nil
+}
+
+func (ml *memoryLists) Delete(id, userID int64) error {
+	ml.mu.Lock()
+	defer ml.mu.Unlock()
+
+	l, ok := ml.lists[id]
+	if !ok || l.UserID != userID || l.Default {
+		return ErrRecordNotFound
+	}
+	delete(ml.lists, id)
+	delete(ml.listItems, id)
+	return nil
+}
+
+// items return the items of a list whose movie is out of the trash in the list order, the store must be locked
+// by the caller
+func (ml *memoryLists) items(listID int64) []*ListItem {
+	items := []*ListItem{}
+	for _, i := range ml.listItems[listID] {
+		m, ok := ml.movies[i.MovieID]
+		if !ok || m.DeletedAt != nil {
+			continue
+		}
+		item := *i
+		item.Title, item.Year = m.Title, m.Year
+		items = append(items, &item)
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		if items[i].Position != items[j].Position {
+			return items[i].Position < items[j].Position
+		}
+		return items[i].AddedAt.Before(items[j].AddedAt)
+	})
+	return items
+}
+
+func (ml *memoryLists) GetItems(listID int64) ([]*ListItem, error) {
+	ml.mu.RLock()
+	defer ml.mu.RUnlock()
+
+	return ml.items(listID), nil
+}
+
+func (ml *memoryLists) AddItem(listID, movieID int64) error {
+	ml.mu.Lock()
+	defer ml.mu.Unlock()
+
+	if _, ok := ml.lists[listID]; !ok {
+		return ErrRecordNotFound
+	}
+	if _, ok := ml.movies[movieID]; !ok {
+		return ErrRecordNotFound
+	}
+	var position int32
+	for _, i := range ml.listItems[listID] {
+		if i.MovieID == movieID {
+			return ErrDuplicatedListItem
+		}
+		if i.Position > position {
+			position = i.Position
+		}
+	}
+	ml.listItems[listID] = append(ml.listItems[listID], &ListItem{MovieID: movieID, Position: position + 1,
+		AddedAt: time.Now().Truncate(time.Second)})
+	return nil
+}
+
+// item return the stored item of a movie in a list, the store must be locked by the caller
+func (ml *memoryLists) item(listID, movieID int64) (int, *ListItem) {
+	for n, i := range ml.listItems[listID] {
+		if i.MovieID == movieID {
+			return n, i
+		}
+	}
+	return -1, nil
+}
+
+func (ml *memoryLists) RemoveItem(listID, movieID int64) error {
+	ml.mu.Lock()
+	defer ml.mu.Unlock()
+
+	n, i := ml.item(listID, movieID)
+	if i == nil {
+		return ErrRecordNotFound
+	}
+	items := ml.listItems[listID]
+	ml.listItems[listID] = append(items[:n:n], items[n+1:]...)
+	return nil
+}
+
+func (ml *memoryLists) SetWatched(listID, movieID int64, watchedAt *time.Time) error {
+	ml.mu.Lock()
+	defer ml.mu.Unlock()
+
+	_, i := ml.item(listID, movieID)
+	if i == nil {
+		return ErrRecordNotFound
+	}
+	i.WatchedAt = nil
+	if watchedAt != nil {
+		t := watchedAt.Truncate(time.Second)
+		i.WatchedAt = &t
+	}
+	return nil
+}
+
+func (ml *memoryLists) Reorder(listID int64, movieIDs []int64) error {
+	ml.mu.Lock()
+	defer ml.mu.Unlock()
+
+	for n, id := range movieIDs {
+		if _, i := ml.item(listID, id); i != nil {
+			i.Position = int32(n + 1)
+		}
+	}
+	return nil
+}
+
+// removeListItems remove a movie from every list, the store must be locked by the caller
+func (s *memoryStore) removeListItems(movieID int64) {
+	for listID, items := range s.listItems {
+		kept := items[:0]
+		for _, i := range items {
+			if i.MovieID != movieID {
+				kept = append(kept, i)
+			}
+		}
+		s.listItems[listID] = kept
+	}
+}
@@ -0,0 +1,497 @@
+package data
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// memoryMovies keep the movies in memory with the same semantics of MovieModel, every change record a revision
+// like the statements of MovieModel
+type memoryMovies struct {
+	*memoryStore
+}
+
+// copyMovie return a copy of a movie that does not share the genres or poster with the stored one
+func copyMovie(m *Movie) *Movie {
+	c := *m
+	c.Genres = append([]string{}, m.Genres...)
+	if m.Poster != nil {
+		c.Poster = make(Poster, len(m.Poster))
+		for k, v := range m.Poster {
+			c.Poster[k] = v
+		}
+	}
+	c.Credits = nil
+	return &c
+}
+
+func (mm *memoryMovies) Insert(movie *Movie, userID int64) error {
+	mm.mu.Lock()
+	defer mm.mu.Unlock()
+
+	mm.insert(movie, userID)
+	return nil
+}
+
+func (mm *memoryMovies) InsertAll(movies []*Movie, userID int64) error {
+	mm.mu.Lock()
+	defer mm.mu.Unlock()
+
+	for _, movie := range movies {
+		mm.insert(movie, userID)
+	}
+	return nil
+}
+
+func (mm *memoryMovies) insert(movie *Movie, userID int64) {
+	movie.ID = mm.nextID("movies")
+	movie.CreatedAt = time.Now().Truncate(time.Second)
+	movie.Version = 1
+
+	stored := copyMovie(movie)
+	stored.Poster = nil
+	stored.DeletedAt = nil
+	stored.AverageRating, stored.RatingCount = 0, 0
+	mm.movies[movie.ID] = stored
+	mm.recordRevision(stored, RevisionInsert, userID)
+}
+
+// editable return the stored movie when it is not in the trash and the version was not modified
+func (mm *memoryMovies) editable(movie *Movie) (*Movie, error) {
+	stored, ok := mm.movies[movie.ID]
+	if !ok || stored.DeletedAt != nil || stored.Version != movie.Version {
+		return nil, ErrEditConflict
+	}
+	return stored, nil
+}
+
+func (mm *memoryMovies) Update(movie *Movie, userID int64) error {
+	mm.mu.Lock()
+	defer mm.mu.Unlock()
+
+	stored, err := mm.editable(movie)
+	if err != nil {
+		return err
+	}
+	stored.Title = movie.Title
+	stored.Year = movie.Year
+	stored.Runtime = movie.Runtime
+	stored.Genres = append([]string{}, movie.Genres...)
+	stored.Version++
+	movie.Version = stored.Version
+	mm.recordRevision(stored, RevisionUpdate, userID)
+	return nil
+}
+
+func (mm *memoryMovies) SetPoster(movie *Movie, key string, userID int64) (string, error) {
+	mm.mu.Lock()
+	defer mm.mu.Unlock()
+
+	stored, err := mm.editable(movie)
+	if err != nil {
+		return "", err
+	}
+	previous := mm.posterKeys[movie.ID]
+	stored.Poster = copyMovie(movie).Poster
+	mm.posterKeys[movie.ID] = key
+	stored.Version++
+	movie.Version = stored.Version
+	mm.recordRevision(stored, RevisionUpdate, userID)
+	return previous, nil
+}
+
+func (mm *memoryMovies) Get(id int64) (*Movie, error) {
+	return mm.GetFields(id, nil)
+}
+
+func (mm *memoryMovies) GetFields(id int64, fields []string) (*Movie, error) {
+	mm.mu.RLock()
+	defer mm.mu.RUnlock()
+
+	stored, ok := mm.movies[id]
+	if !ok || stored.DeletedAt != nil {
+		return nil, ErrRecordNotFound
+	}
+	movie := copyMovie(stored)
+	if len(fields) > 0 {
+		movie.Project(append(append([]string{}, fields...), "id", "version"))
+	}
+	return movie, nil
+}
+
+func (mm *memoryMovies) GetAll(title string, genres []string, personID int64, filters Filters) ([]*Movie, Metadata, error) {
+	mm.mu.RLock()
+	defer mm.mu.RUnlock()
+
+	fuzzy := title != "" && len(mm.filter(title, false, genres, personID, filters)) == 0
+	movies := mm.filter(title, fuzzy, genres, personID, filters)
+	column := filters.sortColumn()
+	desc := filters.sortDirection() == "DESC"
+	sortMovies(movies, column, desc, desc)
+
+	totalRecords := len(movies)
+	limit, offset := filters.limit(), filters.offset()
+	if filters.CursorMode {
+		limit, offset = filters.limit()+1, 0
+		if filters.Cursor != "" {
+			c, err := decodeCursor(filters.Cursor)
+			if err != nil {
+				return nil, Metadata{}, err
+			}
+			after := cursorMovie(c, column)
+			i := sort.Search(len(movies), func(i int) bool {
+				cmp := compareMovies(movies[i], after, column)
+				if cmp == 0 {
+					cmp = compareFloat(float64(movies[i].ID), float64(after.ID))
+				}
+				return (!desc && cmp > 0) || (desc && cmp < 0)
+			})
+			movies = movies[i:]
+		}
+	}
+	movies = page(movies, limit, offset)
+	if filters.SkipCount || len(movies) == 0 {
+		totalRecords = 0
+	}
+
+	movies, metadata := listMetadata(movies, totalRecords, fuzzy, filters)
+	return movies, metadata, nil
+}
+
+func (mm *memoryMovies) GetFacets(title string, genres []string, personID int64, fuzzy bool,
+	filters Filters) (map[string][]FacetCount, error) {
+	mm.mu.RLock()
+	defer mm.mu.RUnlock()
+
+	movies := mm.filter(title, fuzzy, genres, personID, filters)
+	facets := make(map[string][]FacetCount, len(filters.Facets))
+	for _, f := range filters.Facets {
+		if _, seen := facets[f]; seen || !containsString(MovieFacets, f) {
+			continue
+		}
+
+		counts := make(map[string]int)
+		for _, m := range movies {
+			switch f {
+			case "genres":
+				for _, g := range m.Genres {
+					counts[g]++
+				}
+			case "decade":
+				counts[strconv.Itoa(int(m.Year/10*10))]++ //nolint:gomnd
+			case "runtime_bucket":
+				counts[runtimeBucketOf(int32(m.Runtime))]++
+			}
+		}
+
+		values := []FacetCount{}
+		for value, count := range counts {
+			values = append(values, FacetCount{Value: value, Count: count})
+		}
+		sort.Slice(values, func(i, j int) bool {
+			if values[i].Count != values[j].Count {
+				return values[i].Count > values[j].Count
+			}
+			return values[i].Value < values[j].Value
+		})
+		facets[f] = values
+	}
+	return facets, nil
+}
+
+func (mm *memoryMovies) GetTrash(filters Filters) ([]*Movie, Metadata, error) {
+	mm.mu.RLock()
+	defer mm.mu.RUnlock()
+
+	movies := []*Movie{}
+	for _, m := range mm.movies {
+		if m.DeletedAt != nil {
+			movies = append(movies, copyMovie(m))
+		}
+	}
+	sortMovies(movies, filters.sortColumn(), filters.sortDirection() == "DESC", false)
+
+	totalRecords := len(movies)
+	movies = page(movies, filters.limit(), filters.offset())
+	if len(movies) == 0 {
+		totalRecords = 0
+	}
+	return movies, calcMetadata(totalRecords, filters.Page, filters.PageSize), nil
+}
+
+// Export call fn for the movies selected when Export is called, the store is not locked while fn run
+func (mm *memoryMovies) Export(ctx context.Context, title string, genres []string, fn func(*Movie) error) error {
+	mm.mu.RLock()
+	movies := mm.filter(title, false, genres, 0, Filters{})
+	mm.mu.RUnlock()
+	sortMovies(movies, "id", false, false)
+
+	for _, m := range movies {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := fn(m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (mm *memoryMovies) Delete(movie *Movie, userID int64) error {
+	mm.mu.Lock()
+	defer mm.mu.Unlock()
+
+	stored, ok := mm.movies[movie.ID]
+	if !ok || stored.DeletedAt != nil || stored.Version != movie.Version {
+		return ErrEditConflict
+	}
+	now := time.Now().Truncate(time.Second)
+	stored.DeletedAt = &now
+	mm.removeListItems(movie.ID)
+	mm.recordRevision(stored, RevisionDelete, userID)
+	return nil
+}
+
+func (mm *memoryMovies) Restore(id, userID int64) error {
+	mm.mu.Lock()
+	defer mm.mu.Unlock()
+
+	stored, ok := mm.movies[id]
+	if !ok || stored.DeletedAt == nil {
+		return ErrRecordNotFound
+	}
+	stored.DeletedAt = nil
+	mm.recordRevision(stored, RevisionRestore, userID)
+	return nil
+}
+
+func (mm *memoryMovies) Purge(id int64) (string, error) {
+	mm.mu.Lock()
+	defer mm.mu.Unlock()
+
+	stored, ok := mm.movies[id]
+	if !ok || stored.DeletedAt == nil {
+		return "", ErrRecordNotFound
+	}
+	return mm.remove(id), nil
+}
+
+func (mm *memoryMovies) PurgeDeletedBefore(t time.Time) (int64, []string, error) {
+	mm.mu.Lock()
+	defer mm.mu.Unlock()
+
+	var n int64
+	keys := []string{}
+	for id, m := range mm.movies {
+		if m.DeletedAt == nil || !m.DeletedAt.Before(t) {
+			continue
+		}
+		n++
+		if key := mm.remove(id); key != "" {
+			keys = append(keys, key)
+		}
+	}
+	return n, keys, nil
+}
+
+// remove delete a movie with its credits, reviews, revisions and list entries and return the storage key of the
+// poster
+func (mm *memoryMovies) remove(id int64) string {
+	key := mm.posterKeys[id]
+	delete(mm.movies, id)
+	delete(mm.posterKeys, id)
+	for cid, c := range mm.credits {
+		if c.MovieID == id {
+			delete(mm.credits, cid)
+		}
+	}
+	for rid, r := range mm.reviews {
+		if r.MovieID == id {
+			delete(mm.reviews, rid)
+		}
+	}
+	revisions := mm.revisions[:0]
+	for _, r := range mm.revisions {
+		if r.MovieID != id {
+			revisions = append(revisions, r)
+		}
+	}
+	mm.revisions = revisions
+	mm.removeListItems(id)
+	return key
+}
+
+// filter return a copy of the movies out of the trash matching the filters, the relevance and match are set
+// when the movies are searched by title. The store must be locked by the caller.
+func (mm *memoryMovies) filter(title string, fuzzy bool, genres []string, personID int64, filters Filters) []*Movie {
+	terms := searchTerms(title)
+	movies := []*Movie{}
+	for _, m := range mm.movies {
+		if m.DeletedAt != nil || !mm.matches(m, genres, personID, filters) {
+			continue
+		}
+
+		movie := copyMovie(m)
+		switch {
+		case title == "":
+		case fuzzy:
+			movie.relevance = similarity(m.Title, title)
+			if movie.relevance < similarityThreshold {
+				continue
+			}
+		default:
+			rank, ok := textRank(m.Title, terms)
+			if !ok {
+				continue
+			}
+			movie.relevance = rank
+			movie.Match = highlight(m.Title, terms)
+		}
+		movies = append(movies, movie)
+	}
+	return movies
+}
+
+// matches apply the same conditions of movieConditions except the title search
+func (mm *memoryMovies) matches(m *Movie, genres []string, personID int64, filters Filters) bool {
+	if len(genres) > 0 {
+		overlap, contains := false, true
+		for _, g := range genres {
+			in := containsString(m.Genres, g)
+			overlap = overlap || in
+			contains = contains && in
+		}
+		switch filters.GenresMode {
+		case GenresAny:
+			if !overlap {
+				return false
+			}
+		case GenresNone:
+			if overlap {
+				return false
+			}
+		default:
+			if !contains {
+				return false
+			}
+		}
+	}
+	if personID > 0 && !mm.credited(m.ID, personID) {
+		return false
+	}
+
+	year, runtime := int(m.Year), int(m.Runtime)
+	switch {
+	case filters.YearMin > 0 && year < filters.YearMin,
+		filters.YearMax > 0 && year > filters.YearMax,
+		filters.Decade > 0 && (year < filters.Decade || year > filters.Decade+9), //nolint:gomnd
+		filters.RuntimeMin > 0 && runtime < filters.RuntimeMin,
+		filters.RuntimeMax > 0 && runtime > filters.RuntimeMax,
+		!filters.CreatedAfter.IsZero() && m.CreatedAt.Before(filters.CreatedAfter),
+		!filters.CreatedBefore.IsZero() && !m.CreatedAt.Before(filters.CreatedBefore):
+		return false
+	}
+	if filters.RuntimeBucket != "" {
+		bucket := runtimeBucket(filters.RuntimeBucket)
+		if int32(runtime) < bucket.Min || int32(runtime) >= bucket.Max {
+			return false
+		}
+	}
+	return true
+}
+
+// credited report if the person is credited in the movie
+func (mm *memoryMovies) credited(movieID, personID int64) bool {
+	for _, c := range mm.credits {
+		if c.MovieID == movieID && c.PersonID == personID {
+			return true
+		}
+	}
+	return false
+}
+
+// runtimeBucketOf return the name of the bucket of a runtime like the runtime_bucket facet expression
+func runtimeBucketOf(runtime int32) string {
+	for _, b := range RuntimeBuckets[:len(RuntimeBuckets)-1] {
+		if runtime < b.Max {
+			return b.Name
+		}
+	}
+	return RuntimeBuckets[len(RuntimeBuckets)-1].Name
+}
+
+// sortMovies sort the movies by the column and use the id as tie-breaker
+func sortMovies(movies []*Movie, column string, desc, idDesc bool) {
+	sort.Slice(movies, func(i, j int) bool {
+		if cmp := compareMovies(movies[i], movies[j], column); cmp != 0 {
+			return (cmp < 0) != desc
+		}
+		return (movies[i].ID < movies[j].ID) != idDesc
+	})
+}
+
+// compareMovies compare the sort column of two movies, the id is compared by the callers as tie-breaker
+func compareMovies(a, b *Movie, column string) int {
+	switch column {
+	case "title":
+		return strings.Compare(a.Title, b.Title)
+	case "year":
+		return compareFloat(float64(a.Year), float64(b.Year))
+	case "runtime":
+		return compareFloat(float64(a.Runtime), float64(b.Runtime))
+	case "rating":
+		return compareFloat(float64(a.AverageRating), float64(b.AverageRating))
+	case "relevance":
+		return compareFloat(float64(a.relevance), float64(b.relevance))
+	case "deleted_at":
+		if a.DeletedAt != nil && b.DeletedAt != nil {
+			return compareFloat(float64(a.DeletedAt.Unix()), float64(b.DeletedAt.Unix()))
+		}
+	}
+	return 0
+}
+
+func compareFloat(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// cursorMovie return a movie holding the position of a cursor to compare it with the movies listed
+func cursorMovie(c *cursor, column string) *Movie {
+	m := &Movie{ID: c.ID}
+	n, _ := strconv.ParseFloat(c.Value, 32)
+	switch column {
+	case "title":
+		m.Title = c.Value
+	case "year":
+		m.Year = int32(n)
+	case "runtime":
+		m.Runtime = Runtime(n)
+	case "rating":
+		m.AverageRating = float32(n)
+	case "relevance":
+		m.relevance = float32(n)
+	}
+	return m
+}
+
+// page return the movies of a page
+func page(movies []*Movie, limit, offset int) []*Movie {
+	if offset >= len(movies) {
+		return []*Movie{}
+	}
+	movies = movies[offset:]
+	if len(movies) > limit {
+		movies = movies[:limit]
+	}
+	return movies
+}
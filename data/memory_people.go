@@ -0,0 +1,121 @@
+package data
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+type memoryPeople struct {
+	*memoryStore
+}
+
+func (mp *memoryPeople) Insert(person *Person) error {
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+
+	person.ID = mp.nextID("people")
+	person.CreatedAt = time.Now().Truncate(time.Second)
+	person.Version = 1
+
+	p := *person
+	mp.people[p.ID] = &p
+	return nil
+}
+
+func (mp *memoryPeople) Get(id int64) (*Person, error) {
+	mp.mu.RLock()
+	defer mp.mu.RUnlock()
+
+	p, ok := mp.people[id]
+	if !ok {
+		return nil, ErrRecordNotFound
+	}
+	person := *p
+	return &person, nil
+}
+
+// GetAll return the people whose name contain every word searched, like the simple text search of PeopleModel
+func (mp *memoryPeople) GetAll(name string, filters Filters) ([]*Person, Metadata, error) {
+	mp.mu.RLock()
+	defer mp.mu.RUnlock()
+
+	terms := searchTerms(name)
+	people := []*Person{}
+	for _, p := range mp.people {
+		if _, ok := textRank(p.Name, terms); len(terms) > 0 && !ok {
+			continue
+		}
+		person := *p
+		people = append(people, &person)
+	}
+
+	desc := filters.sortDirection() == "DESC"
+	sort.Slice(people, func(i, j int) bool {
+		a, b := people[i], people[j]
+		cmp := 0
+		switch filters.sortColumn() {
+		case "name":
+			cmp = strings.Compare(a.Name, b.Name)
+		case "birth_year":
+			cmp = compareFloat(float64(a.BirthYear), float64(b.BirthYear))
+		case "id":
+			cmp = compareFloat(float64(a.ID), float64(b.ID))
+		}
+		if cmp != 0 {
+			return (cmp < 0) != desc
+		}
+		return a.ID < b.ID
+	})
+
+	totalRecords := len(people)
+	start, end := pageBounds(totalRecords, filters.limit(), filters.offset())
+	if start == end {
+		totalRecords = 0
+	}
+	return people[start:end], calcMetadata(totalRecords, filters.Page, filters.PageSize), nil
+}
+
+func (mp *memoryPeople) Update(person *Person) error {
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+
+	stored, ok := mp.people[person.ID]
+	if !ok || stored.Version != person.Version {
+		return ErrEditConflict
+	}
+	person.Version++
+
+	p := *person
+	mp.people[p.ID] = &p
+	return nil
+}
+
+// Delete remove a person and the credits of the person like the ON DELETE CASCADE of the database backends
+func (mp *memoryPeople) Delete(id int64) error {
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+
+	if _, ok := mp.people[id]; !ok {
+		return ErrRecordNotFound
+	}
+	delete(mp.people, id)
+	for cid, c := range mp.credits {
+		if c.PersonID == id {
+			delete(mp.credits, cid)
+		}
+	}
+	return nil
+}
+
+// pageBounds return the bounds of a page in a slice of n elements
+func pageBounds(n, limit, offset int) (start, end int) {
+	if offset >= n {
+		return n, n
+	}
+	end = offset + limit
+	if end > n {
+		end = n
+	}
+	return offset, end
+}
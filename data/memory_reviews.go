@@ -0,0 +1,160 @@
+package data
+
+import (
+	"sort"
+	"time"
+)
+
+// memoryReviews keep the reviews in memory, the rating aggregates of the movie are computed again on every change
+// like the reviews_rating_aggregate trigger
+type memoryReviews struct {
+	*memoryStore
+}
+
+func (mr *memoryReviews) Insert(review *Review) error {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+
+	if _, ok := mr.movies[review.MovieID]; !ok {
+		return ErrRecordNotFound
+	}
+	if _, ok := mr.users[review.UserID]; !ok {
+		return ErrRecordNotFound
+	}
+	for _, r := range mr.reviews {
+		if r.MovieID == review.MovieID && r.UserID == review.UserID {
+			return ErrDuplicatedReview
+		}
+	}
+	review.ID = mr.nextID("reviews")
+	review.CreatedAt = time.Now().Truncate(time.Second)
+	review.Version = 1
+
+	r := *review
+	r.UserName = ""
+	mr.reviews[r.ID] = &r
+	mr.aggregateRatings(r.MovieID)
+	return nil
+}
+
+func (mr *memoryReviews) GetForUser(movieID, userID int64) (*Review, error) {
+	mr.mu.RLock()
+	defer mr.mu.RUnlock()
+
+	for _, r := range mr.reviews {
+		if r.MovieID == movieID && r.UserID == userID {
+			review := *r
+			return &review, nil
+		}
+	}
+	return nil, ErrRecordNotFound
+}
+
+func (mr *memoryReviews) GetAllForUser(userID int64) ([]*Review, error) {
+	mr.mu.RLock()
+	defer mr.mu.RUnlock()
+
+	reviews := []*Review{}
+	for _, r := range mr.reviews {
+		if r.UserID == userID {
+			review := *r
+			reviews = append(reviews, &review)
+		}
+	}
+	sort.Slice(reviews, func(i, j int) bool {
+		if !reviews[i].CreatedAt.Equal(reviews[j].CreatedAt) {
+			return reviews[i].CreatedAt.After(reviews[j].CreatedAt)
+		}
+		return reviews[i].ID > reviews[j].ID
+	})
+	return reviews, nil
+}
+
+func (mr *memoryReviews) GetAllForMovie(movieID int64, filters Filters) ([]*Review, Metadata, error) {
+	mr.mu.RLock()
+	defer mr.mu.RUnlock()
+
+	reviews := []*Review{}
+	for _, r := range mr.reviews {
+		u, ok := mr.users[r.UserID]
+		if r.MovieID != movieID || !ok {
+			continue
+		}
+		review := *r
+		review.UserName = u.Name
+		reviews = append(reviews, &review)
+	}
+
+	desc := filters.sortDirection() == "DESC"
+	sort.Slice(reviews, func(i, j int) bool {
+		a, b := reviews[i], reviews[j]
+		cmp := 0
+		switch filters.sortColumn() {
+		case "rating":
+			cmp = compareFloat(float64(a.Rating), float64(b.Rating))
+		case "created_at":
+			cmp = compareFloat(float64(a.CreatedAt.Unix()), float64(b.CreatedAt.Unix()))
+		case "id":
+			cmp = compareFloat(float64(a.ID), float64(b.ID))
+		}
+		if cmp != 0 {
+			return (cmp < 0) != desc
+		}
+		return a.ID < b.ID
+	})
+
+	totalRecords := len(reviews)
+	start, end := pageBounds(totalRecords, filters.limit(), filters.offset())
+	if start == end {
+		totalRecords = 0
+	}
+	return reviews[start:end], calcMetadata(totalRecords, filters.Page, filters.PageSize), nil
+}
+
+func (mr *memoryReviews) Update(review *Review) error {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+
+	stored, ok := mr.reviews[review.ID]
+	if !ok || stored.Version != review.Version {
+		return ErrEditConflict
+	}
+	stored.Rating = review.Rating
+	stored.Body = review.Body
+	stored.Version++
+	review.Version = stored.Version
+	mr.aggregateRatings(stored.MovieID)
+	return nil
+}
+
+func (mr *memoryReviews) Delete(review *Review) error {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+
+	stored, ok := mr.reviews[review.ID]
+	if !ok || stored.Version != review.Version {
+		return ErrEditConflict
+	}
+	delete(mr.reviews, review.ID)
+	mr.aggregateRatings(stored.MovieID)
+	return nil
+}
+
+// aggregateRatings set the amount and average of the ratings of a movie, the store must be locked by the caller
+func (s *memoryStore) aggregateRatings(movieID int64) {
+	m, ok := s.movies[movieID]
+	if !ok {
+		return
+	}
+	var sum, count int32
+	for _, r := range s.reviews {
+		if r.MovieID == movieID {
+			sum += r.Rating
+			count++
+		}
+	}
+	m.RatingCount, m.AverageRating = count, 0
+	if count > 0 {
+		m.AverageRating = float32(sum) / float32(count)
+	}
+}
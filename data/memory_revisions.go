@@ -0,0 +1,109 @@
+package data
+
+import (
+	"sort"
+	"time"
+)
+
+// memoryRevisions read the history recorded by memoryMovies, the user names are read from the users like the
+// LEFT JOIN of RevisionModel
+type memoryRevisions struct {
+	*memoryStore
+}
+
+// recordRevision append the values of a movie after a change, the store must be locked by the caller
+func (s *memoryStore) recordRevision(m *Movie, action string, userID int64) {
+	rev := &Revision{
+		ID:        s.nextID("movie_revisions"),
+		CreatedAt: time.Now().Truncate(time.Second),
+		MovieID:   m.ID,
+		Version:   m.Version,
+		Action:    action,
+		Title:     m.Title,
+		Year:      m.Year,
+		Runtime:   m.Runtime,
+		Genres:    append([]string{}, m.Genres...),
+	}
+	if userID > 0 {
+		rev.UserID = &userID
+	}
+	s.revisions = append(s.revisions, rev)
+}
+
+// copyRevision return a copy of a stored revision with the name of the user, the store must be locked by the caller
+func (s *memoryStore) copyRevision(r *Revision) *Revision {
+	rev := *r
+	rev.Genres = append([]string{}, r.Genres...)
+	if r.UserID != nil {
+		id := *r.UserID
+		rev.UserID = &id
+		if u, ok := s.users[id]; ok {
+			name := u.Name
+			rev.UserName = &name
+		}
+	}
+	return &rev
+}
+
+func (mr *memoryRevisions) GetAllForMovie(movieID int64, filters Filters) ([]*Revision, Metadata, error) {
+	mr.mu.RLock()
+	defer mr.mu.RUnlock()
+
+	revisions := []*Revision{}
+	for _, r := range mr.revisions {
+		if r.MovieID == movieID {
+			revisions = append(revisions, mr.copyRevision(r))
+		}
+	}
+
+	desc := filters.sortDirection() == "DESC"
+	sort.Slice(revisions, func(i, j int) bool {
+		a, b := revisions[i], revisions[j]
+		cmp := 0
+		switch filters.sortColumn() {
+		case "version":
+			cmp = compareFloat(float64(a.Version), float64(b.Version))
+		case "created_at":
+			cmp = compareFloat(float64(a.CreatedAt.Unix()), float64(b.CreatedAt.Unix()))
+		}
+		if cmp != 0 {
+			return (cmp < 0) != desc
+		}
+		return (a.ID < b.ID) != desc
+	})
+
+	totalRecords := len(revisions)
+	start, end := pageBounds(totalRecords, filters.limit(), filters.offset())
+	if start == end {
+		totalRecords = 0
+	}
+	return revisions[start:end], calcMetadata(totalRecords, filters.Page, filters.PageSize), nil
+}
+
+func (mr *memoryRevisions) GetAllForUser(userID int64) ([]*Revision, error) {
+	mr.mu.RLock()
+	defer mr.mu.RUnlock()
+
+	revisions := []*Revision{}
+	// the revisions are appended in order so the newest are the last ones
+	for i := len(mr.revisions) - 1; i >= 0; i-- {
+		if r := mr.revisions[i]; r.UserID != nil && *r.UserID == userID {
+			rev := mr.copyRevision(r)
+			rev.UserName = nil
+			revisions = append(revisions, rev)
+		}
+	}
+	return revisions, nil
+}
+
+func (mr *memoryRevisions) Get(movieID int64, version int32) (*Revision, error) {
+	mr.mu.RLock()
+	defer mr.mu.RUnlock()
+
+	for _, r := range mr.revisions {
+		if r.MovieID == movieID && r.Version == version && (r.Action == RevisionInsert || r.Action == RevisionUpdate) {
+			return mr.copyRevision(r), nil
+		}
+	}
+	return nil, ErrRecordNotFound
+}
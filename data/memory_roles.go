@@ -0,0 +1,144 @@
+package data
+
+import (
+	"sort"
+	"time"
+)
+
+type memoryRoles struct {
+	*memoryStore
+}
+
+func copyRole(r *Role) *Role {
+	c := *r
+	c.Permissions = append(Permissions{}, r.Permissions...)
+	sort.Strings(c.Permissions)
+	return &c
+}
+
+func (mr *memoryRoles) nameTaken(role *Role) bool {
+	for _, r := range mr.roles {
+		if r.ID != role.ID && r.Name == role.Name {
+			return true
+		}
+	}
+	return false
+}
+
+func (mr *memoryRoles) Insert(role *Role) error {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+
+	if mr.nameTaken(role) {
+		return ErrDuplicatedRole
+	}
+	role.ID = mr.nextID("roles")
+	role.CreatedAt = time.Now().Truncate(time.Second)
+	role.Version = 1
+	mr.roles[role.ID] = copyRole(role)
+	return nil
+}
+
+func (mr *memoryRoles) GetAll() ([]*Role, error) {
+	mr.mu.RLock()
+	defer mr.mu.RUnlock()
+
+	roles := []*Role{}
+	for _, r := range mr.roles {
+		roles = append(roles, copyRole(r))
+	}
+	sort.Slice(roles, func(i, j int) bool { return roles[i].Name < roles[j].Name })
+	return roles, nil
+}
+
+func (mr *memoryRoles) Get(id int64) (*Role, error) {
+	mr.mu.RLock()
+	defer mr.mu.RUnlock()
+
+	r, ok := mr.roles[id]
+	if !ok {
+		return nil, ErrRecordNotFound
+	}
+	return copyRole(r), nil
+}
+
+func (mr *memoryRoles) GetAllForUser(userID int64) ([]*Role, error) {
+	mr.mu.RLock()
+	defer mr.mu.RUnlock()
+
+	roles := []*Role{}
+	for _, id := range mr.userRoles[userID] {
+		roles = append(roles, copyRole(mr.roles[id]))
+	}
+	sort.Slice(roles, func(i, j int) bool { return roles[i].Name < roles[j].Name })
+	return roles, nil
+}
+
+func (mr *memoryRoles) Update(role *Role) error {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+
+	stored, ok := mr.roles[role.ID]
+	if !ok || stored.Version != role.Version {
+		return ErrEditConflict
+	}
+	if mr.nameTaken(role) {
+		return ErrDuplicatedRole
+	}
+	role.Version++
+	mr.roles[role.ID] = copyRole(role)
+	return nil
+}
+
+// Delete remove the role and unassign it from the users like the cascade of the database backends
+func (mr *memoryRoles) Delete(id int64) error {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+
+	if _, ok := mr.roles[id]; !ok {
+		return ErrRecordNotFound
+	}
+	delete(mr.roles, id)
+	for userID := range mr.userRoles {
+		mr.userRoles[userID] = removeID(mr.userRoles[userID], id)
+	}
+	return nil
+}
+
+func (mr *memoryRoles) AddForUser(userID, roleID int64) error {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+
+	if _, ok := mr.users[userID]; !ok {
+		return ErrRecordNotFound
+	}
+	if _, ok := mr.roles[roleID]; !ok {
+		return ErrRecordNotFound
+	}
+	for _, id := range mr.userRoles[userID] {
+		if id == roleID {
+			return nil
+		}
+	}
+	mr.userRoles[userID] = append(mr.userRoles[userID], roleID)
+	return nil
+}
+
+func (mr *memoryRoles) RemoveForUser(userID, roleID int64) error {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+
+	mr.userRoles[userID] = removeID(mr.userRoles[userID], roleID)
+	return nil
+}
+
+// removeID return the ids without the id removed
+func removeID(ids []int64, removed int64) []int64 {
+	kept := []int64{}
+	for _, id := range ids {
+		if id != removed {
+			kept = append(kept, id)
+		}
+	}
+	return kept
+}
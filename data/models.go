@@ -7,24 +7,53 @@ import (
 
 const QueryTimeOut = 3
 
+const (
+	BackendPostgres = "postgres"
+	BackendSQLite   = "sqlite"
+	BackendMemory   = "memory"
+)
+
 var (
-	ErrRecordNotFound  = errors.New("record not found")
-	ErrEditConflict    = errors.New("edit conflict, please try again")
-	ErrDuplicatedEmail = errors.New("email already registered")
+	ErrRecordNotFound     = errors.New("record not found")
+	ErrEditConflict       = errors.New("edit conflict, please try again")
+	ErrDuplicatedEmail    = errors.New("email already registered")
+	ErrDuplicatedReview   = errors.New("movie already reviewed")
+	ErrDuplicatedListName = errors.New("list name already used")
+	ErrDuplicatedListItem = errors.New("movie already in list")
+	ErrDuplicatedGenre    = errors.New("genre slug, name or alias already used")
+	ErrGenreInUse         = errors.New("genre used by movies")
+	ErrDuplicatedRole     = errors.New("role name already used")
 )
 
+// Models hold the repositories used by the API, Backend is the storage selected at startup
 type Models struct {
-	Movies      MovieModel
-	Users       UserModel
-	Tokens      TokensModel
-	Permissions PermissionsModel
+	Backend     string
+	Movies      MovieRepository
+	Users       UserRepository
+	Tokens      TokenRepository
+	Permissions PermissionRepository
+	Roles       RoleRepository
+	People      PeopleRepository
+	Credits     CreditRepository
+	Reviews     ReviewRepository
+	Lists       ListRepository
+	Revisions   RevisionRepository
+	Genres      GenreRepository
 }
 
 func NewModels(db *sql.DB) Models {
 	return Models{
-		Movies:      MovieModel{DB: db},
-		Users:       UserModel{DB: db},
-		Tokens:      TokensModel{DB: db},
-		Permissions: PermissionsModel{DB: db},
+		Backend:     BackendPostgres,
+		Movies:      &MovieModel{DB: db},
+		Users:       &UserModel{DB: db},
+		Tokens:      &TokensModel{DB: db},
+		Permissions: &PermissionsModel{DB: db},
+		Roles:       &RoleModel{DB: db},
+		People:      &PeopleModel{DB: db},
+		Credits:     &CreditModel{DB: db},
+		Reviews:     &ReviewModel{DB: db},
+		Lists:       &ListModel{DB: db},
+		Revisions:   &RevisionModel{DB: db},
+		Genres:      &GenreModel{DB: db},
 	}
 }
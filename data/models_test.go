@@ -0,0 +1,791 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/eze8789/movies-api/migrations"
+)
+
+// testDSNEnv hold the DSN of a Postgres database used by the model tests, the migrations are applied to it and
+// the rows created are kept so it must not be used for anything else
+const testDSNEnv = "MOVIES_API_TEST_DSN"
+
+func TestMemoryModels(t *testing.T) {
+	testModels(t, NewMemoryModels())
+}
+
+func TestPostgresModels(t *testing.T) {
+	dsn := os.Getenv(testDSNEnv)
+	if dsn == "" {
+		t.Skipf("%s is not set", testDSNEnv)
+	}
+	db := openTestDB(t, "postgres", dsn, BackendPostgres)
+	testModels(t, NewModels(db))
+}
+
+// openTestDB open a database and apply the migrations of the backend
+func openTestDB(t *testing.T, driver, dsn, backend string) *sql.DB {
+	t.Helper()
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	m, err := migrations.New(db, backend)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = m.Up(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// testModels run the same checks against the repositories of every backend, the names are unique so the suite
+// can run again on a database that keep the rows of a previous run
+func testModels(t *testing.T, models Models) {
+	run := time.Now().UnixNano()
+	t.Run("MovieVersionConflict", func(t *testing.T) { testMovieVersionConflict(t, models, run) })
+	t.Run("MovieTitleSearch", func(t *testing.T) { testMovieTitleSearch(t, models, run) })
+	t.Run("MovieGenreContainment", func(t *testing.T) { testMovieGenreContainment(t, models, run) })
+	t.Run("UserDuplicatedEmail", func(t *testing.T) { testUserDuplicatedEmail(t, models, run) })
+	t.Run("TokenExpiry", func(t *testing.T) { testTokenExpiry(t, models, run) })
+	t.Run("GenreMerge", func(t *testing.T) { testGenreMerge(t, models, run) })
+	t.Run("MovieRanking", func(t *testing.T) { testMovieRanking(t, models, run) })
+	t.Run("MovieCursor", func(t *testing.T) { testMovieCursor(t, models, run) })
+	t.Run("MovieFacetsAndRanges", func(t *testing.T) { testMovieFacetsAndRanges(t, models, run) })
+	t.Run("MovieTrash", func(t *testing.T) { testMovieTrash(t, models, run) })
+	t.Run("MovieRevisions", func(t *testing.T) { testMovieRevisions(t, models, run) })
+	t.Run("Reviews", func(t *testing.T) { testReviews(t, models, run) })
+	t.Run("Lists", func(t *testing.T) { testLists(t, models, run) })
+	t.Run("People", func(t *testing.T) { testPeople(t, models, run) })
+}
+
+func insertTestMovie(t *testing.T, models Models, title string, genres ...string) *Movie {
+	t.Helper()
+	return insertTestMovieYear(t, models, title, 2001, 120, genres...)
+}
+
+func insertTestMovieYear(t *testing.T, models Models, title string, year, runtime int32, genres ...string) *Movie {
+	t.Helper()
+	movie := &Movie{Title: title, Year: year, Runtime: Runtime(runtime), Genres: genres}
+	err := models.Movies.Insert(movie, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return movie
+}
+
+// insertTestUser insert an activated user, the password is not hashed to keep the suite fast
+func insertTestUser(t *testing.T, models Models, name string, run int64) *User {
+	t.Helper()
+	user := &User{Name: name, Email: fmt.Sprintf("%s%d@example.com", strings.ToLower(name), run), Activated: true}
+	user.Password.hashedPWD = []byte("not a hash")
+	err := models.Users.Insert(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+// testFilters return the filters used to list the movies of a test sorted by title
+func testFilters() Filters {
+	return Filters{Page: 1, PageSize: 20, Sort: "title", SortSafe: []string{"title"}, GenresMode: GenresAll}
+}
+
+// testTitles return the titles of the movies matching the title and genres sorted by title
+func testTitles(t *testing.T, models Models, title string, genres []string) []string {
+	t.Helper()
+	return testFilteredTitles(t, models, title, genres, testFilters())
+}
+
+func testFilteredTitles(t *testing.T, models Models, title string, genres []string, filters Filters) []string {
+	t.Helper()
+	movies, _, err := models.Movies.GetAll(title, genres, 0, filters)
+	if err != nil {
+		t.Fatal(err)
+	}
+	titles := make([]string, 0, len(movies))
+	for _, m := range movies {
+		titles = append(titles, m.Title)
+	}
+	return titles
+}
+
+func testMovieVersionConflict(t *testing.T, models Models, run int64) {
+	movie := insertTestMovie(t, models, fmt.Sprintf("Conflict %d", run), "drama")
+	stale := *movie
+
+	movie.Title += " updated"
+	err := models.Movies.Update(movie, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if movie.Version != 2 {
+		t.Fatalf("got version %d after the update, want 2", movie.Version)
+	}
+
+	stale.Title += " stale"
+	err = models.Movies.Update(&stale, 0)
+	if !errors.Is(err, ErrEditConflict) {
+		t.Fatalf("got %v updating a stale movie, want ErrEditConflict", err)
+	}
+	err = models.Movies.Delete(&stale, 0)
+	if !errors.Is(err, ErrEditConflict) {
+		t.Fatalf("got %v deleting a stale movie, want ErrEditConflict", err)
+	}
+
+	err = models.Movies.Delete(movie, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = models.Movies.Get(movie.ID)
+	if !errors.Is(err, ErrRecordNotFound) {
+		t.Fatalf("got %v reading a deleted movie, want ErrRecordNotFound", err)
+	}
+}
+
+func testMovieTitleSearch(t *testing.T, models Models, run int64) {
+	word := fmt.Sprintf("Quokka%d", run)
+	insertTestMovie(t, models, fmt.Sprintf("The %s Returns", word), "comedy")
+	insertTestMovie(t, models, fmt.Sprintf("%s Crossing", word), "comedy")
+	insertTestMovie(t, models, fmt.Sprintf("Crossing %d", run), "comedy")
+
+	tests := []struct {
+		title string
+		want  []string
+	}{
+		{word, []string{fmt.Sprintf("%s Crossing", word), fmt.Sprintf("The %s Returns", word)}},
+		{strings.ToLower("crossing " + word), []string{fmt.Sprintf("%s Crossing", word)}},
+		// the fuzzy search is used when no title match, it must not match an unrelated word
+		{"wombat", []string{}},
+	}
+	for _, tt := range tests {
+		if got := testTitles(t, models, tt.title, nil); fmt.Sprint(got) != fmt.Sprint(tt.want) {
+			t.Errorf("title %q: got %v, want %v", tt.title, got, tt.want)
+		}
+	}
+}
+
+func testMovieGenreContainment(t *testing.T, models Models, run int64) {
+	word := fmt.Sprintf("numbat%d", run)
+	insertTestMovie(t, models, word+" Space", "western", "sci-fi")
+	insertTestMovie(t, models, word+" Plain", "western")
+	insertTestMovie(t, models, word+" Drama", "drama")
+
+	tests := []struct {
+		genres []string
+		want   []string
+	}{
+		{[]string{"western"}, []string{word + " Plain", word + " Space"}},
+		{[]string{"western", "sci-fi"}, []string{word + " Space"}},
+		{[]string{"sci-fi", "drama"}, []string{}},
+	}
+	for _, tt := range tests {
+		if got := testTitles(t, models, word, tt.genres); fmt.Sprint(got) != fmt.Sprint(tt.want) {
+			t.Errorf("genres %v: got %v, want %v", tt.genres, got, tt.want)
+		}
+	}
+}
+
+func testUserDuplicatedEmail(t *testing.T, models Models, run int64) {
+	user := &User{Name: "Bob", Email: fmt.Sprintf("bob%d@example.com", run), Activated: true}
+	// the password is not hashed to keep the suite fast
+	user.Password.hashedPWD = []byte("not a hash")
+	err := models.Users.Insert(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the emails are compared ignoring case
+	duplicated := &User{Name: "Bob", Email: fmt.Sprintf("BOB%d@example.com", run)}
+	duplicated.Password.hashedPWD = user.Password.hashedPWD
+	err = models.Users.Insert(duplicated)
+	if !errors.Is(err, ErrDuplicatedEmail) {
+		t.Fatalf("got %v inserting a duplicated email, want ErrDuplicatedEmail", err)
+	}
+
+	got, err := models.Users.GetByEmail(duplicated.Email)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.ID != user.ID {
+		t.Fatalf("got user %d, want %d", got.ID, user.ID)
+	}
+}
+
+func testTokenExpiry(t *testing.T, models Models, run int64) {
+	user := &User{Name: "Ann", Email: fmt.Sprintf("ann%d@example.com", run), Activated: true}
+	user.Password.hashedPWD = []byte("not a hash")
+	err := models.Users.Insert(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expired, err := models.Tokens.New(user.ID, -time.Minute, ScopeAuthentication)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = models.Users.GetForToken(expired.PlainToken, ScopeAuthentication)
+	if !errors.Is(err, ErrRecordNotFound) {
+		t.Fatalf("got %v reading the user of an expired token, want ErrRecordNotFound", err)
+	}
+
+	valid, err := models.Tokens.New(user.ID, time.Minute, ScopeAuthentication)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := models.Users.GetForToken(valid.PlainToken, ScopeAuthentication)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.ID != user.ID {
+		t.Fatalf("got user %d, want %d", got.ID, user.ID)
+	}
+	// the scope is part of the token
+	_, err = models.Users.GetForToken(valid.PlainToken, ScopeActivation)
+	if !errors.Is(err, ErrRecordNotFound) {
+		t.Fatalf("got %v reading the user with another scope, want ErrRecordNotFound", err)
+	}
+}
+
+func testGenreMerge(t *testing.T, models Models, run int64) {
+	genre := &Genre{Slug: fmt.Sprintf("space-opera-%d", run), Name: fmt.Sprintf("Space Opera %d", run),
+		Aliases: []string{}}
+	source := &Genre{Slug: fmt.Sprintf("planetary-%d", run), Name: fmt.Sprintf("Planetary %d", run),
+		Aliases: []string{fmt.Sprintf("planets %d", run)}}
+	other := &Genre{Slug: fmt.Sprintf("cosmic-%d", run), Name: fmt.Sprintf("Cosmic %d", run), Aliases: []string{}}
+	for _, g := range []*Genre{genre, source, other} {
+		err := models.Genres.Insert(g)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	both := insertTestMovie(t, models, fmt.Sprintf("Both %d", run), source.Slug, "drama", genre.Slug)
+	merged := insertTestMovie(t, models, fmt.Sprintf("Merged %d", run), source.Slug)
+
+	stale := *genre
+	genre.MergeAliases(source)
+	n, err := models.Genres.Merge(genre, source, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Fatalf("got %d movies merged, want 2", n)
+	}
+
+	// the genre is kept once in the position of the first one
+	tests := []struct {
+		movie *Movie
+		want  []string
+	}{
+		{both, []string{genre.Slug, "drama"}},
+		{merged, []string{genre.Slug}},
+	}
+	for _, tt := range tests {
+		got, err := models.Movies.Get(tt.movie.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fmt.Sprint(got.Genres) != fmt.Sprint(tt.want) || got.Version != tt.movie.Version+1 {
+			t.Errorf("movie %d: got %v version %d, want %v version %d", tt.movie.ID, got.Genres, got.Version,
+				tt.want, tt.movie.Version+1)
+		}
+	}
+
+	got, err := models.Genres.Get(genre.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	aliases := append([]string{}, got.Aliases...)
+	sort.Strings(aliases)
+	want := []string{fmt.Sprintf("planetary %d", run), source.Slug, source.Aliases[0]}
+	if fmt.Sprint(aliases) != fmt.Sprint(want) {
+		t.Errorf("got aliases %v, want %v", aliases, want)
+	}
+	_, err = models.Genres.Get(source.ID)
+	if !errors.Is(err, ErrRecordNotFound) {
+		t.Fatalf("got %v reading the merged genre, want ErrRecordNotFound", err)
+	}
+
+	// a stale genre does not merge and the source is kept
+	_, err = models.Genres.Merge(&stale, other, 0)
+	if !errors.Is(err, ErrEditConflict) {
+		t.Fatalf("got %v merging into a stale genre, want ErrEditConflict", err)
+	}
+	_, err = models.Genres.Get(other.ID)
+	if err != nil {
+		t.Fatalf("got %v reading the source of the failed merge", err)
+	}
+}
+
+func testMovieRanking(t *testing.T, models Models, run int64) {
+	word := fmt.Sprintf("Wallaby%d", run)
+	// the weaker match is inserted first so the id does not decide the order
+	weak := insertTestMovie(t, models, fmt.Sprintf("The Long %s Road", word), "drama")
+	strong := insertTestMovie(t, models, fmt.Sprintf("%s %s", word, word), "drama")
+
+	filters := Filters{Page: 1, PageSize: 20, Sort: "relevance", SortSafe: []string{"relevance"}}
+	movies, metadata, err := models.Movies.GetAll(word, nil, 0, filters)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(movies) != 2 || movies[0].ID != strong.ID || movies[1].ID != weak.ID {
+		t.Fatalf("got %d movies, want %q ranked before %q", len(movies), strong.Title, weak.Title)
+	}
+	if metadata.Fuzzy || metadata.TotalRecords != 2 {
+		t.Errorf("got metadata %+v, want 2 records and no fuzzy search", metadata)
+	}
+	want := fmt.Sprintf("The Long <b>%s</b> Road", word)
+	if movies[1].Match != want {
+		t.Errorf("got match %q, want %q", movies[1].Match, want)
+	}
+}
+
+func testMovieCursor(t *testing.T, models Models, run int64) {
+	word := fmt.Sprintf("Bilby%d", run)
+	// two movies share the year so the id breaks the tie between pages
+	for i, year := range []int32{2001, 2002, 2002, 2003, 2004} {
+		insertTestMovieYear(t, models, fmt.Sprintf("%s %d", word, i), year, 100, "drama")
+	}
+
+	filters := Filters{PageSize: 2, Sort: "-year", SortSafe: []string{"-year"}, CursorMode: true}
+	seen := map[int64]bool{}
+	years := []int32{}
+	pages := 0
+	for {
+		movies, metadata, err := models.Movies.GetAll(word, nil, 0, filters)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pages++
+		for _, m := range movies {
+			if seen[m.ID] {
+				t.Fatalf("movie %d returned twice", m.ID)
+			}
+			seen[m.ID] = true
+			years = append(years, m.Year)
+		}
+		if metadata.NextCursor == "" || pages > 5 {
+			break
+		}
+		filters.Cursor = metadata.NextCursor
+	}
+	if pages != 3 || fmt.Sprint(years) != fmt.Sprint([]int32{2004, 2003, 2002, 2002, 2001}) {
+		t.Errorf("got years %v in %d pages, want [2004 2003 2002 2002 2001] in 3 pages", years, pages)
+	}
+}
+
+func testMovieFacetsAndRanges(t *testing.T, models Models, run int64) {
+	word := fmt.Sprintf("Dingo%d", run)
+	insertTestMovieYear(t, models, word+" One", 1985, 95, "drama")
+	insertTestMovieYear(t, models, word+" Two", 1992, 130, "drama", "comedy")
+	insertTestMovieYear(t, models, word+" Three", 1998, 160, "comedy")
+	insertTestMovieYear(t, models, word+" Four", 2005, 80, "drama")
+
+	filters := testFilters()
+	filters.Facets = MovieFacets
+	facets, err := models.Movies.GetFacets(word, nil, 0, false, filters)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string][]FacetCount{
+		"genres":         {{"drama", 3}, {"comedy", 2}},
+		"decade":         {{"1990", 2}, {"1980", 1}, {"2000", 1}},
+		"runtime_bucket": {{"0-89", 1}, {"120-149", 1}, {"150+", 1}, {"90-119", 1}},
+	}
+	for _, f := range MovieFacets {
+		if fmt.Sprint(facets[f]) != fmt.Sprint(want[f]) {
+			t.Errorf("facet %s: got %v, want %v", f, facets[f], want[f])
+		}
+	}
+
+	// the facets are counted over the movies in the ranges
+	filters.YearMin = 1990
+	facets, err = models.Movies.GetFacets(word, nil, 0, false, filters)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprint(facets["genres"]); got != "[{comedy 2} {drama 2}]" {
+		t.Errorf("facet genres from 1990: got %s, want [{comedy 2} {drama 2}]", got)
+	}
+
+	all := []string{word + " Four", word + " One", word + " Three", word + " Two"}
+	tests := []struct {
+		name   string
+		genres []string
+		update func(f *Filters)
+		want   []string
+	}{
+		{"years", nil, func(f *Filters) { f.YearMin, f.YearMax = 1990, 1999 }, []string{word + " Three", word + " Two"}},
+		{"runtime min", nil, func(f *Filters) { f.RuntimeMin = 120 }, []string{word + " Three", word + " Two"}},
+		{"runtime max", nil, func(f *Filters) { f.RuntimeMax = 100 }, []string{word + " Four", word + " One"}},
+		{"decade", nil, func(f *Filters) { f.Decade = 1980 }, []string{word + " One"}},
+		{"runtime bucket", nil, func(f *Filters) { f.RuntimeBucket = "150+" }, []string{word + " Three"}},
+		{"genres any", []string{"drama", "comedy"}, func(f *Filters) { f.GenresMode = GenresAny }, all},
+		{"genres none", []string{"drama"}, func(f *Filters) { f.GenresMode = GenresNone }, []string{word + " Three"}},
+	}
+	for _, tt := range tests {
+		filters := testFilters()
+		tt.update(&filters)
+		if got := testFilteredTitles(t, models, word, tt.genres, filters); fmt.Sprint(got) != fmt.Sprint(tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func testMovieTrash(t *testing.T, models Models, run int64) {
+	movie := insertTestMovie(t, models, fmt.Sprintf("Trashed %d", run), "drama")
+	inTrash := func() bool {
+		t.Helper()
+		filters := Filters{Page: 1, PageSize: 100, Sort: "-deleted_at", SortSafe: []string{"-deleted_at"}}
+		movies, _, err := models.Movies.GetTrash(filters)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, m := range movies {
+			if m.ID == movie.ID {
+				return m.DeletedAt != nil
+			}
+		}
+		return false
+	}
+
+	// a movie out of the trash can not be purged
+	_, err := models.Movies.Purge(movie.ID)
+	if !errors.Is(err, ErrRecordNotFound) {
+		t.Fatalf("got %v purging a movie out of the trash, want ErrRecordNotFound", err)
+	}
+
+	err = models.Movies.Delete(movie, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !inTrash() {
+		t.Fatal("the deleted movie is not in the trash")
+	}
+	for _, title := range testTitles(t, models, movie.Title, nil) {
+		if title == movie.Title {
+			t.Error("the movie in the trash is listed")
+		}
+	}
+
+	err = models.Movies.Restore(movie.ID, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if inTrash() {
+		t.Fatal("the restored movie is still in the trash")
+	}
+	err = models.Movies.Restore(movie.ID, 0)
+	if !errors.Is(err, ErrRecordNotFound) {
+		t.Fatalf("got %v restoring a movie out of the trash, want ErrRecordNotFound", err)
+	}
+
+	movie, err = models.Movies.Get(movie.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = models.Movies.Delete(movie, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = models.Movies.Purge(movie.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if inTrash() {
+		t.Fatal("the purged movie is still in the trash")
+	}
+	err = models.Movies.Restore(movie.ID, 0)
+	if !errors.Is(err, ErrRecordNotFound) {
+		t.Fatalf("got %v restoring a purged movie, want ErrRecordNotFound", err)
+	}
+}
+
+func testMovieRevisions(t *testing.T, models Models, run int64) {
+	user := insertTestUser(t, models, "Rita", run)
+	movie := &Movie{Title: fmt.Sprintf("Revised %d", run), Year: 2001, Runtime: 100, Genres: []string{"drama"}}
+	err := models.Movies.Insert(movie, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	movie.Genres = []string{"drama", "comedy"}
+	err = models.Movies.Update(movie, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = models.Movies.Delete(movie, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a revision without user is recorded for changes made by the system
+	err = models.Movies.Restore(movie.ID, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	filters := Filters{Page: 1, PageSize: 20, Sort: "version", SortSafe: []string{"version"}}
+	revisions, metadata, err := models.Revisions.GetAllForMovie(movie.ID, filters)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := []string{}
+	for _, r := range revisions {
+		name := ""
+		if r.UserName != nil {
+			name = *r.UserName
+		}
+		got = append(got, fmt.Sprintf("%d %s %s %v", r.Version, r.Action, name, r.Genres))
+	}
+	want := []string{"1 insert Rita [drama]", "2 update Rita [drama comedy]", "2 delete Rita [drama comedy]",
+		"2 restore  [drama comedy]"}
+	if fmt.Sprint(got) != fmt.Sprint(want) || metadata.TotalRecords != len(want) {
+		t.Errorf("got revisions %q with %d records, want %q", got, metadata.TotalRecords, want)
+	}
+
+	rev, err := models.Revisions.Get(movie.ID, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rev.Action != RevisionInsert || fmt.Sprint(rev.Genres) != "[drama]" {
+		t.Errorf("got revision %s %v for version 1, want insert [drama]", rev.Action, rev.Genres)
+	}
+	_, err = models.Revisions.Get(movie.ID, 3)
+	if !errors.Is(err, ErrRecordNotFound) {
+		t.Fatalf("got %v reading a missing version, want ErrRecordNotFound", err)
+	}
+
+	mine, err := models.Revisions.GetAllForUser(user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mine) != 3 || mine[0].Action != RevisionDelete {
+		t.Errorf("got %d revisions of the user, want 3 with the delete first", len(mine))
+	}
+}
+
+func testReviews(t *testing.T, models Models, run int64) {
+	ann := insertTestUser(t, models, "Rose", run)
+	bob := insertTestUser(t, models, "Ryan", run)
+	movie := insertTestMovie(t, models, fmt.Sprintf("Reviewed %d", run), "drama")
+
+	first := &Review{MovieID: movie.ID, UserID: ann.ID, Rating: 8, Body: "good"}
+	second := &Review{MovieID: movie.ID, UserID: bob.ID, Rating: 5}
+	for _, r := range []*Review{first, second} {
+		err := models.Reviews.Insert(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := models.Reviews.Insert(&Review{MovieID: movie.ID, UserID: ann.ID, Rating: 1})
+	if !errors.Is(err, ErrDuplicatedReview) {
+		t.Fatalf("got %v reviewing a movie twice, want ErrDuplicatedReview", err)
+	}
+
+	ratings := func(count int32, average float32) {
+		t.Helper()
+		got, err := models.Movies.Get(movie.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.RatingCount != count || got.AverageRating != average {
+			t.Errorf("got %d ratings with average %v, want %d with average %v", got.RatingCount,
+				got.AverageRating, count, average)
+		}
+	}
+	ratings(2, 6.5)
+
+	stale := *second
+	second.Rating = 9
+	err = models.Reviews.Update(second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ratings(2, 8.5)
+	err = models.Reviews.Delete(&stale)
+	if !errors.Is(err, ErrEditConflict) {
+		t.Fatalf("got %v deleting a stale review, want ErrEditConflict", err)
+	}
+
+	filters := Filters{Page: 1, PageSize: 20, Sort: "-rating", SortSafe: []string{"-rating"}}
+	reviews, _, err := models.Reviews.GetAllForMovie(movie.ID, filters)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reviews) != 2 || reviews[0].UserName != "Ryan" || reviews[1].UserName != "Rose" {
+		t.Errorf("got %d reviews, want the reviews of Ryan and Rose", len(reviews))
+	}
+
+	err = models.Reviews.Delete(second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ratings(1, 8)
+	_, err = models.Reviews.GetForUser(movie.ID, bob.ID)
+	if !errors.Is(err, ErrRecordNotFound) {
+		t.Fatalf("got %v reading a deleted review, want ErrRecordNotFound", err)
+	}
+}
+
+func testLists(t *testing.T, models Models, run int64) {
+	user := insertTestUser(t, models, "Lisa", run)
+	movies := []*Movie{}
+	for _, title := range []string{"First", "Second", "Third"} {
+		movies = append(movies, insertTestMovie(t, models, fmt.Sprintf("%s %d", title, run), "drama"))
+	}
+
+	// the default list is only created once
+	for i := 0; i < 2; i++ {
+		err := models.Lists.EnsureDefault(user.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	list := &List{UserID: user.ID, Name: "favourites"}
+	err := models.Lists.Insert(list)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = models.Lists.Insert(&List{UserID: user.ID, Name: "favourites"})
+	if !errors.Is(err, ErrDuplicatedListName) {
+		t.Fatalf("got %v inserting a duplicated list name, want ErrDuplicatedListName", err)
+	}
+	lists, err := models.Lists.GetAllForUser(user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lists) != 2 || !lists[0].Default || lists[0].Name != DefaultListName || lists[1].ID != list.ID {
+		t.Fatalf("got %d lists, want the default list before %q", len(lists), list.Name)
+	}
+
+	for _, m := range movies {
+		err = models.Lists.AddItem(list.ID, m.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = models.Lists.AddItem(list.ID, movies[0].ID)
+	if !errors.Is(err, ErrDuplicatedListItem) {
+		t.Fatalf("got %v adding a movie twice, want ErrDuplicatedListItem", err)
+	}
+	err = models.Lists.Reorder(list.ID, []int64{movies[2].ID, movies[0].ID, movies[1].ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	watched := time.Now().Truncate(time.Second)
+	err = models.Lists.SetWatched(list.ID, movies[0].ID, &watched)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the movies moved to the trash are removed from the lists
+	err = models.Movies.Delete(movies[1], 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	items, err := models.Lists.GetItems(list.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := []string{}
+	for _, i := range items {
+		got = append(got, fmt.Sprintf("%s %t", i.Title, i.WatchedAt != nil))
+	}
+	want := []string{fmt.Sprintf("Third %d false", run), fmt.Sprintf("First %d true", run)}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("got items %q, want %q", got, want)
+	}
+	list, err = models.Lists.Get(list.ID, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if list.MovieCount != 2 {
+		t.Errorf("got %d movies in the list, want 2", list.MovieCount)
+	}
+	err = models.Movies.Restore(movies[1].ID, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = models.Lists.AddItem(list.ID, movies[1].ID)
+	if err != nil {
+		t.Fatalf("got %v adding a restored movie, want it added again", err)
+	}
+
+	err = models.Lists.Delete(lists[0].ID, user.ID)
+	if !errors.Is(err, ErrRecordNotFound) {
+		t.Fatalf("got %v deleting the default list, want ErrRecordNotFound", err)
+	}
+	err = models.Lists.Delete(list.ID, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = models.Lists.Get(list.ID, user.ID)
+	if !errors.Is(err, ErrRecordNotFound) {
+		t.Fatalf("got %v reading a deleted list, want ErrRecordNotFound", err)
+	}
+}
+
+func testPeople(t *testing.T, models Models, run int64) {
+	word := fmt.Sprintf("Ada%d", run)
+	person := &Person{Name: word + " Lovelace", BirthYear: 1815}
+	err := models.People.Insert(person)
+	if err != nil {
+		t.Fatal(err)
+	}
+	filters := Filters{Page: 1, PageSize: 20, Sort: "name", SortSafe: []string{"name"}}
+	people, _, err := models.People.GetAll(strings.ToLower(word), filters)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(people) != 1 || people[0].ID != person.ID {
+		t.Fatalf("got %d people searching %q, want %q", len(people), word, person.Name)
+	}
+
+	movie := insertTestMovie(t, models, fmt.Sprintf("Engine %d", run), "drama")
+	err = models.Credits.Insert(&Credit{MovieID: movie.ID, PersonID: person.ID, Role: "writer"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	credits, err := models.Credits.GetForMovie(movie.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(credits) != 1 || credits[0].PersonName != person.Name {
+		t.Fatalf("got %d credits, want the credit of %q", len(credits), person.Name)
+	}
+
+	stale := *person
+	person.Name = word + " King"
+	err = models.People.Update(person)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = models.People.Update(&stale)
+	if !errors.Is(err, ErrEditConflict) {
+		t.Fatalf("got %v updating a stale person, want ErrEditConflict", err)
+	}
+
+	// the credits are removed with the person
+	err = models.People.Delete(person.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	credits, err = models.Credits.GetForMovie(movie.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(credits) != 0 {
+		t.Errorf("got %d credits after deleting the person, want none", len(credits))
+	}
+}
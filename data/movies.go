@@ -5,6 +5,8 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/eze8789/movies-api/validator"
@@ -19,6 +21,18 @@ type Movie struct {
 	Runtime   Runtime   `json:"runtime,omitempty"`
 	Genres    []string  `json:"genres,omitempty"`
 	Version   int32     `json:"version,omitempty"`
+	// DeletedAt is only set for movies in the trash
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+	// AverageRating and RatingCount are calculated from the user reviews
+	AverageRating float32 `json:"average_rating,omitempty"`
+	RatingCount   int32   `json:"rating_count,omitempty"`
+	// Match hold the title with the search terms highlighted when movies are searched by title
+	Match string `json:"match,omitempty"`
+	// Credits hold the cast and crew, only filled when a single movie is requested
+	Credits []*Credit `json:"credits,omitempty"`
+	// Poster hold the urls of the uploaded poster and its thumbnails
+	Poster    Poster `json:"poster,omitempty"`
+	relevance float32
 }
 
 type MovieModel struct {
@@ -40,24 +54,66 @@ func ValidateMovie(v *validator.Validator, movie *Movie) {
 	v.Check(movie.Runtime > 0, "runtime", "must be a positive integer")
 }
 
-func (m *MovieModel) Insert(movie *Movie) error {
+// rowQuerier is implemented by *sql.DB and *sql.Tx to run the same statements in or out of a transaction
+type rowQuerier interface {
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// Insert create a movie and record the first revision made by the user
+func (m *MovieModel) Insert(movie *Movie, userID int64) error {
+	return m.insert(m.DB, movie, userID)
+}
+
+// InsertAll create the movies in a single transaction, no movie is created if any of them fails
+func (m *MovieModel) InsertAll(movies []*Movie, userID int64) error {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() //nolint:errcheck
+
+	for _, movie := range movies {
+		err = m.insert(tx, movie, userID)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (m *MovieModel) insert(q rowQuerier, movie *Movie, userID int64) error {
 	stmt := `
-	INSERT INTO movies (title, year, runtime, genres) 
-	VALUES ($1, $2, $3, $4)
-	RETURNING id, created_at, version`
-	args := []interface{}{movie.Title, movie.Year, movie.Runtime, pq.Array(movie.Genres)}
+	WITH movie AS (
+		INSERT INTO movies (title, year, runtime, genres) 
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at, version, title, year, runtime, genres
+	), revision AS (
+		INSERT INTO movie_revisions (movie_id, version, action, user_id, title, year, runtime, genres)
+		SELECT id, version, 'insert', NULLIF($5::bigint, 0), title, year, runtime, genres FROM movie
+	)
+	SELECT id, created_at, version FROM movie`
+	args := []interface{}{movie.Title, movie.Year, movie.Runtime, pq.Array(movie.Genres), userID}
 	ctx, cancel := context.WithTimeout(context.Background(), QueryTimeOut*time.Second)
 	defer cancel()
 
-	return m.DB.QueryRowContext(ctx, stmt, args...).Scan(&movie.ID, &movie.CreatedAt, &movie.Version)
+	return q.QueryRowContext(ctx, stmt, args...).Scan(&movie.ID, &movie.CreatedAt, &movie.Version)
 }
 
-func (m *MovieModel) Update(movie *Movie) error {
-	stmt := `UPDATE movies
-	SET title = $1, year = $2, runtime = $3, genres = $4, version = version + 1
-	WHERE id = $5 AND version = $6
-	RETURNING version`
-	args := []interface{}{movie.Title, movie.Year, movie.Runtime, pq.Array(movie.Genres), movie.ID, movie.Version}
+// Update change a movie when the version was not modified and record the new revision made by the user
+func (m *MovieModel) Update(movie *Movie, userID int64) error {
+	stmt := `
+	WITH movie AS (
+		UPDATE movies
+		SET title = $1, year = $2, runtime = $3, genres = $4, version = version + 1
+		WHERE id = $5 AND version = $6 AND deleted_at IS NULL
+		RETURNING id, version, title, year, runtime, genres
+	), revision AS (
+		INSERT INTO movie_revisions (movie_id, version, action, user_id, title, year, runtime, genres)
+		SELECT id, version, 'update', NULLIF($7::bigint, 0), title, year, runtime, genres FROM movie
+	)
+	SELECT version FROM movie`
+	args := []interface{}{movie.Title, movie.Year, movie.Runtime, pq.Array(movie.Genres), movie.ID, movie.Version,
+		userID}
 
 	ctx, cancel := context.WithTimeout(context.Background(), QueryTimeOut*time.Second)
 	defer cancel()
@@ -75,20 +131,27 @@ func (m *MovieModel) Update(movie *Movie) error {
 }
 
 func (m *MovieModel) Get(id int64) (*Movie, error) {
+	return m.GetFields(id, nil)
+}
+
+// GetFields return a movie selecting only the fields requested, the id and version are always selected
+//
+//nolint:gosec
+func (m *MovieModel) GetFields(id int64, fields []string) (*Movie, error) {
 	if id < 1 {
 		return nil, ErrRecordNotFound
 	}
-	stmt := `SELECT id, created_at, title, year, runtime, genres, version
-	FROM movies
-	WHERE id = $1`
 
 	var movie Movie
+	columns, dest := movie.selectFields(fields, []string{"id", "version"}, nil)
+	stmt := fmt.Sprintf(`SELECT %s
+	FROM movies
+	WHERE id = $1 AND deleted_at IS NULL`, strings.Join(columns, ", "))
 
 	ctx, cancel := context.WithTimeout(context.Background(), QueryTimeOut*time.Second)
 	defer cancel()
 
-	err := m.DB.QueryRowContext(ctx, stmt, id).Scan(&movie.ID, &movie.CreatedAt, &movie.Title,
-		&movie.Year, &movie.Runtime, pq.Array(&movie.Genres), &movie.Version)
+	err := m.DB.QueryRowContext(ctx, stmt, id).Scan(dest...)
 
 	if err != nil {
 		switch {
@@ -101,22 +164,150 @@ func (m *MovieModel) Get(id int64) (*Movie, error) {
 	return &movie, nil
 }
 
+// GetAll list movies filtered by title, genres and the person credited in the movie, titles are matched using full-text search and
+// when nothing matches a trigram similarity search is used to tolerate typos
+func (m *MovieModel) GetAll(title string, genres []string, personID int64, filters Filters) ([]*Movie, Metadata, error) {
+	fuzzy := false
+	if title != "" {
+		found, err := m.titleMatches(title, genres, personID, filters)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		fuzzy = !found
+	}
+
+	movies, totalRecords, err := m.search(title, fuzzy, genres, personID, filters)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	movies, metadata := listMetadata(movies, totalRecords, fuzzy, filters)
+	return movies, metadata, nil
+}
+
+// listMetadata return the page of movies and its metadata, in cursor mode movies hold one extra row that is
+// removed and used to know if there is a next page
+func listMetadata(movies []*Movie, totalRecords int, fuzzy bool, filters Filters) ([]*Movie, Metadata) {
+	var metadata Metadata
+	switch {
+	case filters.CursorMode:
+		nextCursor := ""
+		if len(movies) > filters.limit() {
+			movies = movies[:filters.limit()]
+			last := movies[len(movies)-1]
+			nextCursor = encodeCursor(filters.Sort, last.sortValue(filters.sortColumn()), last.ID)
+		}
+		metadata = calcCursorMetadata(totalRecords, filters.PageSize, nextCursor)
+	case filters.SkipCount && len(movies) > 0:
+		metadata = Metadata{CurrentPage: filters.Page, PageSize: filters.PageSize, FirstPage: 1}
+	default:
+		metadata = calcMetadata(totalRecords, filters.Page, filters.PageSize)
+	}
+	metadata.Fuzzy = fuzzy && len(movies) > 0
+	return movies, metadata
+}
+
+// searchClause hold the SQL fragments used to filter, rank and highlight movies by title
+type searchClause struct {
+	where string
+	rank  string
+	match string
+}
+
+// titleSearch return the clause to search by title using the placeholder p, full-text search is used unless
+// fuzzy is set
+func titleSearch(title string, fuzzy bool, p string) searchClause {
+	switch {
+	case title == "":
+		return searchClause{where: "true", rank: "0", match: "''"}
+	case fuzzy:
+		return searchClause{where: fmt.Sprintf("title %% %s", p), rank: fmt.Sprintf("similarity(title, %s)", p),
+			match: "''"}
+	default:
+		return searchClause{
+			where: fmt.Sprintf("to_tsvector('simple', title) @@ plainto_tsquery('simple', %s)", p),
+			rank:  fmt.Sprintf("ts_rank(to_tsvector('simple', title), plainto_tsquery('simple', %s))", p),
+			match: fmt.Sprintf("ts_headline('simple', title, plainto_tsquery('simple', %s))", p),
+		}
+	}
+}
+
+// titleMatches report if any movie matches the title using full-text search
+//
 //nolint:gosec
-func (m *MovieModel) GetAll(title string, genres []string, filters Filters) ([]*Movie, Metadata, error) {
-	stmt := fmt.Sprintf(`SELECT count(*) OVER(), id, created_at, title, year, runtime, genres, version
-						FROM movies
-						WHERE (to_tsvector('simple', title) @@ plainto_tsquery('simple', $1) OR $1 = '')
-						AND (genres @> $2 OR $2 = '{}')
-						ORDER BY %s %s
-						LIMIT $3 OFFSET $4`, filters.sortColumn(), filters.sortDirection())
-	args := []interface{}{title, pq.Array(genres), filters.limit(), filters.offset()}
+func (m *MovieModel) titleMatches(title string, genres []string, personID int64, filters Filters) (bool, error) {
+	var b whereBuilder
+	movieConditions(&b, title, false, genres, personID, filters)
+	stmt := fmt.Sprintf(`SELECT EXISTS (SELECT 1 FROM movies WHERE %s)`, b.String())
+
+	ctx, cancel := context.WithTimeout(context.Background(), QueryTimeOut*time.Second)
+	defer cancel()
+
+	var found bool
+	err := m.DB.QueryRowContext(ctx, stmt, b.args...).Scan(&found)
+	return found, err
+}
+
+// search run the list query, the rows are counted before the cursor condition is applied to return the
+// total of filtered rows, in cursor mode the rows are fetched after the cursor position and ordered by the
+// sort column with the id as tie-breaker, so deep pages cost the same as the first one
+//
+//nolint:gosec
+func (m *MovieModel) search(title string, fuzzy bool, genres []string, personID int64,
+	filters Filters) ([]*Movie, int, error) {
+	count := "count(*) OVER()"
+	if filters.SkipCount {
+		count = "0"
+	}
+	column, direction := filters.sortColumn(), filters.sortDirection()
+
+	var b whereBuilder
+	sc := movieConditions(&b, title, fuzzy, genres, personID, filters)
+
+	keyset := ""
+	limit, offset := filters.limit(), filters.offset()
+	if filters.CursorMode {
+		limit, offset = filters.limit()+1, 0
+		if filters.Cursor != "" {
+			c, err := decodeCursor(filters.Cursor)
+			if err != nil {
+				return nil, 0, err
+			}
+			if column == "id" {
+				keyset = fmt.Sprintf("WHERE id %s %s", filters.keysetOperator(), b.param(c.ID))
+			} else {
+				keyset = fmt.Sprintf("WHERE (%s, id) %s (%s, %s)", column, filters.keysetOperator(),
+					b.param(c.Value), b.param(c.ID))
+			}
+		}
+	}
+
+	// the sort column is needed to build the cursor and the version to build the list etag
+	required := []string{"id", "version", column}
+	if column == "rating" {
+		required[2] = "average_rating"
+	}
+	var scanned Movie
+	inner, _ := scanned.selectFields(filters.Fields, required, map[string]string{"average_rating": "average_rating AS rating"})
+	outer, _ := scanned.selectFields(filters.Fields, required, map[string]string{"average_rating": "rating"})
+
+	stmt := fmt.Sprintf(`SELECT total, relevance, %s, %s
+						FROM (
+							SELECT %s AS total, %s, %s AS relevance
+							FROM movies
+							WHERE %s
+						) AS movies
+						%s
+						ORDER BY %s %s, id %s
+						LIMIT %s OFFSET %s`, sc.match, strings.Join(outer, ", "), count, strings.Join(inner, ", "), sc.rank,
+		b.String(), keyset, column, direction, direction, b.param(limit), b.param(offset))
 
 	ctx, cancel := context.WithTimeout(context.Background(), QueryTimeOut*time.Second)
 	defer cancel()
 
-	r, err := m.DB.QueryContext(ctx, stmt, args...)
+	r, err := m.DB.QueryContext(ctx, stmt, b.args...)
 	if err != nil {
-		return nil, Metadata{}, err
+		return nil, 0, err
 	}
 	defer r.Close()
 
@@ -124,32 +315,236 @@ func (m *MovieModel) GetAll(title string, genres []string, filters Filters) ([]*
 	movies := []*Movie{}
 	for r.Next() {
 		var movie Movie
-		err := r.Scan(&totalRecords, &movie.ID, &movie.CreatedAt, &movie.Title, &movie.Year, &movie.Runtime,
-			pq.Array(&movie.Genres), &movie.Version)
+		_, dest := movie.selectFields(filters.Fields, required, nil)
+		err := r.Scan(append([]interface{}{&totalRecords, &movie.relevance, &movie.Match}, dest...)...)
 		if err != nil {
-			return nil, Metadata{}, err
+			return nil, 0, err
 		}
 		movies = append(movies, &movie)
 	}
 	if err := r.Err(); err != nil {
-		return nil, Metadata{}, err
+		return nil, 0, err
 	}
-	metadata := calcMetadata(totalRecords, filters.Page, filters.PageSize)
+	return movies, totalRecords, nil
+}
 
-	return movies, metadata, nil
+// movieFields hold the fields of a movie that can be selected with a sparse fieldset, in the order they are selected
+var movieFields = []string{"id", "title", "year", "runtime", "genres", "version", "average_rating", "rating_count",
+	"poster"}
+
+// selectFields return the columns and the scan destinations of the requested and required fields, every field is
+// selected when fields is empty. columns hold the expressions for the fields with a different column name.
+func (m *Movie) selectFields(fields, required []string, columns map[string]string) ([]string, []interface{}) {
+	all := len(fields) == 0
+	selected := []string{}
+	dest := []interface{}{}
+	if all {
+		selected = append(selected, "created_at")
+		dest = append(dest, &m.CreatedAt)
+	}
+
+	for _, f := range movieFields {
+		if !all && !containsString(fields, f) && !containsString(required, f) {
+			continue
+		}
+		column, ok := columns[f]
+		if !ok {
+			column = f
+		}
+		selected = append(selected, column)
+		dest = append(dest, m.fieldDest(f))
+	}
+	return selected, dest
+}
+
+func (m *Movie) fieldDest(field string) interface{} {
+	switch field {
+	case "title":
+		return &m.Title
+	case "year":
+		return &m.Year
+	case "runtime":
+		return &m.Runtime
+	case "genres":
+		return pq.Array(&m.Genres)
+	case "version":
+		return &m.Version
+	case "average_rating":
+		return &m.AverageRating
+	case "rating_count":
+		return &m.RatingCount
+	case "poster":
+		return &m.Poster
+	default:
+		return &m.ID
+	}
+}
+
+// Project clear the fields not included in a sparse fieldset, the fields selected to paginate or build the
+// etag are removed from the response this way. Nothing is cleared when fields is empty.
+func (m *Movie) Project(fields []string) {
+	if len(fields) == 0 {
+		return
+	}
+	if !containsString(fields, "id") {
+		m.ID = 0
+	}
+	if !containsString(fields, "title") {
+		m.Title = ""
+	}
+	if !containsString(fields, "year") {
+		m.Year = 0
+	}
+	if !containsString(fields, "runtime") {
+		m.Runtime = 0
+	}
+	if !containsString(fields, "genres") {
+		m.Genres = nil
+	}
+	if !containsString(fields, "version") {
+		m.Version = 0
+	}
+	if !containsString(fields, "average_rating") {
+		m.AverageRating = 0
+	}
+	if !containsString(fields, "rating_count") {
+		m.RatingCount = 0
+	}
+	if !containsString(fields, "poster") {
+		m.Poster = nil
+	}
+	if !containsString(fields, "match") {
+		m.Match = ""
+	}
 }
 
-func (m *MovieModel) Delete(id int64) error {
+func containsString(list []string, s string) bool {
+	for _, l := range list {
+		if l == s {
+			return true
+		}
+	}
+	return false
+}
+
+// sortValue return the value of the column used to sort as a string to store it in a cursor
+func (m *Movie) sortValue(column string) string {
+	switch column {
+	case "title":
+		return m.Title
+	case "year":
+		return strconv.Itoa(int(m.Year))
+	case "runtime":
+		return strconv.Itoa(int(m.Runtime))
+	case "rating":
+		return strconv.FormatFloat(float64(m.AverageRating), 'g', -1, 32)
+	case "relevance":
+		return strconv.FormatFloat(float64(m.relevance), 'g', -1, 32)
+	default:
+		return strconv.FormatInt(m.ID, 10)
+	}
+}
+
+// Delete move a movie to the trash, the movie is hidden until it is restored or purged and it is removed from
+// the lists. ErrEditConflict is returned when the movie was changed or deleted after it was read.
+func (m *MovieModel) Delete(movie *Movie, userID int64) error {
+	stmt := `
+	WITH movie AS (
+		UPDATE movies SET deleted_at = NOW() WHERE id = $1 AND version = $2 AND deleted_at IS NULL
+		RETURNING id, version, title, year, runtime, genres
+	), items AS (
+		DELETE FROM list_items WHERE movie_id IN (SELECT id FROM movie)
+	)
+	INSERT INTO movie_revisions (movie_id, version, action, user_id, title, year, runtime, genres)
+	SELECT id, version, 'delete', NULLIF($3::bigint, 0), title, year, runtime, genres FROM movie`
+
+	err := m.exec(stmt, movie.ID, movie.Version, userID)
+	if errors.Is(err, ErrRecordNotFound) {
+		return ErrEditConflict
+	}
+	return err
+}
+
+// Restore move a movie out of the trash
+func (m *MovieModel) Restore(id, userID int64) error {
 	if id < 1 {
 		return ErrRecordNotFound
 	}
 
-	stmt := `DELETE FROM movies WHERE id = $1`
+	stmt := `
+	WITH movie AS (
+		UPDATE movies SET deleted_at = NULL WHERE id = $1 AND deleted_at IS NOT NULL
+		RETURNING id, version, title, year, runtime, genres
+	)
+	INSERT INTO movie_revisions (movie_id, version, action, user_id, title, year, runtime, genres)
+	SELECT id, version, 'restore', NULLIF($2::bigint, 0), title, year, runtime, genres FROM movie`
+
+	return m.exec(stmt, id, userID)
+}
+
+// Purge remove a movie in the trash permanently, credits, reviews, revisions and list entries of the movie
+// are removed by ON DELETE CASCADE. The storage key of the poster is returned so its files can be removed.
+func (m *MovieModel) Purge(id int64) (string, error) {
+	if id < 1 {
+		return "", ErrRecordNotFound
+	}
+
+	stmt := `DELETE FROM movies WHERE id = $1 AND deleted_at IS NOT NULL RETURNING COALESCE(poster_key, '')`
 
 	ctx, cancel := context.WithTimeout(context.Background(), QueryTimeOut*time.Second)
 	defer cancel()
 
-	r, err := m.DB.ExecContext(ctx, stmt, id)
+	var key string
+	err := m.DB.QueryRowContext(ctx, stmt, id).Scan(&key)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return "", ErrRecordNotFound
+		default:
+			return "", err
+		}
+	}
+	return key, nil
+}
+
+// PurgeDeletedBefore remove permanently the movies moved to the trash before the given time, the storage keys
+// of the posters of the movies removed are returned
+func (m *MovieModel) PurgeDeletedBefore(t time.Time) (int64, []string, error) {
+	stmt := `DELETE FROM movies WHERE deleted_at < $1 RETURNING COALESCE(poster_key, '')`
+
+	ctx, cancel := context.WithTimeout(context.Background(), QueryTimeOut*time.Second)
+	defer cancel()
+
+	r, err := m.DB.QueryContext(ctx, stmt, t)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer r.Close()
+
+	var n int64
+	keys := []string{}
+	for r.Next() {
+		var key string
+		err = r.Scan(&key)
+		if err != nil {
+			return 0, nil, err
+		}
+		n++
+		if key != "" {
+			keys = append(keys, key)
+		}
+	}
+	if err = r.Err(); err != nil {
+		return 0, nil, err
+	}
+	return n, keys, nil
+}
+
+func (m *MovieModel) exec(stmt string, args ...interface{}) error {
+	ctx, cancel := context.WithTimeout(context.Background(), QueryTimeOut*time.Second)
+	defer cancel()
+
+	r, err := m.DB.ExecContext(ctx, stmt, args...)
 	if err != nil {
 		return err
 	}
@@ -163,3 +558,72 @@ func (m *MovieModel) Delete(id int64) error {
 	}
 	return nil
 }
+
+// GetTrash list the movies in the trash
+//
+//nolint:gosec
+func (m *MovieModel) GetTrash(filters Filters) ([]*Movie, Metadata, error) {
+	stmt := fmt.Sprintf(`SELECT count(*) OVER(), id, created_at, title, year, runtime, genres, version, deleted_at
+						FROM movies
+						WHERE deleted_at IS NOT NULL
+						ORDER BY %s %s, id ASC
+						LIMIT $1 OFFSET $2`, filters.sortColumn(), filters.sortDirection())
+
+	ctx, cancel := context.WithTimeout(context.Background(), QueryTimeOut*time.Second)
+	defer cancel()
+
+	r, err := m.DB.QueryContext(ctx, stmt, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer r.Close()
+
+	totalRecords := 0
+	movies := []*Movie{}
+	for r.Next() {
+		var movie Movie
+		err := r.Scan(&totalRecords, &movie.ID, &movie.CreatedAt, &movie.Title, &movie.Year, &movie.Runtime,
+			pq.Array(&movie.Genres), &movie.Version, &movie.DeletedAt)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		movies = append(movies, &movie)
+	}
+	if err := r.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+	metadata := calcMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return movies, metadata, nil
+}
+
+// Export stream the movies filtered by title and genres ordered by id, fn is called for every row. The query
+// is not limited by QueryTimeOut, it is cancelled when ctx is done or fn return an error
+func (m *MovieModel) Export(ctx context.Context, title string, genres []string, fn func(*Movie) error) error {
+	var b whereBuilder
+	movieConditions(&b, title, false, genres, 0, Filters{})
+	stmt := fmt.Sprintf(`SELECT id, created_at, title, year, runtime, genres, version, average_rating, rating_count,
+							poster
+						FROM movies
+						WHERE %s
+						ORDER BY id`, b.String()) //nolint:gosec
+
+	r, err := m.DB.QueryContext(ctx, stmt, b.args...)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	for r.Next() {
+		var movie Movie
+		err := r.Scan(&movie.ID, &movie.CreatedAt, &movie.Title, &movie.Year, &movie.Runtime,
+			pq.Array(&movie.Genres), &movie.Version, &movie.AverageRating, &movie.RatingCount, &movie.Poster)
+		if err != nil {
+			return err
+		}
+		if err := fn(&movie); err != nil {
+			return err
+		}
+	}
+	return r.Err()
+}
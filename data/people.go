@@ -0,0 +1,153 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/eze8789/movies-api/validator"
+)
+
+type Person struct {
+	ID        int64     `json:"id"`
+	CreatedAt time.Time `json:"-"`
+	Name      string    `json:"name"`
+	BirthYear int32     `json:"birth_year,omitempty"`
+	Version   int32     `json:"version"`
+}
+
+type PeopleModel struct {
+	*sql.DB
+}
+
+func ValidatePerson(v *validator.Validator, person *Person) {
+	v.Check(person.Name != "", "name", "must be provided")
+	v.Check(len(person.Name) <= 500, "name", "must not be more than 500 bytes long") //nolint:gomnd
+
+	v.Check(person.BirthYear >= 0, "birth_year", "must be a positive integer")
+	v.Check(person.BirthYear <= int32(time.Now().Year()), "birth_year", "must be less or equal current year")
+}
+
+func (pm *PeopleModel) Insert(person *Person) error {
+	stmt := `INSERT INTO people (name, birth_year)
+	VALUES ($1, $2)
+	RETURNING id, created_at, version`
+	args := []interface{}{person.Name, person.BirthYear}
+
+	ctx, cancel := context.WithTimeout(context.Background(), QueryTimeOut*time.Second)
+	defer cancel()
+
+	return pm.DB.QueryRowContext(ctx, stmt, args...).Scan(&person.ID, &person.CreatedAt, &person.Version)
+}
+
+func (pm *PeopleModel) Get(id int64) (*Person, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+	stmt := `SELECT id, created_at, name, birth_year, version
+	FROM people
+	WHERE id = $1`
+
+	var person Person
+
+	ctx, cancel := context.WithTimeout(context.Background(), QueryTimeOut*time.Second)
+	defer cancel()
+
+	err := pm.DB.QueryRowContext(ctx, stmt, id).Scan(&person.ID, &person.CreatedAt, &person.Name,
+		&person.BirthYear, &person.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &person, nil
+}
+
+//nolint:gosec
+func (pm *PeopleModel) GetAll(name string, filters Filters) ([]*Person, Metadata, error) {
+	stmt := fmt.Sprintf(`SELECT count(*) OVER(), id, created_at, name, birth_year, version
+						FROM people
+						WHERE (to_tsvector('simple', name) @@ plainto_tsquery('simple', $1) OR $1 = '')
+						ORDER BY %s %s, id ASC
+						LIMIT $2 OFFSET $3`, filters.sortColumn(), filters.sortDirection())
+	args := []interface{}{name, filters.limit(), filters.offset()}
+
+	ctx, cancel := context.WithTimeout(context.Background(), QueryTimeOut*time.Second)
+	defer cancel()
+
+	r, err := pm.DB.QueryContext(ctx, stmt, args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer r.Close()
+
+	totalRecords := 0
+	people := []*Person{}
+	for r.Next() {
+		var person Person
+		err := r.Scan(&totalRecords, &person.ID, &person.CreatedAt, &person.Name, &person.BirthYear, &person.Version)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		people = append(people, &person)
+	}
+	if err := r.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+	metadata := calcMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return people, metadata, nil
+}
+
+func (pm *PeopleModel) Update(person *Person) error {
+	stmt := `UPDATE people
+	SET name = $1, birth_year = $2, version = version + 1
+	WHERE id = $3 AND version = $4
+	RETURNING version`
+	args := []interface{}{person.Name, person.BirthYear, person.ID, person.Version}
+
+	ctx, cancel := context.WithTimeout(context.Background(), QueryTimeOut*time.Second)
+	defer cancel()
+
+	err := pm.DB.QueryRowContext(ctx, stmt, args...).Scan(&person.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+// Delete remove a person, the credits of the person are removed by the ON DELETE CASCADE constraint
+func (pm *PeopleModel) Delete(id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	stmt := `DELETE FROM people WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), QueryTimeOut*time.Second)
+	defer cancel()
+
+	r, err := pm.DB.ExecContext(ctx, stmt, id)
+	if err != nil {
+		return err
+	}
+
+	rows, err := r.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
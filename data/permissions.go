@@ -3,11 +3,16 @@ package data
 import (
 	"context"
 	"database/sql"
+	"fmt"
 	"time"
 
+	"github.com/eze8789/movies-api/validator"
 	"github.com/lib/pq"
 )
 
+// PermissionCodes hold the permission codes created by the migrations
+var PermissionCodes = []string{"movies:read", "movies:write", "movies:admin", "permissions:admin"}
+
 type Permissions []string
 
 type PermissionsModel struct {
@@ -23,17 +28,51 @@ func (p Permissions) Include(code string) bool {
 	return false
 }
 
+// ValidatePermissionCodes ensure at least one code is provided and every code exists
+func ValidatePermissionCodes(v *validator.Validator, codes []string) {
+	v.Check(len(codes) > 0, "permissions", "must provide at least one permission")
+	for _, c := range codes {
+		v.Check(v.In(c, PermissionCodes...), "permissions", fmt.Sprintf("invalid permission: %s", c))
+	}
+}
+
+// GetAll return every permission code sorted
+func (pm *PermissionsModel) GetAll() (Permissions, error) {
+	return pm.codes(`SELECT code FROM permissions ORDER BY code`)
+}
+
+// GetAllForUser return the permissions granted to a user directly or through the roles assigned, it is used
+// to authorize the requests
 func (pm *PermissionsModel) GetAllForUser(id int64) (Permissions, error) {
 	stmt := `SELECT permissions.code
 	FROM permissions
 	INNER JOIN user_permissions ON user_permissions.permission_id = permissions.id
-	INNER JOIN users ON user_permissions.user_id = users.id
-	WHERE users.id = $1`
+	WHERE user_permissions.user_id = $1
+	UNION
+	SELECT permissions.code
+	FROM permissions
+	INNER JOIN role_permissions ON role_permissions.permission_id = permissions.id
+	INNER JOIN user_roles ON user_roles.role_id = role_permissions.role_id
+	WHERE user_roles.user_id = $1
+	ORDER BY code`
+	return pm.codes(stmt, id)
+}
+
+// GetGrantedForUser return the permissions granted to a user directly, without the permissions of the roles
+func (pm *PermissionsModel) GetGrantedForUser(id int64) (Permissions, error) {
+	stmt := `SELECT permissions.code
+	FROM permissions
+	INNER JOIN user_permissions ON user_permissions.permission_id = permissions.id
+	WHERE user_permissions.user_id = $1
+	ORDER BY permissions.code`
+	return pm.codes(stmt, id)
+}
 
+func (pm *PermissionsModel) codes(stmt string, args ...interface{}) (Permissions, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), QueryTimeOut*time.Second)
 	defer cancel()
 
-	rows, err := pm.DB.QueryContext(ctx, stmt, id)
+	rows, err := pm.DB.QueryContext(ctx, stmt, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -54,9 +93,26 @@ func (pm *PermissionsModel) GetAllForUser(id int64) (Permissions, error) {
 	return perm, nil
 }
 
+// AddForUser grant the permissions to a user, the permissions already granted are ignored
 func (pm *PermissionsModel) AddForUser(id int64, perms ...string) error {
 	stmt := `INSERT INTO user_permissions
-	SELECT $1, permissions.id FROM permissions WHERE permissions.code = ANY($2)`
+	SELECT $1, permissions.id FROM permissions WHERE permissions.code = ANY($2)
+	ON CONFLICT DO NOTHING`
+	args := []interface{}{id, pq.Array(perms)}
+
+	ctx, cancel := context.WithTimeout(context.Background(), QueryTimeOut*time.Second)
+	defer cancel()
+
+	_, err := pm.DB.ExecContext(ctx, stmt, args...)
+	return err
+}
+
+// RemoveForUser revoke the permissions from a user
+func (pm *PermissionsModel) RemoveForUser(id int64, perms ...string) error {
+	stmt := `DELETE FROM user_permissions
+	USING permissions
+	WHERE user_permissions.permission_id = permissions.id AND user_permissions.user_id = $1
+	AND permissions.code = ANY($2)`
 	args := []interface{}{id, pq.Array(perms)}
 
 	ctx, cancel := context.WithTimeout(context.Background(), QueryTimeOut*time.Second)
@@ -0,0 +1,71 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Poster hold the url of the original image and of every thumbnail by size name
+type Poster map[string]string
+
+// Value store the poster as jsonb, movies without poster store NULL
+func (p Poster) Value() (driver.Value, error) {
+	if len(p) == 0 {
+		return nil, nil
+	}
+	b, err := json.Marshal(map[string]string(p))
+	return string(b), err
+}
+
+func (p *Poster) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		*p = nil
+		return nil
+	case []byte:
+		return json.Unmarshal(v, (*map[string]string)(p))
+	case string:
+		return json.Unmarshal([]byte(v), (*map[string]string)(p))
+	default:
+		return fmt.Errorf("unsupported poster value %T", src)
+	}
+}
+
+// SetPoster replace the poster of a movie when the version was not modified, the change is recorded as a
+// revision made by the user. The storage key of the previous poster is returned so its files can be removed.
+func (m *MovieModel) SetPoster(movie *Movie, key string, userID int64) (string, error) {
+	stmt := `
+	WITH previous AS (
+		SELECT poster_key FROM movies WHERE id = $3
+	), movie AS (
+		UPDATE movies
+		SET poster = $1, poster_key = $2, version = version + 1
+		WHERE id = $3 AND version = $4 AND deleted_at IS NULL
+		RETURNING id, version, title, year, runtime, genres
+	), revision AS (
+		INSERT INTO movie_revisions (movie_id, version, action, user_id, title, year, runtime, genres)
+		SELECT id, version, 'update', NULLIF($5::bigint, 0), title, year, runtime, genres FROM movie
+	)
+	SELECT movie.version, COALESCE(previous.poster_key, '') FROM movie, previous`
+	args := []interface{}{movie.Poster, key, movie.ID, movie.Version, userID}
+
+	ctx, cancel := context.WithTimeout(context.Background(), QueryTimeOut*time.Second)
+	defer cancel()
+
+	var previous string
+	err := m.DB.QueryRowContext(ctx, stmt, args...).Scan(&movie.Version, &previous)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return "", ErrEditConflict
+		default:
+			return "", err
+		}
+	}
+	return previous, nil
+}
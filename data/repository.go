@@ -0,0 +1,132 @@
+package data
+
+import (
+	"context"
+	"time"
+)
+
+// MovieRepository is implemented by MovieModel and by the in-memory and SQLite backends
+type MovieRepository interface {
+	Insert(movie *Movie, userID int64) error
+	InsertAll(movies []*Movie, userID int64) error
+	Update(movie *Movie, userID int64) error
+	SetPoster(movie *Movie, key string, userID int64) (string, error)
+	Get(id int64) (*Movie, error)
+	GetFields(id int64, fields []string) (*Movie, error)
+	GetAll(title string, genres []string, personID int64, filters Filters) ([]*Movie, Metadata, error)
+	GetFacets(title string, genres []string, personID int64, fuzzy bool, filters Filters) (map[string][]FacetCount, error)
+	GetTrash(filters Filters) ([]*Movie, Metadata, error)
+	Export(ctx context.Context, title string, genres []string, fn func(*Movie) error) error
+	Delete(movie *Movie, userID int64) error
+	Restore(id, userID int64) error
+	Purge(id int64) (string, error)
+	PurgeDeletedBefore(t time.Time) (int64, []string, error)
+}
+
+// UserRepository is implemented by UserModel and by the in-memory and SQLite backends
+type UserRepository interface {
+	Insert(user *User) error
+	Update(user *User) error
+	Get(id int64) (*User, error)
+	GetByEmail(e string) (*User, error)
+	GetForToken(token, scope string) (*User, error)
+	DeleteScheduledBefore(t time.Time) ([]int64, error)
+}
+
+// TokenRepository is implemented by TokensModel and by the in-memory and SQLite backends
+type TokenRepository interface {
+	Insert(token *Token) error
+	New(userID int64, ttl time.Duration, scope string) (*Token, error)
+	NewForEmail(userID int64, ttl time.Duration, scope, email string) (*Token, error)
+	Get(tokenPlain, scope string) (*Token, error)
+	GetAllForUser(userID int64) ([]*Token, error)
+	DeleteAllByUser(userID int64, scope string) error
+	DeleteAllForUser(userID int64) error
+}
+
+// PermissionRepository is implemented by PermissionsModel and by the in-memory and SQLite backends
+type PermissionRepository interface {
+	GetAll() (Permissions, error)
+	GetAllForUser(id int64) (Permissions, error)
+	GetGrantedForUser(id int64) (Permissions, error)
+	AddForUser(id int64, perms ...string) error
+	RemoveForUser(id int64, perms ...string) error
+}
+
+// GenreRepository is implemented by GenreModel and by the in-memory and SQLite backends, the movies handlers use the
+// catalogue to normalize the genres
+type GenreRepository interface {
+	Index() (GenreIndex, error)
+	Insert(genre *Genre) error
+	GetAll() ([]*Genre, error)
+	Get(id int64) (*Genre, error)
+	Update(genre *Genre) error
+	Delete(id int64) error
+	Merge(genre, source *Genre, userID int64) (int64, error)
+}
+
+// CreditRepository is implemented by CreditModel and by the in-memory and SQLite backends, the movies handlers embed
+// the credits in the responses
+type CreditRepository interface {
+	Insert(credit *Credit) error
+	GetForMovie(movieID int64) ([]*Credit, error)
+	GetForMovies(movieIDs []int64) (map[int64][]*Credit, error)
+	GetForPerson(personID int64, roles []string) ([]*Credit, error)
+	Delete(movieID, id int64) error
+}
+
+// RoleRepository is implemented by RoleModel and by the in-memory and SQLite backends
+type RoleRepository interface {
+	Insert(role *Role) error
+	GetAll() ([]*Role, error)
+	Get(id int64) (*Role, error)
+	GetAllForUser(userID int64) ([]*Role, error)
+	Update(role *Role) error
+	Delete(id int64) error
+	AddForUser(userID, roleID int64) error
+	RemoveForUser(userID, roleID int64) error
+}
+
+// PeopleRepository is implemented by PeopleModel and by the in-memory and SQLite backends
+type PeopleRepository interface {
+	Insert(person *Person) error
+	Get(id int64) (*Person, error)
+	GetAll(name string, filters Filters) ([]*Person, Metadata, error)
+	Update(person *Person) error
+	Delete(id int64) error
+}
+
+// ReviewRepository is implemented by ReviewModel and by the in-memory and SQLite backends, the backends keep the
+// rating aggregates of the movies with the reviews
+type ReviewRepository interface {
+	Insert(review *Review) error
+	GetForUser(movieID, userID int64) (*Review, error)
+	GetAllForUser(userID int64) ([]*Review, error)
+	GetAllForMovie(movieID int64, filters Filters) ([]*Review, Metadata, error)
+	Update(review *Review) error
+	Delete(review *Review) error
+}
+
+// ListRepository is implemented by ListModel and by the in-memory and SQLite backends
+type ListRepository interface {
+	EnsureDefault(userID int64) error
+	Insert(list *List) error
+	GetAllForUser(userID int64) ([]*List, error)
+	Get(id, userID int64) (*List, error)
+	GetBySlug(slug string) (*List, error)
+	Update(list *List) error
+	Delete(id, userID int64) error
+	GetItems(listID int64) ([]*ListItem, error)
+	AddItem(listID, movieID int64) error
+	RemoveItem(listID, movieID int64) error
+	SetWatched(listID, movieID int64, watchedAt *time.Time) error
+	Reorder(listID int64, movieIDs []int64) error
+}
+
+// RevisionRepository is implemented by RevisionModel and by the in-memory and SQLite backends, the revisions are
+// recorded by the movie repository of the backend
+type RevisionRepository interface {
+	GetAllForMovie(movieID int64, filters Filters) ([]*Revision, Metadata, error)
+	GetAllForUser(userID int64) ([]*Revision, error)
+	Get(movieID int64, version int32) (*Revision, error)
+}
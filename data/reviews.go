@@ -0,0 +1,199 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/eze8789/movies-api/validator"
+)
+
+const (
+	ErrReviewConstraintPG = `pq: duplicate key value violates unique constraint "reviews_movie_id_user_id_key"`
+)
+
+type Review struct {
+	ID        int64     `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	MovieID   int64     `json:"movie_id"`
+	UserID    int64     `json:"user_id"`
+	UserName  string    `json:"user_name,omitempty"`
+	Rating    int32     `json:"rating"`
+	Body      string    `json:"body,omitempty"`
+	Version   int32     `json:"version"`
+}
+
+// ReviewModel store the user reviews, the rating aggregates of the movies are updated
+// by the reviews_rating_aggregate trigger in the same transaction
+type ReviewModel struct {
+	*sql.DB
+}
+
+func ValidateReview(v *validator.Validator, review *Review) {
+	v.Check(review.Rating >= 1, "rating", "must be between 1 and 10")
+	v.Check(review.Rating <= 10, "rating", "must be between 1 and 10") //nolint:gomnd
+
+	v.Check(len(review.Body) <= 10_000, "body", "must not be more than 10000 bytes long") //nolint:gomnd
+}
+
+func (rm *ReviewModel) Insert(review *Review) error {
+	stmt := `INSERT INTO reviews (movie_id, user_id, rating, body)
+	VALUES ($1, $2, $3, $4)
+	RETURNING id, created_at, version`
+	args := []interface{}{review.MovieID, review.UserID, review.Rating, review.Body}
+
+	ctx, cancel := context.WithTimeout(context.Background(), QueryTimeOut*time.Second)
+	defer cancel()
+
+	err := rm.DB.QueryRowContext(ctx, stmt, args...).Scan(&review.ID, &review.CreatedAt, &review.Version)
+	if err != nil {
+		switch {
+		case err.Error() == ErrReviewConstraintPG:
+			return ErrDuplicatedReview
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+// GetForUser return the review a user wrote for a movie
+func (rm *ReviewModel) GetForUser(movieID, userID int64) (*Review, error) {
+	stmt := `SELECT id, created_at, movie_id, user_id, rating, body, version
+	FROM reviews
+	WHERE movie_id = $1 AND user_id = $2`
+
+	var review Review
+
+	ctx, cancel := context.WithTimeout(context.Background(), QueryTimeOut*time.Second)
+	defer cancel()
+
+	err := rm.DB.QueryRowContext(ctx, stmt, movieID, userID).Scan(&review.ID, &review.CreatedAt, &review.MovieID,
+		&review.UserID, &review.Rating, &review.Body, &review.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &review, nil
+}
+
+// GetAllForUser return every review written by a user, the newest first
+func (rm *ReviewModel) GetAllForUser(userID int64) ([]*Review, error) {
+	stmt := `SELECT id, created_at, movie_id, user_id, rating, body, version
+	FROM reviews
+	WHERE user_id = $1
+	ORDER BY created_at DESC, id DESC`
+
+	ctx, cancel := context.WithTimeout(context.Background(), QueryTimeOut*time.Second)
+	defer cancel()
+
+	r, err := rm.DB.QueryContext(ctx, stmt, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	reviews := []*Review{}
+	for r.Next() {
+		var review Review
+		err = r.Scan(&review.ID, &review.CreatedAt, &review.MovieID, &review.UserID, &review.Rating, &review.Body,
+			&review.Version)
+		if err != nil {
+			return nil, err
+		}
+		reviews = append(reviews, &review)
+	}
+	if err := r.Err(); err != nil {
+		return nil, err
+	}
+	return reviews, nil
+}
+
+//nolint:gosec
+func (rm *ReviewModel) GetAllForMovie(movieID int64, filters Filters) ([]*Review, Metadata, error) {
+	stmt := fmt.Sprintf(`SELECT count(*) OVER(), reviews.id, reviews.created_at, reviews.movie_id, reviews.user_id,
+						users.name, reviews.rating, reviews.body, reviews.version
+						FROM reviews
+						INNER JOIN users ON users.id = reviews.user_id
+						WHERE reviews.movie_id = $1
+						ORDER BY reviews.%s %s, reviews.id ASC
+						LIMIT $2 OFFSET $3`, filters.sortColumn(), filters.sortDirection())
+	args := []interface{}{movieID, filters.limit(), filters.offset()}
+
+	ctx, cancel := context.WithTimeout(context.Background(), QueryTimeOut*time.Second)
+	defer cancel()
+
+	r, err := rm.DB.QueryContext(ctx, stmt, args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer r.Close()
+
+	totalRecords := 0
+	reviews := []*Review{}
+	for r.Next() {
+		var review Review
+		err := r.Scan(&totalRecords, &review.ID, &review.CreatedAt, &review.MovieID, &review.UserID, &review.UserName,
+			&review.Rating, &review.Body, &review.Version)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		reviews = append(reviews, &review)
+	}
+	if err := r.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+	metadata := calcMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return reviews, metadata, nil
+}
+
+func (rm *ReviewModel) Update(review *Review) error {
+	stmt := `UPDATE reviews
+	SET rating = $1, body = $2, version = version + 1
+	WHERE id = $3 AND version = $4
+	RETURNING version`
+	args := []interface{}{review.Rating, review.Body, review.ID, review.Version}
+
+	ctx, cancel := context.WithTimeout(context.Background(), QueryTimeOut*time.Second)
+	defer cancel()
+
+	err := rm.DB.QueryRowContext(ctx, stmt, args...).Scan(&review.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+// Delete remove a review using the version to avoid deleting a review changed after it was read
+func (rm *ReviewModel) Delete(review *Review) error {
+	stmt := `DELETE FROM reviews WHERE id = $1 AND version = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), QueryTimeOut*time.Second)
+	defer cancel()
+
+	r, err := rm.DB.ExecContext(ctx, stmt, review.ID, review.Version)
+	if err != nil {
+		return err
+	}
+
+	rows, err := r.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrEditConflict
+	}
+	return nil
+}
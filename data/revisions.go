@@ -0,0 +1,205 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const (
+	RevisionInsert  = "insert"
+	RevisionUpdate  = "update"
+	RevisionDelete  = "delete"
+	RevisionRestore = "restore"
+)
+
+// Revision hold the values of a movie after a change and the user who made it
+type Revision struct {
+	ID        int64     `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	MovieID   int64     `json:"movie_id"`
+	Version   int32     `json:"version"`
+	Action    string    `json:"action"`
+	UserID    *int64    `json:"user_id,omitempty"`
+	UserName  *string   `json:"user_name,omitempty"`
+	Title     string    `json:"title"`
+	Year      int32     `json:"year"`
+	Runtime   Runtime   `json:"runtime"`
+	Genres    []string  `json:"genres"`
+}
+
+// FieldChange hold the values of a field in two revisions, for lists the added and removed values are included
+type FieldChange struct {
+	From    interface{} `json:"from"`
+	To      interface{} `json:"to"`
+	Added   []string    `json:"added,omitempty"`
+	Removed []string    `json:"removed,omitempty"`
+}
+
+// RevisionModel read the history of the movies, the revisions are written by MovieModel in the same
+// statement that change the movie
+type RevisionModel struct {
+	*sql.DB
+}
+
+// Diff return the fields changed between two revisions
+func (rev *Revision) Diff(to *Revision) map[string]FieldChange {
+	changes := make(map[string]FieldChange)
+
+	if rev.Title != to.Title {
+		changes["title"] = FieldChange{From: rev.Title, To: to.Title}
+	}
+	if rev.Year != to.Year {
+		changes["year"] = FieldChange{From: rev.Year, To: to.Year}
+	}
+	if rev.Runtime != to.Runtime {
+		changes["runtime"] = FieldChange{From: rev.Runtime, To: to.Runtime}
+	}
+
+	if !equalStrings(rev.Genres, to.Genres) {
+		added, removed := diffStrings(rev.Genres, to.Genres)
+		changes["genres"] = FieldChange{From: rev.Genres, To: to.Genres, Added: added, Removed: removed}
+	}
+
+	return changes
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// diffStrings return the values only present in b and the values only present in a
+func diffStrings(a, b []string) (added, removed []string) {
+	inA := make(map[string]bool, len(a))
+	for _, s := range a {
+		inA[s] = true
+	}
+	inB := make(map[string]bool, len(b))
+	for _, s := range b {
+		inB[s] = true
+		if !inA[s] {
+			added = append(added, s)
+		}
+	}
+	for _, s := range a {
+		if !inB[s] {
+			removed = append(removed, s)
+		}
+	}
+	return added, removed
+}
+
+//nolint:gosec
+func (rm *RevisionModel) GetAllForMovie(movieID int64, filters Filters) ([]*Revision, Metadata, error) {
+	stmt := fmt.Sprintf(`SELECT count(*) OVER(), movie_revisions.id, movie_revisions.created_at, movie_revisions.movie_id,
+						movie_revisions.version, movie_revisions.action, movie_revisions.user_id, users.name,
+						movie_revisions.title, movie_revisions.year, movie_revisions.runtime, movie_revisions.genres
+						FROM movie_revisions
+						LEFT JOIN users ON users.id = movie_revisions.user_id
+						WHERE movie_revisions.movie_id = $1
+						ORDER BY movie_revisions.%s %s, movie_revisions.id %s
+						LIMIT $2 OFFSET $3`, filters.sortColumn(), filters.sortDirection(), filters.sortDirection())
+	args := []interface{}{movieID, filters.limit(), filters.offset()}
+
+	ctx, cancel := context.WithTimeout(context.Background(), QueryTimeOut*time.Second)
+	defer cancel()
+
+	r, err := rm.DB.QueryContext(ctx, stmt, args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer r.Close()
+
+	totalRecords := 0
+	revisions := []*Revision{}
+	for r.Next() {
+		var rev Revision
+		err := r.Scan(&totalRecords, &rev.ID, &rev.CreatedAt, &rev.MovieID, &rev.Version, &rev.Action, &rev.UserID,
+			&rev.UserName, &rev.Title, &rev.Year, &rev.Runtime, pq.Array(&rev.Genres))
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		revisions = append(revisions, &rev)
+	}
+	if err := r.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+	metadata := calcMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return revisions, metadata, nil
+}
+
+// GetAllForUser return the revisions of the changes made by a user, the newest first
+func (rm *RevisionModel) GetAllForUser(userID int64) ([]*Revision, error) {
+	stmt := `SELECT id, created_at, movie_id, version, action, user_id, title, year, runtime, genres
+	FROM movie_revisions
+	WHERE user_id = $1
+	ORDER BY created_at DESC, id DESC`
+
+	ctx, cancel := context.WithTimeout(context.Background(), QueryTimeOut*time.Second)
+	defer cancel()
+
+	r, err := rm.DB.QueryContext(ctx, stmt, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	revisions := []*Revision{}
+	for r.Next() {
+		var rev Revision
+		err = r.Scan(&rev.ID, &rev.CreatedAt, &rev.MovieID, &rev.Version, &rev.Action, &rev.UserID, &rev.Title,
+			&rev.Year, &rev.Runtime, pq.Array(&rev.Genres))
+		if err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, &rev)
+	}
+	if err := r.Err(); err != nil {
+		return nil, err
+	}
+	return revisions, nil
+}
+
+// Get return the revision that created a version of a movie
+func (rm *RevisionModel) Get(movieID int64, version int32) (*Revision, error) {
+	stmt := `SELECT movie_revisions.id, movie_revisions.created_at, movie_revisions.movie_id, movie_revisions.version,
+	movie_revisions.action, movie_revisions.user_id, users.name, movie_revisions.title, movie_revisions.year,
+	movie_revisions.runtime, movie_revisions.genres
+	FROM movie_revisions
+	LEFT JOIN users ON users.id = movie_revisions.user_id
+	WHERE movie_revisions.movie_id = $1 AND movie_revisions.version = $2
+	AND movie_revisions.action IN ('insert', 'update')
+	ORDER BY movie_revisions.id
+	LIMIT 1`
+
+	var rev Revision
+
+	ctx, cancel := context.WithTimeout(context.Background(), QueryTimeOut*time.Second)
+	defer cancel()
+
+	err := rm.DB.QueryRowContext(ctx, stmt, movieID, version).Scan(&rev.ID, &rev.CreatedAt, &rev.MovieID,
+		&rev.Version, &rev.Action, &rev.UserID, &rev.UserName, &rev.Title, &rev.Year, &rev.Runtime,
+		pq.Array(&rev.Genres))
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &rev, nil
+}
@@ -0,0 +1,217 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/eze8789/movies-api/validator"
+	"github.com/lib/pq"
+)
+
+const ErrRoleNameConstraint = `pq: duplicate key value violates unique constraint "roles_name_key"`
+
+// Role is a named bundle of permissions, the users assigned to a role get all its permissions
+type Role struct {
+	ID          int64       `json:"id"`
+	CreatedAt   time.Time   `json:"-"`
+	Name        string      `json:"name"`
+	Permissions Permissions `json:"permissions"`
+	Version     int32       `json:"version"`
+}
+
+type RoleModel struct {
+	*sql.DB
+}
+
+func ValidateRole(v *validator.Validator, role *Role) {
+	v.Check(role.Name != "", "name", "must be provided")
+	v.Check(validator.Matches(role.Name, SlugRX), "name", "must only contain lowercase letters, numbers and dashes")
+	v.Check(len(role.Name) <= 100, "name", "must not be more than 100 bytes long") //nolint:gomnd
+
+	v.Check(v.Unique(role.Permissions), "permissions", "permissions must be unique")
+	ValidatePermissionCodes(v, role.Permissions)
+}
+
+// Insert create a role with its permissions, ErrDuplicatedRole is returned when the name is used
+func (rm *RoleModel) Insert(role *Role) error {
+	stmt := `
+	WITH role AS (
+		INSERT INTO roles (name)
+		VALUES ($1)
+		RETURNING id, created_at, version
+	), granted AS (
+		INSERT INTO role_permissions
+		SELECT role.id, permissions.id FROM role, permissions WHERE permissions.code = ANY($2)
+	)
+	SELECT id, created_at, version FROM role`
+	args := []interface{}{role.Name, pq.Array(role.Permissions)}
+
+	ctx, cancel := context.WithTimeout(context.Background(), QueryTimeOut*time.Second)
+	defer cancel()
+
+	err := rm.DB.QueryRowContext(ctx, stmt, args...).Scan(&role.ID, &role.CreatedAt, &role.Version)
+	if err != nil {
+		switch {
+		case err.Error() == ErrRoleNameConstraint:
+			return ErrDuplicatedRole
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+// roleSelect select the roles with their permission codes sorted, the conditions are added by the callers
+const roleSelect = `SELECT roles.id, roles.created_at, roles.name,
+	COALESCE(array_agg(permissions.code ORDER BY permissions.code) FILTER (WHERE permissions.code IS NOT NULL), '{}'),
+	roles.version
+	FROM roles
+	LEFT JOIN role_permissions ON role_permissions.role_id = roles.id
+	LEFT JOIN permissions ON permissions.id = role_permissions.permission_id`
+
+func (rm *RoleModel) query(stmt string, args ...interface{}) ([]*Role, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), QueryTimeOut*time.Second)
+	defer cancel()
+
+	rows, err := rm.DB.QueryContext(ctx, stmt, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	roles := []*Role{}
+	for rows.Next() {
+		var role Role
+		err = rows.Scan(&role.ID, &role.CreatedAt, &role.Name, pq.Array(&role.Permissions), &role.Version)
+		if err != nil {
+			return nil, err
+		}
+		roles = append(roles, &role)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return roles, nil
+}
+
+// GetAll return the roles sorted by name
+func (rm *RoleModel) GetAll() ([]*Role, error) {
+	return rm.query(roleSelect + `
+	GROUP BY roles.id
+	ORDER BY roles.name`)
+}
+
+func (rm *RoleModel) Get(id int64) (*Role, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+	roles, err := rm.query(roleSelect+`
+	WHERE roles.id = $1
+	GROUP BY roles.id`, id)
+	if err != nil {
+		return nil, err
+	}
+	if len(roles) == 0 {
+		return nil, ErrRecordNotFound
+	}
+	return roles[0], nil
+}
+
+// GetAllForUser return the roles assigned to a user sorted by name
+func (rm *RoleModel) GetAllForUser(userID int64) ([]*Role, error) {
+	return rm.query(roleSelect+`
+	WHERE roles.id IN (SELECT role_id FROM user_roles WHERE user_id = $1)
+	GROUP BY roles.id
+	ORDER BY roles.name`, userID)
+}
+
+// Update change the name and permissions of a role when the version was not modified, the permissions
+// removed are revoked and the new ones granted in the same statement
+func (rm *RoleModel) Update(role *Role) error {
+	stmt := `
+	WITH role AS (
+		UPDATE roles
+		SET name = $1, version = version + 1
+		WHERE id = $3 AND version = $4
+		RETURNING id, version
+	), revoked AS (
+		DELETE FROM role_permissions
+		USING role, permissions
+		WHERE role_permissions.role_id = role.id AND role_permissions.permission_id = permissions.id
+		AND NOT permissions.code = ANY($2)
+	), granted AS (
+		INSERT INTO role_permissions
+		SELECT role.id, permissions.id FROM role, permissions WHERE permissions.code = ANY($2)
+		ON CONFLICT DO NOTHING
+	)
+	SELECT version FROM role`
+	args := []interface{}{role.Name, pq.Array(role.Permissions), role.ID, role.Version}
+
+	ctx, cancel := context.WithTimeout(context.Background(), QueryTimeOut*time.Second)
+	defer cancel()
+
+	err := rm.DB.QueryRowContext(ctx, stmt, args...).Scan(&role.Version)
+	if err != nil {
+		switch {
+		case err.Error() == ErrRoleNameConstraint:
+			return ErrDuplicatedRole
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+// Delete remove a role, the users assigned lose its permissions
+func (rm *RoleModel) Delete(id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	stmt := `DELETE FROM roles WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), QueryTimeOut*time.Second)
+	defer cancel()
+
+	r, err := rm.DB.ExecContext(ctx, stmt, id)
+	if err != nil {
+		return err
+	}
+
+	rows, err := r.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// AddForUser assign a role to a user, assigning a role twice is ignored
+func (rm *RoleModel) AddForUser(userID, roleID int64) error {
+	stmt := `INSERT INTO user_roles (user_id, role_id)
+	VALUES ($1, $2)
+	ON CONFLICT DO NOTHING`
+
+	ctx, cancel := context.WithTimeout(context.Background(), QueryTimeOut*time.Second)
+	defer cancel()
+
+	_, err := rm.DB.ExecContext(ctx, stmt, userID, roleID)
+	return err
+}
+
+// RemoveForUser unassign a role from a user
+func (rm *RoleModel) RemoveForUser(userID, roleID int64) error {
+	stmt := `DELETE FROM user_roles WHERE user_id = $1 AND role_id = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), QueryTimeOut*time.Second)
+	defer cancel()
+
+	_, err := rm.DB.ExecContext(ctx, stmt, userID, roleID)
+	return err
+}
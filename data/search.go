@@ -0,0 +1,87 @@
+package data
+
+import (
+	"strings"
+	"unicode"
+)
+
+// similarityThreshold is the default threshold used by the pg_trgm % operator
+const similarityThreshold = 0.3
+
+// searchTerms split a text in lowercase words like the simple text search configuration
+func searchTerms(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// textRank report if the title contains every term and return the fraction of the title words matched
+func textRank(title string, terms []string) (float32, bool) {
+	if len(terms) == 0 {
+		return 0, false
+	}
+	words := searchTerms(title)
+	for _, t := range terms {
+		if !containsString(words, t) {
+			return 0, false
+		}
+	}
+	return float32(len(terms)) / float32(len(words)), true
+}
+
+// highlight wrap the words of the title matching the terms in <b> tags like ts_headline
+func highlight(title string, terms []string) string {
+	var b strings.Builder
+	start := -1
+	word := func(end int) {
+		w := title[start:end]
+		if containsString(terms, strings.ToLower(w)) {
+			w = "<b>" + w + "</b>"
+		}
+		b.WriteString(w)
+	}
+	for i, r := range title {
+		isWord := unicode.IsLetter(r) || unicode.IsDigit(r)
+		switch {
+		case isWord && start < 0:
+			start = i
+		case !isWord && start >= 0:
+			word(i)
+			start = -1
+		}
+		if !isWord {
+			b.WriteRune(r)
+		}
+	}
+	if start >= 0 {
+		word(len(title))
+	}
+	return b.String()
+}
+
+// similarity return the trigram similarity of two texts like pg_trgm
+func similarity(a, b string) float32 {
+	ta, tb := trigrams(a), trigrams(b)
+	if len(ta) == 0 || len(tb) == 0 {
+		return 0
+	}
+	common := 0
+	for t := range ta {
+		if tb[t] {
+			common++
+		}
+	}
+	return float32(common) / float32(len(ta)+len(tb)-common)
+}
+
+// trigrams return the trigrams of every word padded with two spaces before and one after
+func trigrams(s string) map[string]bool {
+	t := make(map[string]bool)
+	for _, w := range searchTerms(s) {
+		r := []rune("  " + w + " ")
+		for i := 0; i+3 <= len(r); i++ {
+			t[string(r[i:i+3])] = true
+		}
+	}
+	return t
+}
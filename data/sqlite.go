@@ -0,0 +1,505 @@
+package data
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+const (
+	// SQLiteDriver is registered with the functions used by the SQLite models, FTS5 needs the sqlite_fts5 build tag
+	SQLiteDriver = "sqlite3_movies"
+
+	ErrEmailConstraintSQLite     = "UNIQUE constraint failed: users.email"
+	ErrGenreSlugConstraintSQLite = "UNIQUE constraint failed: genres.slug"
+	ErrRoleNameConstraintSQLite  = "UNIQUE constraint failed: roles.name"
+	ErrReviewConstraintSQLite    = "UNIQUE constraint failed: reviews.movie_id, reviews.user_id"
+	ErrListNameConstraintSQLite  = "UNIQUE constraint failed: lists.user_id, lists.name"
+	ErrListItemConstraintSQLite  = "UNIQUE constraint failed: list_items.list_id, list_items.movie_id"
+
+	sqliteTimeFormat = "2006-01-02 15:04:05"
+)
+
+func init() {
+	sql.Register(SQLiteDriver, &sqlite3.SQLiteDriver{
+		ConnectHook: func(conn *sqlite3.SQLiteConn) error {
+			// similarity replace the pg_trgm function used by the fuzzy title search
+			err := conn.RegisterFunc("similarity", func(a, b string) float64 {
+				return float64(similarity(a, b))
+			}, true)
+			if err != nil {
+				return err
+			}
+			// words_match replace the simple text search of the people names, every word must be in the text
+			return conn.RegisterFunc("words_match", func(text, query string) bool {
+				_, ok := textRank(text, searchTerms(query))
+				return ok
+			}, true)
+		},
+	})
+}
+
+// SQLiteDSN return the DSN of the driver for a database file, foreign keys are enabled to cascade the deletes
+// and WAL allow reads while a write is in progress
+func SQLiteDSN(path string) string {
+	sep := "?"
+	if strings.Contains(path, "?") {
+		sep = "&"
+	}
+	return fmt.Sprintf("file:%s%s_foreign_keys=on&_busy_timeout=5000&_journal_mode=WAL&_txlock=immediate", path, sep)
+}
+
+// ErrSQLiteFTS5 is returned by CheckSQLite when the driver was built without FTS5
+var ErrSQLiteFTS5 = errors.New("sqlite was built without FTS5, build with cgo and the sqlite_fts5 tag")
+
+// CheckSQLite report if the driver can run the SQLite models, the title search need FTS5 and it is only compiled
+// with the sqlite_fts5 build tag
+func CheckSQLite(db *sql.DB) error {
+	ctx, cancel := context.WithTimeout(context.Background(), QueryTimeOut*time.Second)
+	defer cancel()
+
+	var fts5 bool
+	err := db.QueryRowContext(ctx, `SELECT sqlite_compileoption_used('ENABLE_FTS5')`).Scan(&fts5)
+	if err != nil {
+		return err
+	}
+	if !fts5 {
+		return ErrSQLiteFTS5
+	}
+	return nil
+}
+
+// NewSQLiteModels return the repositories stored in SQLite
+func NewSQLiteModels(db *sql.DB) Models {
+	return Models{
+		Backend:     BackendSQLite,
+		Movies:      &sqliteMovies{DB: db},
+		Users:       &sqliteUsers{DB: db},
+		Tokens:      &sqliteTokens{DB: db},
+		Permissions: &sqlitePermissions{DB: db},
+		Roles:       &sqliteRoles{DB: db},
+		People:      &sqlitePeople{DB: db},
+		Credits:     &sqliteCredits{DB: db},
+		Reviews:     &sqliteReviews{DB: db},
+		Lists:       &sqliteLists{DB: db},
+		Revisions:   &sqliteRevisions{DB: db},
+		Genres:      &sqliteGenres{DB: db},
+	}
+}
+
+// sqliteTime format a time like CURRENT_TIMESTAMP so the stored times can be compared as text
+func sqliteTime(t time.Time) string {
+	return t.UTC().Format(sqliteTimeFormat)
+}
+
+// sqliteJSON encode a value used as a JSON parameter
+func sqliteJSON(v interface{}) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "null"
+	}
+	return string(b)
+}
+
+// jsonArray store a list of strings as a JSON array, SQLite has no array type
+type jsonArray struct {
+	v *[]string
+}
+
+func (a jsonArray) Value() (driver.Value, error) {
+	if *a.v == nil {
+		return "[]", nil
+	}
+	b, err := json.Marshal(*a.v)
+	return string(b), err
+}
+
+func (a jsonArray) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case string:
+		return json.Unmarshal([]byte(v), a.v)
+	case []byte:
+		return json.Unmarshal(v, a.v)
+	default:
+		return fmt.Errorf("unsupported array value %T", src)
+	}
+}
+
+// sqliteExec run a statement and return ErrRecordNotFound when no row is affected
+func sqliteExec(db *sql.DB, stmt string, args ...interface{}) error {
+	ctx, cancel := context.WithTimeout(context.Background(), QueryTimeOut*time.Second)
+	defer cancel()
+
+	r, err := db.ExecContext(ctx, stmt, args...)
+	if err != nil {
+		return err
+	}
+
+	rows, err := r.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+type sqliteUsers struct {
+	*sql.DB
+}
+
+const sqliteUserColumns = "id, created_at, name, email, password_hash, activated, delete_after, version"
+
+func (u *User) sqliteDest() []interface{} {
+	return []interface{}{&u.ID, &u.CreatedAT, &u.Name, &u.Email, &u.Password.hashedPWD, &u.Activated, &u.DeleteAfter,
+		&u.Version}
+}
+
+func (su *sqliteUsers) Insert(user *User) error {
+	stmt := `INSERT INTO users (name, email, password_hash, activated)
+	VALUES (?, ?, ?, ?)
+	RETURNING id, created_at, version`
+	args := []interface{}{user.Name, user.Email, user.Password.hashedPWD, user.Activated}
+
+	ctx, cancel := context.WithTimeout(context.Background(), QueryTimeOut*time.Second)
+	defer cancel()
+
+	err := su.DB.QueryRowContext(ctx, stmt, args...).Scan(&user.ID, &user.CreatedAT, &user.Version)
+	if err != nil {
+		switch {
+		case err.Error() == ErrEmailConstraintSQLite:
+			return ErrDuplicatedEmail
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+func (su *sqliteUsers) Update(user *User) error {
+	stmt := `UPDATE users
+	SET name = ?, email = ?, password_hash = ?, activated = ?, delete_after = ?, version = version + 1
+	WHERE id = ? AND version = ?
+	RETURNING version`
+	var deleteAfter interface{}
+	if user.DeleteAfter != nil {
+		deleteAfter = sqliteTime(*user.DeleteAfter)
+	}
+	args := []interface{}{user.Name, user.Email, user.Password.hashedPWD, user.Activated, deleteAfter, user.ID,
+		user.Version}
+
+	ctx, cancel := context.WithTimeout(context.Background(), QueryTimeOut*time.Second)
+	defer cancel()
+
+	err := su.DB.QueryRowContext(ctx, stmt, args...).Scan(&user.Version)
+	if err != nil {
+		switch {
+		case err.Error() == ErrEmailConstraintSQLite:
+			return ErrDuplicatedEmail
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+func (su *sqliteUsers) Get(id int64) (*User, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+	stmt := fmt.Sprintf(`SELECT %s FROM users WHERE id = ?`, sqliteUserColumns)
+
+	ctx, cancel := context.WithTimeout(context.Background(), QueryTimeOut*time.Second)
+	defer cancel()
+
+	var user User
+	err := su.DB.QueryRowContext(ctx, stmt, id).Scan(user.sqliteDest()...)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &user, nil
+}
+
+// GetByEmail find a user ignoring the case of the email, the column use the NOCASE collation
+func (su *sqliteUsers) GetByEmail(e string) (*User, error) {
+	stmt := fmt.Sprintf(`SELECT %s FROM users WHERE email = ?`, sqliteUserColumns)
+
+	ctx, cancel := context.WithTimeout(context.Background(), QueryTimeOut*time.Second)
+	defer cancel()
+
+	var user User
+	err := su.DB.QueryRowContext(ctx, stmt, e).Scan(user.sqliteDest()...)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &user, nil
+}
+
+func (su *sqliteUsers) GetForToken(token, scope string) (*User, error) {
+	tokenHash := sha256.Sum256([]byte(token))
+
+	stmt := `SELECT users.id, users.created_at, users.name, users.email, users.password_hash, users.activated,
+	users.delete_after, users.version, tokens.expiry
+	FROM users
+	INNER JOIN tokens
+	ON users.id = tokens.user_id
+	WHERE tokens.hash = ? AND tokens.scope = ? AND tokens.expiry > ?`
+	args := []interface{}{tokenHash[:], scope, sqliteTime(time.Now())}
+
+	ctx, cancel := context.WithTimeout(context.Background(), QueryTimeOut*time.Second)
+	defer cancel()
+
+	var user User
+	err := su.DB.QueryRowContext(ctx, stmt, args...).Scan(append(user.sqliteDest(), &user.tokenExpiry)...)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &user, nil
+}
+
+func (su *sqliteUsers) DeleteScheduledBefore(t time.Time) ([]int64, error) {
+	stmt := `DELETE FROM users
+	WHERE delete_after <= ?
+	RETURNING id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), QueryTimeOut*time.Second)
+	defer cancel()
+
+	rows, err := su.DB.QueryContext(ctx, stmt, sqliteTime(t))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []int64{}
+	for rows.Next() {
+		var id int64
+		err = rows.Scan(&id)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+type sqliteTokens struct {
+	*sql.DB
+}
+
+func (st *sqliteTokens) Insert(token *Token) error {
+	stmt := `INSERT INTO tokens (hash, user_id, expiry, scope, email)
+	VALUES (?, ?, ?, ?, ?)`
+	args := []interface{}{token.HashedToken, token.UserID, sqliteTime(token.Expiry), token.Scope, token.Email}
+
+	ctx, cancel := context.WithTimeout(context.Background(), QueryTimeOut*time.Second)
+	defer cancel()
+
+	_, err := st.DB.ExecContext(ctx, stmt, args...)
+	return err
+}
+
+func (st *sqliteTokens) New(userID int64, ttl time.Duration, scope string) (*Token, error) {
+	token, err := generateToken(userID, ttl, scope)
+	if err != nil {
+		return nil, err
+	}
+
+	err = st.Insert(token)
+	return token, err
+}
+
+func (st *sqliteTokens) NewForEmail(userID int64, ttl time.Duration, scope, email string) (*Token, error) {
+	token, err := generateToken(userID, ttl, scope)
+	if err != nil {
+		return nil, err
+	}
+	token.Email = email
+
+	err = st.Insert(token)
+	return token, err
+}
+
+func (st *sqliteTokens) Get(tokenPlain, scope string) (*Token, error) {
+	tokenHash := sha256.Sum256([]byte(tokenPlain))
+
+	stmt := `SELECT hash, user_id, expiry, scope, email
+	FROM tokens
+	WHERE hash = ? AND scope = ? AND expiry > ?`
+	args := []interface{}{tokenHash[:], scope, sqliteTime(time.Now())}
+
+	ctx, cancel := context.WithTimeout(context.Background(), QueryTimeOut*time.Second)
+	defer cancel()
+
+	var token Token
+	err := st.DB.QueryRowContext(ctx, stmt, args...).Scan(&token.HashedToken, &token.UserID, &token.Expiry,
+		&token.Scope, &token.Email)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &token, nil
+}
+
+func (st *sqliteTokens) GetAllForUser(userID int64) ([]*Token, error) {
+	stmt := `SELECT hash, user_id, expiry, scope, email
+	FROM tokens
+	WHERE user_id = ? AND expiry > ?
+	ORDER BY expiry DESC`
+
+	ctx, cancel := context.WithTimeout(context.Background(), QueryTimeOut*time.Second)
+	defer cancel()
+
+	rows, err := st.DB.QueryContext(ctx, stmt, userID, sqliteTime(time.Now()))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tokens := []*Token{}
+	for rows.Next() {
+		var t Token
+		err = rows.Scan(&t.HashedToken, &t.UserID, &t.Expiry, &t.Scope, &t.Email)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, &t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+func (st *sqliteTokens) DeleteAllByUser(userID int64, scope string) error {
+	stmt := `DELETE FROM tokens WHERE user_id = ? AND scope = ?`
+
+	ctx, cancel := context.WithTimeout(context.Background(), QueryTimeOut*time.Second)
+	defer cancel()
+
+	_, err := st.DB.ExecContext(ctx, stmt, userID, scope)
+	return err
+}
+
+func (st *sqliteTokens) DeleteAllForUser(userID int64) error {
+	stmt := `DELETE FROM tokens WHERE user_id = ?`
+
+	ctx, cancel := context.WithTimeout(context.Background(), QueryTimeOut*time.Second)
+	defer cancel()
+
+	_, err := st.DB.ExecContext(ctx, stmt, userID)
+	return err
+}
+
+type sqlitePermissions struct {
+	*sql.DB
+}
+
+func (sp *sqlitePermissions) GetAll() (Permissions, error) {
+	return sp.codes(`SELECT code FROM permissions ORDER BY code`)
+}
+
+func (sp *sqlitePermissions) GetAllForUser(id int64) (Permissions, error) {
+	stmt := `SELECT permissions.code
+	FROM permissions
+	INNER JOIN user_permissions ON user_permissions.permission_id = permissions.id
+	WHERE user_permissions.user_id = ?1
+	UNION
+	SELECT permissions.code
+	FROM permissions
+	INNER JOIN role_permissions ON role_permissions.permission_id = permissions.id
+	INNER JOIN user_roles ON user_roles.role_id = role_permissions.role_id
+	WHERE user_roles.user_id = ?1
+	ORDER BY code`
+	return sp.codes(stmt, id)
+}
+
+func (sp *sqlitePermissions) GetGrantedForUser(id int64) (Permissions, error) {
+	stmt := `SELECT permissions.code
+	FROM permissions
+	INNER JOIN user_permissions ON user_permissions.permission_id = permissions.id
+	WHERE user_permissions.user_id = ?
+	ORDER BY permissions.code`
+	return sp.codes(stmt, id)
+}
+
+func (sp *sqlitePermissions) codes(stmt string, args ...interface{}) (Permissions, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), QueryTimeOut*time.Second)
+	defer cancel()
+
+	rows, err := sp.DB.QueryContext(ctx, stmt, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	perm := Permissions{}
+	for rows.Next() {
+		var p string
+		err = rows.Scan(&p)
+		if err != nil {
+			return nil, err
+		}
+		perm = append(perm, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return perm, nil
+}
+
+func (sp *sqlitePermissions) AddForUser(id int64, perms ...string) error {
+	stmt := `INSERT OR IGNORE INTO user_permissions
+	SELECT ?, permissions.id FROM permissions WHERE permissions.code IN (SELECT value FROM json_each(?))`
+
+	ctx, cancel := context.WithTimeout(context.Background(), QueryTimeOut*time.Second)
+	defer cancel()
+
+	_, err := sp.DB.ExecContext(ctx, stmt, id, sqliteJSON(perms))
+	return err
+}
+
+func (sp *sqlitePermissions) RemoveForUser(id int64, perms ...string) error {
+	stmt := `DELETE FROM user_permissions
+	WHERE user_id = ? AND permission_id IN (
+		SELECT id FROM permissions WHERE code IN (SELECT value FROM json_each(?)))`
+
+	ctx, cancel := context.WithTimeout(context.Background(), QueryTimeOut*time.Second)
+	defer cancel()
+
+	_, err := sp.DB.ExecContext(ctx, stmt, id, sqliteJSON(perms))
+	return err
+}
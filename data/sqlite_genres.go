@@ -0,0 +1,361 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+)
+
+type sqliteGenres struct {
+	*sql.DB
+}
+
+func (sg *sqliteGenres) Index() (GenreIndex, error) {
+	genres, err := sg.GetAll()
+	if err != nil {
+		return nil, err
+	}
+	return indexGenres(genres), nil
+}
+
+// aliasTaken report if the slug, name or aliases of a genre are already used by another genre
+func (sg *sqliteGenres) aliasTaken(genre *Genre) (bool, error) {
+	stmt := `SELECT EXISTS (
+		SELECT 1 FROM genres
+		WHERE id <> ?1 AND (slug IN (SELECT value FROM json_each(?2)) OR lower(name) IN (SELECT value FROM json_each(?2))
+		OR EXISTS (SELECT 1 FROM json_each(genres.aliases) AS a WHERE a.value IN (SELECT value FROM json_each(?2)))))`
+	values := append(genre.normalizeAliases(), genre.Slug, strings.ToLower(genre.Name))
+
+	ctx, cancel := context.WithTimeout(context.Background(), QueryTimeOut*time.Second)
+	defer cancel()
+
+	var taken bool
+	err := sg.DB.QueryRowContext(ctx, stmt, genre.ID, sqliteJSON(values)).Scan(&taken)
+	return taken, err
+}
+
+func (sg *sqliteGenres) Insert(genre *Genre) error {
+	taken, err := sg.aliasTaken(genre)
+	if err != nil {
+		return err
+	}
+	if taken {
+		return ErrDuplicatedGenre
+	}
+
+	stmt := `INSERT INTO genres (slug, name, aliases)
+	VALUES (?, ?, ?)
+	RETURNING id, created_at, version`
+	genre.Aliases = genre.normalizeAliases()
+	args := []interface{}{genre.Slug, genre.Name, jsonArray{&genre.Aliases}}
+
+	ctx, cancel := context.WithTimeout(context.Background(), QueryTimeOut*time.Second)
+	defer cancel()
+
+	err = sg.DB.QueryRowContext(ctx, stmt, args...).Scan(&genre.ID, &genre.CreatedAt, &genre.Version)
+	if err != nil {
+		switch {
+		case err.Error() == ErrGenreSlugConstraintSQLite:
+			return ErrDuplicatedGenre
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+func (sg *sqliteGenres) GetAll() ([]*Genre, error) {
+	stmt := `SELECT id, created_at, slug, name, aliases, version
+	FROM genres
+	ORDER BY name, id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), QueryTimeOut*time.Second)
+	defer cancel()
+
+	rows, err := sg.DB.QueryContext(ctx, stmt)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	genres := []*Genre{}
+	for rows.Next() {
+		var g Genre
+		err = rows.Scan(&g.ID, &g.CreatedAt, &g.Slug, &g.Name, jsonArray{&g.Aliases}, &g.Version)
+		if err != nil {
+			return nil, err
+		}
+		genres = append(genres, &g)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return genres, nil
+}
+
+func (sg *sqliteGenres) Get(id int64) (*Genre, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+	stmt := `SELECT id, created_at, slug, name, aliases, version
+	FROM genres
+	WHERE id = ?`
+
+	var g Genre
+
+	ctx, cancel := context.WithTimeout(context.Background(), QueryTimeOut*time.Second)
+	defer cancel()
+
+	err := sg.DB.QueryRowContext(ctx, stmt, id).Scan(&g.ID, &g.CreatedAt, &g.Slug, &g.Name, jsonArray{&g.Aliases},
+		&g.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &g, nil
+}
+
+func (sg *sqliteGenres) Update(genre *Genre) error {
+	taken, err := sg.aliasTaken(genre)
+	if err != nil {
+		return err
+	}
+	if taken {
+		return ErrDuplicatedGenre
+	}
+
+	stmt := `UPDATE genres
+	SET name = ?, aliases = ?, version = version + 1
+	WHERE id = ? AND version = ?
+	RETURNING version`
+	genre.Aliases = genre.normalizeAliases()
+	args := []interface{}{genre.Name, jsonArray{&genre.Aliases}, genre.ID, genre.Version}
+
+	ctx, cancel := context.WithTimeout(context.Background(), QueryTimeOut*time.Second)
+	defer cancel()
+
+	err = sg.DB.QueryRowContext(ctx, stmt, args...).Scan(&genre.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+// Delete remove a genre from the catalogue, ErrGenreInUse is returned while a movie use it, including the
+// movies in the trash
+func (sg *sqliteGenres) Delete(id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+	stmt := `DELETE FROM genres
+	WHERE id = ? AND NOT EXISTS (
+		SELECT 1 FROM movies, json_each(movies.genres) AS g WHERE g.value = genres.slug)`
+
+	err := sqliteExec(sg.DB, stmt, id)
+	if errors.Is(err, ErrRecordNotFound) {
+		// the genre does not exist or it is used by a movie
+		_, err = sg.Get(id)
+		if err != nil {
+			return err
+		}
+		return ErrGenreInUse
+	}
+	return err
+}
+
+// Merge move the movies of source to the genre and delete source, the genres of the movies are rewritten in
+// the transaction because SQLite has no array functions to update them in place
+func (sg *sqliteGenres) Merge(genre, source *Genre, userID int64) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), QueryTimeOut*time.Second)
+	defer cancel()
+
+	tx, err := sg.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback() //nolint:errcheck
+
+	r, err := tx.ExecContext(ctx, `DELETE FROM genres WHERE id = ? AND version = ?`, source.ID, source.Version)
+	if err != nil {
+		return 0, err
+	}
+	rows, err := r.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	if rows == 0 {
+		return 0, ErrEditConflict
+	}
+
+	movies, err := sqliteMoviesWithGenre(ctx, tx, source.Slug)
+	if err != nil {
+		return 0, err
+	}
+	for id, genres := range movies {
+		genres = replaceGenre(genres, source.Slug, genre.Slug)
+		_, err = tx.ExecContext(ctx, `UPDATE movies SET genres = ?, version = version + 1 WHERE id = ?`,
+			jsonArray{&genres}, id)
+		if err != nil {
+			return 0, err
+		}
+		err = sqliteRevision(ctx, tx, id, RevisionUpdate, userID)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	stmt := `UPDATE genres
+	SET aliases = ?, version = version + 1
+	WHERE id = ? AND version = ?
+	RETURNING version`
+	err = tx.QueryRowContext(ctx, stmt, jsonArray{&genre.Aliases}, genre.ID, genre.Version).Scan(&genre.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return 0, ErrEditConflict
+		default:
+			return 0, err
+		}
+	}
+	return int64(len(movies)), tx.Commit()
+}
+
+// sqliteMoviesWithGenre return the genres of the movies with the slug by movie id, including the movies in the trash
+func sqliteMoviesWithGenre(ctx context.Context, tx *sql.Tx, slug string) (map[int64][]string, error) {
+	stmt := `SELECT id, genres FROM movies
+	WHERE EXISTS (SELECT 1 FROM json_each(movies.genres) AS g WHERE g.value = ?)`
+
+	rows, err := tx.QueryContext(ctx, stmt, slug)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	movies := make(map[int64][]string)
+	for rows.Next() {
+		var id int64
+		var genres []string
+		err = rows.Scan(&id, jsonArray{&genres})
+		if err != nil {
+			return nil, err
+		}
+		movies[id] = genres
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return movies, nil
+}
+
+// sqliteCredits store the credits in SQLite, the names are read from the people
+type sqliteCredits struct {
+	*sql.DB
+}
+
+func (sc *sqliteCredits) Insert(credit *Credit) error {
+	stmt := `INSERT INTO credits (movie_id, person_id, role, character, billing_order)
+	VALUES (?, ?, ?, ?, ?)
+	RETURNING id`
+	args := []interface{}{credit.MovieID, credit.PersonID, credit.Role, credit.Character, credit.BillingOrder}
+
+	ctx, cancel := context.WithTimeout(context.Background(), QueryTimeOut*time.Second)
+	defer cancel()
+
+	return sc.DB.QueryRowContext(ctx, stmt, args...).Scan(&credit.ID)
+}
+
+func (sc *sqliteCredits) GetForMovie(movieID int64) ([]*Credit, error) {
+	credits, err := sc.GetForMovies([]int64{movieID})
+	if err != nil {
+		return nil, err
+	}
+	if credits[movieID] == nil {
+		return []*Credit{}, nil
+	}
+	return credits[movieID], nil
+}
+
+func (sc *sqliteCredits) GetForMovies(movieIDs []int64) (map[int64][]*Credit, error) {
+	stmt := `SELECT credits.id, credits.movie_id, credits.person_id, people.name, credits.role,
+	credits.character, credits.billing_order
+	FROM credits
+	INNER JOIN people ON people.id = credits.person_id
+	WHERE credits.movie_id IN (SELECT value FROM json_each(?))
+	ORDER BY credits.movie_id, credits.billing_order, credits.id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), QueryTimeOut*time.Second)
+	defer cancel()
+
+	rows, err := sc.DB.QueryContext(ctx, stmt, sqliteJSON(movieIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	credits := make(map[int64][]*Credit, len(movieIDs))
+	for rows.Next() {
+		var c Credit
+		err = rows.Scan(&c.ID, &c.MovieID, &c.PersonID, &c.PersonName, &c.Role, &c.Character, &c.BillingOrder)
+		if err != nil {
+			return nil, err
+		}
+		credits[c.MovieID] = append(credits[c.MovieID], &c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return credits, nil
+}
+
+func (sc *sqliteCredits) GetForPerson(personID int64, roles []string) ([]*Credit, error) {
+	stmt := `SELECT credits.id, credits.movie_id, credits.person_id, movies.title, movies.year, credits.role,
+	credits.character, credits.billing_order
+	FROM credits
+	INNER JOIN movies ON movies.id = credits.movie_id
+	WHERE credits.person_id = ?1 AND movies.deleted_at IS NULL
+	AND (credits.role IN (SELECT value FROM json_each(?2)) OR json_array_length(?2) = 0)
+	ORDER BY movies.year DESC, movies.id, credits.billing_order`
+	args := []interface{}{personID, sqliteJSON(roles)}
+
+	ctx, cancel := context.WithTimeout(context.Background(), QueryTimeOut*time.Second)
+	defer cancel()
+
+	rows, err := sc.DB.QueryContext(ctx, stmt, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	credits := []*Credit{}
+	for rows.Next() {
+		var c Credit
+		err = rows.Scan(&c.ID, &c.MovieID, &c.PersonID, &c.MovieTitle, &c.MovieYear, &c.Role,
+			&c.Character, &c.BillingOrder)
+		if err != nil {
+			return nil, err
+		}
+		credits = append(credits, &c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return credits, nil
+}
+
+func (sc *sqliteCredits) Delete(movieID, id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+	return sqliteExec(sc.DB, `DELETE FROM credits WHERE id = ? AND movie_id = ?`, id, movieID)
+}
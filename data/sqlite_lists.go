@@ -0,0 +1,220 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+type sqliteLists struct {
+	*sql.DB
+}
+
+func (sl *sqliteLists) EnsureDefault(userID int64) error {
+	stmt := `INSERT INTO lists (user_id, name, is_default)
+	VALUES (?, ?, 1)
+	ON CONFLICT DO NOTHING`
+
+	ctx, cancel := context.WithTimeout(context.Background(), QueryTimeOut*time.Second)
+	defer cancel()
+
+	_, err := sl.DB.ExecContext(ctx, stmt, userID, DefaultListName)
+	return err
+}
+
+func (sl *sqliteLists) Insert(list *List) error {
+	stmt := `INSERT INTO lists (user_id, name)
+	VALUES (?, ?)
+	RETURNING id, created_at, version`
+	args := []interface{}{list.UserID, list.Name}
+
+	ctx, cancel := context.WithTimeout(context.Background(), QueryTimeOut*time.Second)
+	defer cancel()
+
+	err := sl.DB.QueryRowContext(ctx, stmt, args...).Scan(&list.ID, &list.CreatedAt, &list.Version)
+	if err != nil {
+		switch {
+		case err.Error() == ErrListNameConstraintSQLite:
+			return ErrDuplicatedListName
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+// sqliteListSelect select the lists with the amount of movies out of the trash, the conditions are added by the
+// callers
+const sqliteListSelect = `SELECT lists.id, lists.created_at, lists.user_id, lists.name, lists.is_default, lists.slug,
+	lists.version, (SELECT count(*) FROM list_items INNER JOIN movies ON movies.id = list_items.movie_id
+		WHERE list_items.list_id = lists.id AND movies.deleted_at IS NULL)
+	FROM lists`
+
+func (l *List) sqliteDest() []interface{} {
+	return []interface{}{&l.ID, &l.CreatedAt, &l.UserID, &l.Name, &l.Default, &l.Slug, &l.Version, &l.MovieCount}
+}
+
+// GetAllForUser return the lists of a user with the amount of movies, the default list is returned first
+func (sl *sqliteLists) GetAllForUser(userID int64) ([]*List, error) {
+	stmt := sqliteListSelect + `
+	WHERE lists.user_id = ?
+	ORDER BY lists.is_default DESC, lists.id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), QueryTimeOut*time.Second)
+	defer cancel()
+
+	rows, err := sl.DB.QueryContext(ctx, stmt, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	lists := []*List{}
+	for rows.Next() {
+		var l List
+		err = rows.Scan(l.sqliteDest()...)
+		if err != nil {
+			return nil, err
+		}
+		lists = append(lists, &l)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return lists, nil
+}
+
+func (sl *sqliteLists) Get(id, userID int64) (*List, error) {
+	return sl.get(sqliteListSelect+` WHERE lists.id = ? AND lists.user_id = ?`, id, userID)
+}
+
+func (sl *sqliteLists) GetBySlug(slug string) (*List, error) {
+	return sl.get(sqliteListSelect+` WHERE lists.slug = ?`, slug)
+}
+
+func (sl *sqliteLists) get(stmt string, args ...interface{}) (*List, error) {
+	var l List
+
+	ctx, cancel := context.WithTimeout(context.Background(), QueryTimeOut*time.Second)
+	defer cancel()
+
+	err := sl.DB.QueryRowContext(ctx, stmt, args...).Scan(l.sqliteDest()...)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &l, nil
+}
+
+func (sl *sqliteLists) Update(list *List) error {
+	stmt := `UPDATE lists
+	SET name = ?, slug = ?, version = version + 1
+	WHERE id = ? AND user_id = ? AND version = ?
+	RETURNING version`
+	args := []interface{}{list.Name, list.Slug, list.ID, list.UserID, list.Version}
+
+	ctx, cancel := context.WithTimeout(context.Background(), QueryTimeOut*time.Second)
+	defer cancel()
+
+	err := sl.DB.QueryRowContext(ctx, stmt, args...).Scan(&list.Version)
+	if err != nil {
+		switch {
+		case err.Error() == ErrListNameConstraintSQLite:
+			return ErrDuplicatedListName
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+// Delete remove a custom list of the user, the default list can not be removed
+func (sl *sqliteLists) Delete(id, userID int64) error {
+	return sqliteExec(sl.DB, `DELETE FROM lists WHERE id = ? AND user_id = ? AND NOT is_default`, id, userID)
+}
+
+func (sl *sqliteLists) GetItems(listID int64) ([]*ListItem, error) {
+	stmt := `SELECT list_items.movie_id, movies.title, movies.year, list_items.position, list_items.added_at,
+	list_items.watched_at
+	FROM list_items
+	INNER JOIN movies ON movies.id = list_items.movie_id
+	WHERE list_items.list_id = ? AND movies.deleted_at IS NULL
+	ORDER BY list_items.position, list_items.added_at`
+
+	ctx, cancel := context.WithTimeout(context.Background(), QueryTimeOut*time.Second)
+	defer cancel()
+
+	rows, err := sl.DB.QueryContext(ctx, stmt, listID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := []*ListItem{}
+	for rows.Next() {
+		var i ListItem
+		err = rows.Scan(&i.MovieID, &i.Title, &i.Year, &i.Position, &i.AddedAt, &i.WatchedAt)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, &i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+func (sl *sqliteLists) AddItem(listID, movieID int64) error {
+	stmt := `INSERT INTO list_items (list_id, movie_id, position)
+	SELECT ?1, ?2, COALESCE(MAX(position), 0) + 1 FROM list_items WHERE list_id = ?1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), QueryTimeOut*time.Second)
+	defer cancel()
+
+	_, err := sl.DB.ExecContext(ctx, stmt, listID, movieID)
+	if err != nil {
+		switch {
+		case err.Error() == ErrListItemConstraintSQLite:
+			return ErrDuplicatedListItem
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+func (sl *sqliteLists) RemoveItem(listID, movieID int64) error {
+	return sqliteExec(sl.DB, `DELETE FROM list_items WHERE list_id = ? AND movie_id = ?`, listID, movieID)
+}
+
+func (sl *sqliteLists) SetWatched(listID, movieID int64, watchedAt *time.Time) error {
+	var watched interface{}
+	if watchedAt != nil {
+		watched = sqliteTime(*watchedAt)
+	}
+	return sqliteExec(sl.DB, `UPDATE list_items SET watched_at = ? WHERE list_id = ? AND movie_id = ?`, watched,
+		listID, movieID)
+}
+
+// Reorder set the position of the movies of a list following the order of movieIDs, the key of json_each is the
+// index of the movie
+func (sl *sqliteLists) Reorder(listID int64, movieIDs []int64) error {
+	stmt := `UPDATE list_items
+	SET position = (SELECT new_order.key + 1 FROM json_each(?2) AS new_order
+		WHERE new_order.value = list_items.movie_id ORDER BY new_order.key LIMIT 1)
+	WHERE list_id = ?1 AND movie_id IN (SELECT value FROM json_each(?2))`
+
+	ctx, cancel := context.WithTimeout(context.Background(), QueryTimeOut*time.Second)
+	defer cancel()
+
+	_, err := sl.DB.ExecContext(ctx, stmt, listID, sqliteJSON(movieIDs))
+	return err
+}
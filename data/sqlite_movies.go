@@ -0,0 +1,617 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// sqliteMovies store the movies in SQLite with the same semantics of MovieModel, the titles are searched with
+// FTS5 and the trigram similarity is registered by the driver. The revisions are recorded in the transaction of
+// every change because SQLite does not support modifying data in a WITH clause.
+type sqliteMovies struct {
+	*sql.DB
+}
+
+// sqliteDest replace the array destinations returned by selectFields with JSON arrays
+func sqliteDest(dest []interface{}) []interface{} {
+	for i, d := range dest {
+		if a, ok := d.(*pq.StringArray); ok {
+			dest[i] = jsonArray{(*[]string)(a)}
+		}
+	}
+	return dest
+}
+
+// sqliteTitleSearch return the clause to search by title using the placeholder p, the rank and highlight are
+// read from the FTS5 table with correlated subqueries because they need the MATCH in the same query
+func sqliteTitleSearch(fuzzy bool, p string) searchClause {
+	if fuzzy {
+		return searchClause{
+			where: fmt.Sprintf("similarity(movies.title, %s) >= %g", p, similarityThreshold),
+			rank:  fmt.Sprintf("similarity(movies.title, %s)", p),
+			match: "''",
+		}
+	}
+	fts := fmt.Sprintf("SELECT %%s FROM movies_fts WHERE movies_fts MATCH %s AND movies_fts.rowid = movies.id", p)
+	return searchClause{
+		where: fmt.Sprintf("movies.id IN (SELECT rowid FROM movies_fts WHERE movies_fts MATCH %s)", p),
+		rank:  fmt.Sprintf("(%s)", fmt.Sprintf(fts, "-bm25(movies_fts)")),
+		match: fmt.Sprintf("(%s)", fmt.Sprintf(fts, "highlight(movies_fts, 0, '<b>', '</b>')")),
+	}
+}
+
+// ftsQuery return a FTS5 query matching every word of the title like plainto_tsquery, the words are quoted
+// so the FTS5 operators are not interpreted
+func ftsQuery(title string) string {
+	terms := searchTerms(title)
+	for i, t := range terms {
+		terms[i] = strconv.Quote(t)
+	}
+	if len(terms) == 0 {
+		return `""`
+	}
+	return strings.Join(terms, " ")
+}
+
+// sqliteMovieConditions add the conditions of movieConditions written for SQLite, the columns are qualified
+// because the conditions are also used with the columns of json_each and movies_fts
+func sqliteMovieConditions(b *whereBuilder, title string, fuzzy bool, genres []string, personID int64,
+	filters Filters) searchClause {
+	b.placeholder = "?"
+	b.where("movies.deleted_at IS NULL")
+
+	sc := searchClause{where: "true", rank: "0", match: "''"}
+	if title != "" {
+		search := ftsQuery(title)
+		if fuzzy {
+			search = title
+		}
+		sc = sqliteTitleSearch(fuzzy, b.param(search))
+		b.where(sc.where)
+	}
+
+	if len(genres) > 0 {
+		p := b.param(sqliteJSON(genres))
+		overlap := fmt.Sprintf("EXISTS (SELECT 1 FROM json_each(movies.genres) AS g WHERE g.value IN (SELECT value FROM json_each(%s)))", p)
+		switch filters.GenresMode {
+		case GenresAny:
+			b.where(overlap)
+		case GenresNone:
+			b.where("NOT " + overlap)
+		default:
+			b.where(fmt.Sprintf(
+				"NOT EXISTS (SELECT 1 FROM json_each(%s) AS g WHERE g.value NOT IN (SELECT value FROM json_each(movies.genres)))", p))
+		}
+	}
+	if personID > 0 {
+		b.where(fmt.Sprintf("movies.id IN (SELECT movie_id FROM credits WHERE person_id = %s)", b.param(personID)))
+	}
+
+	if filters.YearMin > 0 {
+		b.where(fmt.Sprintf("movies.year >= %s", b.param(filters.YearMin)))
+	}
+	if filters.YearMax > 0 {
+		b.where(fmt.Sprintf("movies.year <= %s", b.param(filters.YearMax)))
+	}
+	if filters.Decade > 0 {
+		b.where(fmt.Sprintf("movies.year BETWEEN %s AND %s", b.param(filters.Decade), b.param(filters.Decade+9))) //nolint:gomnd
+	}
+
+	if filters.RuntimeMin > 0 {
+		b.where(fmt.Sprintf("movies.runtime >= %s", b.param(filters.RuntimeMin)))
+	}
+	if filters.RuntimeMax > 0 {
+		b.where(fmt.Sprintf("movies.runtime <= %s", b.param(filters.RuntimeMax)))
+	}
+	if filters.RuntimeBucket != "" {
+		bucket := runtimeBucket(filters.RuntimeBucket)
+		b.where(fmt.Sprintf("movies.runtime >= %s AND movies.runtime < %s", b.param(bucket.Min), b.param(bucket.Max)))
+	}
+
+	if !filters.CreatedAfter.IsZero() {
+		b.where(fmt.Sprintf("movies.created_at >= %s", b.param(sqliteTime(filters.CreatedAfter))))
+	}
+	if !filters.CreatedBefore.IsZero() {
+		b.where(fmt.Sprintf("movies.created_at < %s", b.param(sqliteTime(filters.CreatedBefore))))
+	}
+	return sc
+}
+
+// sqliteRevision record the values of a movie after a change made by the user like the revision CTEs of
+// MovieModel
+func sqliteRevision(ctx context.Context, tx *sql.Tx, movieID int64, action string, userID int64) error {
+	stmt := `INSERT INTO movie_revisions (movie_id, version, action, user_id, title, year, runtime, genres)
+	SELECT id, version, ?, NULLIF(?, 0), title, year, runtime, genres FROM movies WHERE id = ?`
+
+	_, err := tx.ExecContext(ctx, stmt, action, userID, movieID)
+	return err
+}
+
+func (sm *sqliteMovies) Insert(movie *Movie, userID int64) error {
+	return sm.InsertAll([]*Movie{movie}, userID)
+}
+
+// InsertAll create the movies in a single transaction, no movie is created if any of them fails
+func (sm *sqliteMovies) InsertAll(movies []*Movie, userID int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), QueryTimeOut*time.Second)
+	defer cancel()
+
+	tx, err := sm.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() //nolint:errcheck
+
+	for _, movie := range movies {
+		err = sm.insert(ctx, tx, movie, userID)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (sm *sqliteMovies) insert(ctx context.Context, tx *sql.Tx, movie *Movie, userID int64) error {
+	stmt := `INSERT INTO movies (title, year, runtime, genres)
+	VALUES (?, ?, ?, ?)
+	RETURNING id, created_at, version`
+	args := []interface{}{movie.Title, movie.Year, movie.Runtime, jsonArray{&movie.Genres}}
+
+	err := tx.QueryRowContext(ctx, stmt, args...).Scan(&movie.ID, &movie.CreatedAt, &movie.Version)
+	if err != nil {
+		return err
+	}
+	return sqliteRevision(ctx, tx, movie.ID, RevisionInsert, userID)
+}
+
+func (sm *sqliteMovies) Update(movie *Movie, userID int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), QueryTimeOut*time.Second)
+	defer cancel()
+
+	tx, err := sm.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() //nolint:errcheck
+
+	stmt := `UPDATE movies
+	SET title = ?, year = ?, runtime = ?, genres = ?, version = version + 1
+	WHERE id = ? AND version = ? AND deleted_at IS NULL
+	RETURNING version`
+	args := []interface{}{movie.Title, movie.Year, movie.Runtime, jsonArray{&movie.Genres}, movie.ID, movie.Version}
+
+	err = tx.QueryRowContext(ctx, stmt, args...).Scan(&movie.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	err = sqliteRevision(ctx, tx, movie.ID, RevisionUpdate, userID)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// SetPoster replace the poster in a transaction, SQLite can not return the previous key from the UPDATE
+func (sm *sqliteMovies) SetPoster(movie *Movie, key string, userID int64) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), QueryTimeOut*time.Second)
+	defer cancel()
+
+	tx, err := sm.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback() //nolint:errcheck
+
+	var previous string
+	err = tx.QueryRowContext(ctx, `SELECT COALESCE(poster_key, '') FROM movies WHERE id = ?`, movie.ID).Scan(&previous)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return "", err
+	}
+
+	stmt := `UPDATE movies
+	SET poster = ?, poster_key = ?, version = version + 1
+	WHERE id = ? AND version = ? AND deleted_at IS NULL
+	RETURNING version`
+	err = tx.QueryRowContext(ctx, stmt, movie.Poster, key, movie.ID, movie.Version).Scan(&movie.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return "", ErrEditConflict
+		default:
+			return "", err
+		}
+	}
+
+	err = sqliteRevision(ctx, tx, movie.ID, RevisionUpdate, userID)
+	if err != nil {
+		return "", err
+	}
+	return previous, tx.Commit()
+}
+
+func (sm *sqliteMovies) Get(id int64) (*Movie, error) {
+	return sm.GetFields(id, nil)
+}
+
+//nolint:gosec
+func (sm *sqliteMovies) GetFields(id int64, fields []string) (*Movie, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	var movie Movie
+	columns, dest := movie.selectFields(fields, []string{"id", "version"}, nil)
+	stmt := fmt.Sprintf(`SELECT %s
+	FROM movies
+	WHERE id = ? AND deleted_at IS NULL`, strings.Join(columns, ", "))
+
+	ctx, cancel := context.WithTimeout(context.Background(), QueryTimeOut*time.Second)
+	defer cancel()
+
+	err := sm.DB.QueryRowContext(ctx, stmt, id).Scan(sqliteDest(dest)...)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &movie, nil
+}
+
+// GetAll list movies like MovieModel.GetAll, the trigram similarity is used when the full-text search does
+// not match any movie
+func (sm *sqliteMovies) GetAll(title string, genres []string, personID int64, filters Filters) ([]*Movie, Metadata, error) {
+	fuzzy := false
+	if title != "" {
+		found, err := sm.titleMatches(title, genres, personID, filters)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		fuzzy = !found
+	}
+
+	movies, totalRecords, err := sm.search(title, fuzzy, genres, personID, filters)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	movies, metadata := listMetadata(movies, totalRecords, fuzzy, filters)
+	return movies, metadata, nil
+}
+
+//nolint:gosec
+func (sm *sqliteMovies) titleMatches(title string, genres []string, personID int64, filters Filters) (bool, error) {
+	var b whereBuilder
+	sqliteMovieConditions(&b, title, false, genres, personID, filters)
+	stmt := fmt.Sprintf(`SELECT EXISTS (SELECT 1 FROM movies WHERE %s)`, b.String())
+
+	ctx, cancel := context.WithTimeout(context.Background(), QueryTimeOut*time.Second)
+	defer cancel()
+
+	var found bool
+	err := sm.DB.QueryRowContext(ctx, stmt, b.args...).Scan(&found)
+	return found, err
+}
+
+// search run the list query like MovieModel.search, the cursor value is bound as a number for the numeric
+// columns because SQLite compare numbers and text by type
+//
+//nolint:gosec
+func (sm *sqliteMovies) search(title string, fuzzy bool, genres []string, personID int64,
+	filters Filters) ([]*Movie, int, error) {
+	count := "count(*) OVER()"
+	if filters.SkipCount {
+		count = "0"
+	}
+	column, direction := filters.sortColumn(), filters.sortDirection()
+
+	var b whereBuilder
+	sc := sqliteMovieConditions(&b, title, fuzzy, genres, personID, filters)
+
+	keyset := ""
+	limit, offset := filters.limit(), filters.offset()
+	if filters.CursorMode {
+		limit, offset = filters.limit()+1, 0
+		if filters.Cursor != "" {
+			c, err := decodeCursor(filters.Cursor)
+			if err != nil {
+				return nil, 0, err
+			}
+			var value interface{} = c.Value
+			if column != "title" {
+				value, _ = strconv.ParseFloat(c.Value, 64)
+			}
+			if column == "id" {
+				keyset = fmt.Sprintf("WHERE id %s %s", filters.keysetOperator(), b.param(c.ID))
+			} else {
+				keyset = fmt.Sprintf("WHERE (%s, id) %s (%s, %s)", column, filters.keysetOperator(),
+					b.param(value), b.param(c.ID))
+			}
+		}
+	}
+
+	required := []string{"id", "version", column}
+	if column == "rating" {
+		required[2] = "average_rating"
+	}
+	var scanned Movie
+	inner, _ := scanned.selectFields(filters.Fields, required, map[string]string{"average_rating": "average_rating AS rating"})
+	outer, _ := scanned.selectFields(filters.Fields, required, map[string]string{"average_rating": "rating"})
+
+	stmt := fmt.Sprintf(`SELECT total, relevance, %s, %s
+						FROM (
+							SELECT %s AS total, %s, %s AS relevance
+							FROM movies
+							WHERE %s
+						) AS movies
+						%s
+						ORDER BY %s %s, id %s
+						LIMIT %s OFFSET %s`, sc.match, strings.Join(outer, ", "), count, strings.Join(inner, ", "), sc.rank,
+		b.String(), keyset, column, direction, direction, b.param(limit), b.param(offset))
+
+	ctx, cancel := context.WithTimeout(context.Background(), QueryTimeOut*time.Second)
+	defer cancel()
+
+	r, err := sm.DB.QueryContext(ctx, stmt, b.args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer r.Close()
+
+	totalRecords := 0
+	movies := []*Movie{}
+	for r.Next() {
+		var movie Movie
+		_, dest := movie.selectFields(filters.Fields, required, nil)
+		err := r.Scan(append([]interface{}{&totalRecords, &movie.relevance, &movie.Match}, sqliteDest(dest)...)...)
+		if err != nil {
+			return nil, 0, err
+		}
+		movies = append(movies, &movie)
+	}
+	if err := r.Err(); err != nil {
+		return nil, 0, err
+	}
+	return movies, totalRecords, nil
+}
+
+// GetFacets count the facet values like MovieModel.GetFacets, the genres are expanded with json_each
+//
+//nolint:gosec
+func (sm *sqliteMovies) GetFacets(title string, genres []string, personID int64, fuzzy bool,
+	filters Filters) (map[string][]FacetCount, error) {
+	facets := make(map[string][]FacetCount, len(filters.Facets))
+	var b whereBuilder
+	sqliteMovieConditions(&b, title, fuzzy, genres, personID, filters)
+	expressions := map[string]string{
+		"genres":         "facet_genres.value",
+		"decade":         "CAST(movies.year / 10 * 10 AS TEXT)",
+		"runtime_bucket": facetExpressions()["runtime_bucket"],
+	}
+	queries := []string{}
+	for _, f := range filters.Facets {
+		expression, ok := expressions[f]
+		if _, seen := facets[f]; seen || !ok {
+			continue
+		}
+		from := "movies"
+		if f == "genres" {
+			from = "movies, json_each(movies.genres) AS facet_genres"
+		}
+		facets[f] = []FacetCount{}
+		queries = append(queries, fmt.Sprintf(`SELECT '%s' AS facet, value, count(*) AS total
+		FROM (SELECT %s AS value FROM %s WHERE %s) AS facet_values
+		GROUP BY value`, f, expression, from, b.String()))
+	}
+	if len(queries) == 0 {
+		return facets, nil
+	}
+	stmt := strings.Join(queries, "\nUNION ALL\n") + "\nORDER BY facet, total DESC, value"
+
+	ctx, cancel := context.WithTimeout(context.Background(), QueryTimeOut*time.Second)
+	defer cancel()
+
+	r, err := sm.DB.QueryContext(ctx, stmt, b.args...)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	for r.Next() {
+		var facet string
+		var fc FacetCount
+		err := r.Scan(&facet, &fc.Value, &fc.Count)
+		if err != nil {
+			return nil, err
+		}
+		facets[facet] = append(facets[facet], fc)
+	}
+	if err := r.Err(); err != nil {
+		return nil, err
+	}
+	return facets, nil
+}
+
+//nolint:gosec
+func (sm *sqliteMovies) GetTrash(filters Filters) ([]*Movie, Metadata, error) {
+	stmt := fmt.Sprintf(`SELECT count(*) OVER(), id, created_at, title, year, runtime, genres, version, deleted_at
+						FROM movies
+						WHERE deleted_at IS NOT NULL
+						ORDER BY %s %s, id ASC
+						LIMIT ? OFFSET ?`, filters.sortColumn(), filters.sortDirection())
+
+	ctx, cancel := context.WithTimeout(context.Background(), QueryTimeOut*time.Second)
+	defer cancel()
+
+	r, err := sm.DB.QueryContext(ctx, stmt, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer r.Close()
+
+	totalRecords := 0
+	movies := []*Movie{}
+	for r.Next() {
+		var movie Movie
+		err := r.Scan(&totalRecords, &movie.ID, &movie.CreatedAt, &movie.Title, &movie.Year, &movie.Runtime,
+			jsonArray{&movie.Genres}, &movie.Version, &movie.DeletedAt)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		movies = append(movies, &movie)
+	}
+	if err := r.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+	metadata := calcMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return movies, metadata, nil
+}
+
+func (sm *sqliteMovies) Export(ctx context.Context, title string, genres []string, fn func(*Movie) error) error {
+	var b whereBuilder
+	sqliteMovieConditions(&b, title, false, genres, 0, Filters{})
+	stmt := fmt.Sprintf(`SELECT id, created_at, title, year, runtime, genres, version, average_rating, rating_count,
+							poster
+						FROM movies
+						WHERE %s
+						ORDER BY id`, b.String()) //nolint:gosec
+
+	r, err := sm.DB.QueryContext(ctx, stmt, b.args...)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	for r.Next() {
+		var movie Movie
+		err := r.Scan(&movie.ID, &movie.CreatedAt, &movie.Title, &movie.Year, &movie.Runtime,
+			jsonArray{&movie.Genres}, &movie.Version, &movie.AverageRating, &movie.RatingCount, &movie.Poster)
+		if err != nil {
+			return err
+		}
+		if err := fn(&movie); err != nil {
+			return err
+		}
+	}
+	return r.Err()
+}
+
+func (sm *sqliteMovies) Delete(movie *Movie, userID int64) error {
+	stmt := `UPDATE movies SET deleted_at = ? WHERE id = ? AND version = ? AND deleted_at IS NULL`
+	err := sm.exec(stmt, movie.ID, RevisionDelete, userID, sqliteTime(time.Now()), movie.ID, movie.Version)
+	if errors.Is(err, ErrRecordNotFound) {
+		return ErrEditConflict
+	}
+	return err
+}
+
+func (sm *sqliteMovies) Restore(id, userID int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+	return sm.exec(`UPDATE movies SET deleted_at = NULL WHERE id = ? AND deleted_at IS NOT NULL`, id, RevisionRestore,
+		userID, id)
+}
+
+// exec run a statement changing a movie and record the revision in the same transaction, ErrRecordNotFound is
+// returned when no movie is changed
+func (sm *sqliteMovies) exec(stmt string, movieID int64, action string, userID int64, args ...interface{}) error {
+	ctx, cancel := context.WithTimeout(context.Background(), QueryTimeOut*time.Second)
+	defer cancel()
+
+	tx, err := sm.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() //nolint:errcheck
+
+	r, err := tx.ExecContext(ctx, stmt, args...)
+	if err != nil {
+		return err
+	}
+	rows, err := r.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrRecordNotFound
+	}
+
+	err = sqliteRevision(ctx, tx, movieID, action, userID)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Purge remove a movie in the trash permanently, credits, reviews, revisions and list entries of the movie are
+// removed by ON DELETE CASCADE
+func (sm *sqliteMovies) Purge(id int64) (string, error) {
+	if id < 1 {
+		return "", ErrRecordNotFound
+	}
+
+	stmt := `DELETE FROM movies WHERE id = ? AND deleted_at IS NOT NULL RETURNING COALESCE(poster_key, '')`
+
+	ctx, cancel := context.WithTimeout(context.Background(), QueryTimeOut*time.Second)
+	defer cancel()
+
+	var key string
+	err := sm.DB.QueryRowContext(ctx, stmt, id).Scan(&key)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return "", ErrRecordNotFound
+		default:
+			return "", err
+		}
+	}
+	return key, nil
+}
+
+func (sm *sqliteMovies) PurgeDeletedBefore(t time.Time) (int64, []string, error) {
+	stmt := `DELETE FROM movies WHERE deleted_at < ? RETURNING COALESCE(poster_key, '')`
+
+	ctx, cancel := context.WithTimeout(context.Background(), QueryTimeOut*time.Second)
+	defer cancel()
+
+	r, err := sm.DB.QueryContext(ctx, stmt, sqliteTime(t))
+	if err != nil {
+		return 0, nil, err
+	}
+	defer r.Close()
+
+	var n int64
+	keys := []string{}
+	for r.Next() {
+		var key string
+		err = r.Scan(&key)
+		if err != nil {
+			return 0, nil, err
+		}
+		n++
+		if key != "" {
+			keys = append(keys, key)
+		}
+	}
+	if err = r.Err(); err != nil {
+		return 0, nil, err
+	}
+	return n, keys, nil
+}
@@ -0,0 +1,120 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+type sqlitePeople struct {
+	*sql.DB
+}
+
+func (sp *sqlitePeople) Insert(person *Person) error {
+	stmt := `INSERT INTO people (name, birth_year)
+	VALUES (?, ?)
+	RETURNING id, created_at, version`
+	args := []interface{}{person.Name, person.BirthYear}
+
+	ctx, cancel := context.WithTimeout(context.Background(), QueryTimeOut*time.Second)
+	defer cancel()
+
+	return sp.DB.QueryRowContext(ctx, stmt, args...).Scan(&person.ID, &person.CreatedAt, &person.Version)
+}
+
+func (sp *sqlitePeople) Get(id int64) (*Person, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+	stmt := `SELECT id, created_at, name, birth_year, version
+	FROM people
+	WHERE id = ?`
+
+	var person Person
+
+	ctx, cancel := context.WithTimeout(context.Background(), QueryTimeOut*time.Second)
+	defer cancel()
+
+	err := sp.DB.QueryRowContext(ctx, stmt, id).Scan(&person.ID, &person.CreatedAt, &person.Name,
+		&person.BirthYear, &person.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &person, nil
+}
+
+// GetAll list the people like PeopleModel.GetAll, the names are searched with the words_match function
+// registered by the driver
+//
+//nolint:gosec
+func (sp *sqlitePeople) GetAll(name string, filters Filters) ([]*Person, Metadata, error) {
+	stmt := fmt.Sprintf(`SELECT count(*) OVER(), id, created_at, name, birth_year, version
+						FROM people
+						WHERE (words_match(name, ?1) OR ?1 = '')
+						ORDER BY %s %s, id ASC
+						LIMIT ?2 OFFSET ?3`, filters.sortColumn(), filters.sortDirection())
+	args := []interface{}{name, filters.limit(), filters.offset()}
+
+	ctx, cancel := context.WithTimeout(context.Background(), QueryTimeOut*time.Second)
+	defer cancel()
+
+	r, err := sp.DB.QueryContext(ctx, stmt, args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer r.Close()
+
+	totalRecords := 0
+	people := []*Person{}
+	for r.Next() {
+		var person Person
+		err := r.Scan(&totalRecords, &person.ID, &person.CreatedAt, &person.Name, &person.BirthYear, &person.Version)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		people = append(people, &person)
+	}
+	if err := r.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+	metadata := calcMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return people, metadata, nil
+}
+
+func (sp *sqlitePeople) Update(person *Person) error {
+	stmt := `UPDATE people
+	SET name = ?, birth_year = ?, version = version + 1
+	WHERE id = ? AND version = ?
+	RETURNING version`
+	args := []interface{}{person.Name, person.BirthYear, person.ID, person.Version}
+
+	ctx, cancel := context.WithTimeout(context.Background(), QueryTimeOut*time.Second)
+	defer cancel()
+
+	err := sp.DB.QueryRowContext(ctx, stmt, args...).Scan(&person.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+// Delete remove a person, the credits of the person are removed by the ON DELETE CASCADE constraint
+func (sp *sqlitePeople) Delete(id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+	return sqliteExec(sp.DB, `DELETE FROM people WHERE id = ?`, id)
+}
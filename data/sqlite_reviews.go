@@ -0,0 +1,160 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// sqliteReviews store the reviews in SQLite, the rating aggregates of the movies are updated by the
+// reviews_rating triggers in the same transaction
+type sqliteReviews struct {
+	*sql.DB
+}
+
+func (sr *sqliteReviews) Insert(review *Review) error {
+	stmt := `INSERT INTO reviews (movie_id, user_id, rating, body)
+	VALUES (?, ?, ?, ?)
+	RETURNING id, created_at, version`
+	args := []interface{}{review.MovieID, review.UserID, review.Rating, review.Body}
+
+	ctx, cancel := context.WithTimeout(context.Background(), QueryTimeOut*time.Second)
+	defer cancel()
+
+	err := sr.DB.QueryRowContext(ctx, stmt, args...).Scan(&review.ID, &review.CreatedAt, &review.Version)
+	if err != nil {
+		switch {
+		case err.Error() == ErrReviewConstraintSQLite:
+			return ErrDuplicatedReview
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+func (sr *sqliteReviews) GetForUser(movieID, userID int64) (*Review, error) {
+	stmt := `SELECT id, created_at, movie_id, user_id, rating, body, version
+	FROM reviews
+	WHERE movie_id = ? AND user_id = ?`
+
+	var review Review
+
+	ctx, cancel := context.WithTimeout(context.Background(), QueryTimeOut*time.Second)
+	defer cancel()
+
+	err := sr.DB.QueryRowContext(ctx, stmt, movieID, userID).Scan(&review.ID, &review.CreatedAt, &review.MovieID,
+		&review.UserID, &review.Rating, &review.Body, &review.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &review, nil
+}
+
+func (sr *sqliteReviews) GetAllForUser(userID int64) ([]*Review, error) {
+	stmt := `SELECT id, created_at, movie_id, user_id, rating, body, version
+	FROM reviews
+	WHERE user_id = ?
+	ORDER BY created_at DESC, id DESC`
+
+	ctx, cancel := context.WithTimeout(context.Background(), QueryTimeOut*time.Second)
+	defer cancel()
+
+	r, err := sr.DB.QueryContext(ctx, stmt, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	reviews := []*Review{}
+	for r.Next() {
+		var review Review
+		err = r.Scan(&review.ID, &review.CreatedAt, &review.MovieID, &review.UserID, &review.Rating, &review.Body,
+			&review.Version)
+		if err != nil {
+			return nil, err
+		}
+		reviews = append(reviews, &review)
+	}
+	if err := r.Err(); err != nil {
+		return nil, err
+	}
+	return reviews, nil
+}
+
+//nolint:gosec
+func (sr *sqliteReviews) GetAllForMovie(movieID int64, filters Filters) ([]*Review, Metadata, error) {
+	stmt := fmt.Sprintf(`SELECT count(*) OVER(), reviews.id, reviews.created_at, reviews.movie_id, reviews.user_id,
+						users.name, reviews.rating, reviews.body, reviews.version
+						FROM reviews
+						INNER JOIN users ON users.id = reviews.user_id
+						WHERE reviews.movie_id = ?
+						ORDER BY reviews.%s %s, reviews.id ASC
+						LIMIT ? OFFSET ?`, filters.sortColumn(), filters.sortDirection())
+	args := []interface{}{movieID, filters.limit(), filters.offset()}
+
+	ctx, cancel := context.WithTimeout(context.Background(), QueryTimeOut*time.Second)
+	defer cancel()
+
+	r, err := sr.DB.QueryContext(ctx, stmt, args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer r.Close()
+
+	totalRecords := 0
+	reviews := []*Review{}
+	for r.Next() {
+		var review Review
+		err := r.Scan(&totalRecords, &review.ID, &review.CreatedAt, &review.MovieID, &review.UserID, &review.UserName,
+			&review.Rating, &review.Body, &review.Version)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		reviews = append(reviews, &review)
+	}
+	if err := r.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+	metadata := calcMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return reviews, metadata, nil
+}
+
+func (sr *sqliteReviews) Update(review *Review) error {
+	stmt := `UPDATE reviews
+	SET rating = ?, body = ?, version = version + 1
+	WHERE id = ? AND version = ?
+	RETURNING version`
+	args := []interface{}{review.Rating, review.Body, review.ID, review.Version}
+
+	ctx, cancel := context.WithTimeout(context.Background(), QueryTimeOut*time.Second)
+	defer cancel()
+
+	err := sr.DB.QueryRowContext(ctx, stmt, args...).Scan(&review.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+// Delete remove a review using the version to avoid deleting a review changed after it was read
+func (sr *sqliteReviews) Delete(review *Review) error {
+	err := sqliteExec(sr.DB, `DELETE FROM reviews WHERE id = ? AND version = ?`, review.ID, review.Version)
+	if errors.Is(err, ErrRecordNotFound) {
+		return ErrEditConflict
+	}
+	return err
+}
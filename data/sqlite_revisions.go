@@ -0,0 +1,115 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// sqliteRevisions read the history of the movies recorded by sqliteMovies
+type sqliteRevisions struct {
+	*sql.DB
+}
+
+//nolint:gosec
+func (sr *sqliteRevisions) GetAllForMovie(movieID int64, filters Filters) ([]*Revision, Metadata, error) {
+	stmt := fmt.Sprintf(`SELECT count(*) OVER(), movie_revisions.id, movie_revisions.created_at, movie_revisions.movie_id,
+						movie_revisions.version, movie_revisions.action, movie_revisions.user_id, users.name,
+						movie_revisions.title, movie_revisions.year, movie_revisions.runtime, movie_revisions.genres
+						FROM movie_revisions
+						LEFT JOIN users ON users.id = movie_revisions.user_id
+						WHERE movie_revisions.movie_id = ?
+						ORDER BY movie_revisions.%s %s, movie_revisions.id %s
+						LIMIT ? OFFSET ?`, filters.sortColumn(), filters.sortDirection(), filters.sortDirection())
+	args := []interface{}{movieID, filters.limit(), filters.offset()}
+
+	ctx, cancel := context.WithTimeout(context.Background(), QueryTimeOut*time.Second)
+	defer cancel()
+
+	r, err := sr.DB.QueryContext(ctx, stmt, args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer r.Close()
+
+	totalRecords := 0
+	revisions := []*Revision{}
+	for r.Next() {
+		var rev Revision
+		err := r.Scan(&totalRecords, &rev.ID, &rev.CreatedAt, &rev.MovieID, &rev.Version, &rev.Action, &rev.UserID,
+			&rev.UserName, &rev.Title, &rev.Year, &rev.Runtime, jsonArray{&rev.Genres})
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		revisions = append(revisions, &rev)
+	}
+	if err := r.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+	metadata := calcMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return revisions, metadata, nil
+}
+
+func (sr *sqliteRevisions) GetAllForUser(userID int64) ([]*Revision, error) {
+	stmt := `SELECT id, created_at, movie_id, version, action, user_id, title, year, runtime, genres
+	FROM movie_revisions
+	WHERE user_id = ?
+	ORDER BY created_at DESC, id DESC`
+
+	ctx, cancel := context.WithTimeout(context.Background(), QueryTimeOut*time.Second)
+	defer cancel()
+
+	r, err := sr.DB.QueryContext(ctx, stmt, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	revisions := []*Revision{}
+	for r.Next() {
+		var rev Revision
+		err = r.Scan(&rev.ID, &rev.CreatedAt, &rev.MovieID, &rev.Version, &rev.Action, &rev.UserID, &rev.Title,
+			&rev.Year, &rev.Runtime, jsonArray{&rev.Genres})
+		if err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, &rev)
+	}
+	if err := r.Err(); err != nil {
+		return nil, err
+	}
+	return revisions, nil
+}
+
+func (sr *sqliteRevisions) Get(movieID int64, version int32) (*Revision, error) {
+	stmt := `SELECT movie_revisions.id, movie_revisions.created_at, movie_revisions.movie_id, movie_revisions.version,
+	movie_revisions.action, movie_revisions.user_id, users.name, movie_revisions.title, movie_revisions.year,
+	movie_revisions.runtime, movie_revisions.genres
+	FROM movie_revisions
+	LEFT JOIN users ON users.id = movie_revisions.user_id
+	WHERE movie_revisions.movie_id = ? AND movie_revisions.version = ?
+	AND movie_revisions.action IN ('insert', 'update')
+	ORDER BY movie_revisions.id
+	LIMIT 1`
+
+	var rev Revision
+
+	ctx, cancel := context.WithTimeout(context.Background(), QueryTimeOut*time.Second)
+	defer cancel()
+
+	err := sr.DB.QueryRowContext(ctx, stmt, movieID, version).Scan(&rev.ID, &rev.CreatedAt, &rev.MovieID,
+		&rev.Version, &rev.Action, &rev.UserID, &rev.UserName, &rev.Title, &rev.Year, &rev.Runtime,
+		jsonArray{&rev.Genres})
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &rev, nil
+}
@@ -0,0 +1,179 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+type sqliteRoles struct {
+	*sql.DB
+}
+
+// setPermissions replace the permissions of a role in the transaction of the insert or update, SQLite does not
+// support modifying data in a WITH clause
+func (sr *sqliteRoles) setPermissions(ctx context.Context, tx *sql.Tx, role *Role) error {
+	_, err := tx.ExecContext(ctx, `DELETE FROM role_permissions WHERE role_id = ?`, role.ID)
+	if err != nil {
+		return err
+	}
+	stmt := `INSERT INTO role_permissions
+	SELECT ?, permissions.id FROM permissions WHERE permissions.code IN (SELECT value FROM json_each(?))`
+	_, err = tx.ExecContext(ctx, stmt, role.ID, sqliteJSON(role.Permissions))
+	return err
+}
+
+func (sr *sqliteRoles) Insert(role *Role) error {
+	ctx, cancel := context.WithTimeout(context.Background(), QueryTimeOut*time.Second)
+	defer cancel()
+
+	tx, err := sr.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() //nolint:errcheck
+
+	stmt := `INSERT INTO roles (name)
+	VALUES (?)
+	RETURNING id, created_at, version`
+	err = tx.QueryRowContext(ctx, stmt, role.Name).Scan(&role.ID, &role.CreatedAt, &role.Version)
+	if err != nil {
+		switch {
+		case err.Error() == ErrRoleNameConstraintSQLite:
+			return ErrDuplicatedRole
+		default:
+			return err
+		}
+	}
+
+	err = sr.setPermissions(ctx, tx, role)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// sqliteRoleSelect select the roles with their permission codes sorted, the conditions are added by the callers
+const sqliteRoleSelect = `SELECT roles.id, roles.created_at, roles.name,
+	COALESCE((SELECT json_group_array(code) FROM (
+		SELECT permissions.code FROM role_permissions
+		INNER JOIN permissions ON permissions.id = role_permissions.permission_id
+		WHERE role_permissions.role_id = roles.id
+		ORDER BY permissions.code)), '[]'),
+	roles.version
+	FROM roles`
+
+func (sr *sqliteRoles) query(stmt string, args ...interface{}) ([]*Role, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), QueryTimeOut*time.Second)
+	defer cancel()
+
+	rows, err := sr.DB.QueryContext(ctx, stmt, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	roles := []*Role{}
+	for rows.Next() {
+		var role Role
+		perms := []string{}
+		err = rows.Scan(&role.ID, &role.CreatedAt, &role.Name, jsonArray{&perms}, &role.Version)
+		if err != nil {
+			return nil, err
+		}
+		role.Permissions = perms
+		roles = append(roles, &role)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return roles, nil
+}
+
+func (sr *sqliteRoles) GetAll() ([]*Role, error) {
+	return sr.query(sqliteRoleSelect + `
+	ORDER BY roles.name`)
+}
+
+func (sr *sqliteRoles) Get(id int64) (*Role, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+	roles, err := sr.query(sqliteRoleSelect+`
+	WHERE roles.id = ?`, id)
+	if err != nil {
+		return nil, err
+	}
+	if len(roles) == 0 {
+		return nil, ErrRecordNotFound
+	}
+	return roles[0], nil
+}
+
+func (sr *sqliteRoles) GetAllForUser(userID int64) ([]*Role, error) {
+	return sr.query(sqliteRoleSelect+`
+	WHERE roles.id IN (SELECT role_id FROM user_roles WHERE user_id = ?)
+	ORDER BY roles.name`, userID)
+}
+
+func (sr *sqliteRoles) Update(role *Role) error {
+	ctx, cancel := context.WithTimeout(context.Background(), QueryTimeOut*time.Second)
+	defer cancel()
+
+	tx, err := sr.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() //nolint:errcheck
+
+	stmt := `UPDATE roles
+	SET name = ?, version = version + 1
+	WHERE id = ? AND version = ?
+	RETURNING version`
+	err = tx.QueryRowContext(ctx, stmt, role.Name, role.ID, role.Version).Scan(&role.Version)
+	if err != nil {
+		switch {
+		case err.Error() == ErrRoleNameConstraintSQLite:
+			return ErrDuplicatedRole
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	err = sr.setPermissions(ctx, tx, role)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (sr *sqliteRoles) Delete(id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+	return sqliteExec(sr.DB, `DELETE FROM roles WHERE id = ?`, id)
+}
+
+func (sr *sqliteRoles) AddForUser(userID, roleID int64) error {
+	stmt := `INSERT OR IGNORE INTO user_roles (user_id, role_id)
+	VALUES (?, ?)`
+
+	ctx, cancel := context.WithTimeout(context.Background(), QueryTimeOut*time.Second)
+	defer cancel()
+
+	_, err := sr.DB.ExecContext(ctx, stmt, userID, roleID)
+	return err
+}
+
+func (sr *sqliteRoles) RemoveForUser(userID, roleID int64) error {
+	stmt := `DELETE FROM user_roles WHERE user_id = ? AND role_id = ?`
+
+	ctx, cancel := context.WithTimeout(context.Background(), QueryTimeOut*time.Second)
+	defer cancel()
+
+	_, err := sr.DB.ExecContext(ctx, stmt, userID, roleID)
+	return err
+}
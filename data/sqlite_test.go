@@ -0,0 +1,24 @@
+package data
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+)
+
+// TestSQLiteModels need cgo and the sqlite_fts5 build tag, the reason is reported when the test is skipped
+func TestSQLiteModels(t *testing.T) {
+	dsn := SQLiteDSN(filepath.Join(t.TempDir(), "movies.db"))
+	db, err := sql.Open(SQLiteDriver, dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = CheckSQLite(db)
+	db.Close()
+	if err != nil {
+		t.Skipf("SQLite models not tested: %v", err)
+	}
+
+	db = openTestDB(t, SQLiteDriver, dsn, BackendSQLite)
+	testModels(t, NewSQLiteModels(db))
+}
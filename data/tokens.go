@@ -6,6 +6,7 @@ import (
 	"crypto/sha256"
 	"database/sql"
 	"encoding/base32"
+	"errors"
 	"time"
 
 	"github.com/eze8789/movies-api/validator"
@@ -15,9 +16,15 @@ const (
 	ActivationTokenDuration      = 12 * time.Hour
 	AuthenticationTokenDuration  = 4 * time.Hour
 	PasswordRecoverTokenDuration = time.Hour
+	EmailChangeTokenDuration     = 24 * time.Hour
+	EmailRevertTokenDuration     = 7 * 24 * time.Hour
+	DataExportTokenDuration      = 24 * time.Hour
 	ScopeActivation              = "activation"
 	ScopeAuthentication          = "authentication"
 	ScopePasswordReset           = "password-reset"
+	ScopeEmailChange             = "email-change"
+	ScopeEmailRevert             = "email-revert"
+	ScopeDataExport              = "data-export"
 )
 
 type Token struct {
@@ -26,6 +33,8 @@ type Token struct {
 	UserID      int64     `json:"-"`
 	Expiry      time.Time `json:"expiry"`
 	Scope       string    `json:"-"`
+	// Email is the address set when an email-change token is confirmed or an email-revert token is used
+	Email string `json:"-"`
 }
 
 type TokensModel struct {
@@ -65,9 +74,9 @@ func ValidateTokenPlain(v *validator.Validator, tokenPlain string) {
 
 // Insert write a new Token to the tokens DB
 func (tm *TokensModel) Insert(token *Token) error {
-	stmt := `INSERT INTO tokens (hash, user_id, expiry, scope)
-	VALUES ($1, $2, $3, $4)`
-	args := []interface{}{token.HashedToken, token.UserID, token.Expiry, token.Scope}
+	stmt := `INSERT INTO tokens (hash, user_id, expiry, scope, email)
+	VALUES ($1, $2, $3, $4, $5)`
+	args := []interface{}{token.HashedToken, token.UserID, token.Expiry, token.Scope, token.Email}
 
 	ctx, cancel := context.WithTimeout(context.Background(), QueryTimeOut*time.Second)
 	defer cancel()
@@ -88,6 +97,75 @@ func (tm *TokensModel) New(userID int64, ttl time.Duration, scope string) (*Toke
 	return token, err
 }
 
+// NewForEmail generate and store a token holding the email address it confirm
+func (tm *TokensModel) NewForEmail(userID int64, ttl time.Duration, scope, email string) (*Token, error) {
+	token, err := generateToken(userID, ttl, scope)
+	if err != nil {
+		return nil, err
+	}
+	token.Email = email
+
+	err = tm.Insert(token)
+	return token, err
+}
+
+// Get return the token of the scope when it is not expired, the plain token is not stored so it is not set
+func (tm *TokensModel) Get(tokenPlain, scope string) (*Token, error) {
+	tokenHash := sha256.Sum256([]byte(tokenPlain))
+
+	stmt := `SELECT hash, user_id, expiry, scope, email
+	FROM tokens
+	WHERE hash = $1 AND scope = $2 AND expiry > $3`
+	args := []interface{}{tokenHash[:], scope, time.Now()}
+
+	ctx, cancel := context.WithTimeout(context.Background(), QueryTimeOut*time.Second)
+	defer cancel()
+
+	var token Token
+	err := tm.DB.QueryRowContext(ctx, stmt, args...).Scan(&token.HashedToken, &token.UserID, &token.Expiry,
+		&token.Scope, &token.Email)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &token, nil
+}
+
+// GetAllForUser return the tokens of a user that did not expire, the newest first
+func (tm *TokensModel) GetAllForUser(userID int64) ([]*Token, error) {
+	stmt := `SELECT hash, user_id, expiry, scope, email
+	FROM tokens
+	WHERE user_id = $1 AND expiry > $2
+	ORDER BY expiry DESC`
+
+	ctx, cancel := context.WithTimeout(context.Background(), QueryTimeOut*time.Second)
+	defer cancel()
+
+	rows, err := tm.DB.QueryContext(ctx, stmt, userID, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tokens := []*Token{}
+	for rows.Next() {
+		var t Token
+		err = rows.Scan(&t.HashedToken, &t.UserID, &t.Expiry, &t.Scope, &t.Email)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, &t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
 // DeleteAllByUser delete all tokens associated within a user with an specific scope
 func (tm *TokensModel) DeleteAllByUser(userID int64, scope string) error {
 	stmt := `DELETE FROM tokens
@@ -101,3 +179,14 @@ func (tm *TokensModel) DeleteAllByUser(userID int64, scope string) error {
 
 	return err
 }
+
+// DeleteAllForUser remove the tokens of every scope of a user, used to sign out a user from every client
+func (tm *TokensModel) DeleteAllForUser(userID int64) error {
+	stmt := `DELETE FROM tokens WHERE user_id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), QueryTimeOut*time.Second)
+	defer cancel()
+
+	_, err := tm.DB.ExecContext(ctx, stmt, userID)
+	return err
+}
@@ -22,7 +22,11 @@ type User struct {
 	Email     string    `json:"email"`
 	Password  password  `json:"-"`
 	Activated bool      `json:"activated"`
-	Version   int       `json:"-"`
+	// DeleteAfter is set when the user request the deletion of the account, the user is deleted once it pass
+	DeleteAfter *time.Time `json:"delete_after,omitempty"`
+	Version     int        `json:"-"`
+	// tokenExpiry is the expiry of the token used to read the user, it is only set by GetForToken
+	tokenExpiry time.Time
 }
 
 type password struct {
@@ -122,10 +126,11 @@ func (um *UserModel) Insert(user *User) error {
 
 func (um *UserModel) Update(user *User) error {
 	stmt := `UPDATE users
-	SET name = $1, email = $2, password_hash = $3, activated = $4, version = version + 1
-	WHERE id = $5 AND version = $6
+	SET name = $1, email = $2, password_hash = $3, activated = $4, delete_after = $5, version = version + 1
+	WHERE id = $6 AND version = $7
 	RETURNING version`
-	args := []interface{}{user.Name, user.Email, user.Password.hashedPWD, user.Activated, user.ID, user.Version}
+	args := []interface{}{user.Name, user.Email, user.Password.hashedPWD, user.Activated, user.DeleteAfter, user.ID,
+		user.Version}
 
 	ctx, cancel := context.WithTimeout(context.Background(), QueryTimeOut*time.Second)
 	defer cancel()
@@ -144,8 +149,34 @@ func (um *UserModel) Update(user *User) error {
 	return nil
 }
 
+func (um *UserModel) Get(id int64) (*User, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+	stmt := `SELECT id, created_at, name, email, password_hash, activated, delete_after, version
+	FROM users
+	WHERE id = $1`
+
+	var user User
+	ctx, cancel := context.WithTimeout(context.Background(), QueryTimeOut*time.Second)
+	defer cancel()
+
+	err := um.DB.QueryRowContext(ctx, stmt, id).Scan(&user.ID, &user.CreatedAT, &user.Name,
+		&user.Email, &user.Password.hashedPWD, &user.Activated, &user.DeleteAfter, &user.Version)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &user, nil
+}
+
 func (um *UserModel) GetByEmail(e string) (*User, error) {
-	stmt := `SELECT id, created_at, name, email, password_hash, activated, version
+	stmt := `SELECT id, created_at, name, email, password_hash, activated, delete_after, version
 	FROM users
 	WHERE email = $1`
 
@@ -154,7 +185,7 @@ func (um *UserModel) GetByEmail(e string) (*User, error) {
 	defer cancel()
 
 	err := um.DB.QueryRowContext(ctx, stmt, e).Scan(&user.ID, &user.CreatedAT, &user.Name,
-		&user.Email, &user.Password.hashedPWD, &user.Activated, &user.Version)
+		&user.Email, &user.Password.hashedPWD, &user.Activated, &user.DeleteAfter, &user.Version)
 
 	if err != nil {
 		switch {
@@ -171,7 +202,8 @@ func (um *UserModel) GetForToken(token, scope string) (*User, error) {
 	// calculate hash before compare
 	tokenHash := sha256.Sum256([]byte(token))
 
-	stmt := ` SELECT users.id, users.created_at, users.name, users.email, users.password_hash, users.activated, users.version
+	stmt := ` SELECT users.id, users.created_at, users.name, users.email, users.password_hash, users.activated,
+	users.delete_after, users.version, tokens.expiry
 	FROM users
 	INNER JOIN tokens
 	ON users.id = tokens.user_id
@@ -183,7 +215,7 @@ func (um *UserModel) GetForToken(token, scope string) (*User, error) {
 
 	var user User
 	err := um.DB.QueryRowContext(ctx, stmt, args...).Scan(&user.ID, &user.CreatedAT, &user.Name, &user.Email,
-		&user.Password.hashedPWD, &user.Activated, &user.Version)
+		&user.Password.hashedPWD, &user.Activated, &user.DeleteAfter, &user.Version, &user.tokenExpiry)
 	if err != nil {
 		switch {
 		case errors.Is(err, sql.ErrNoRows):
@@ -195,3 +227,34 @@ func (um *UserModel) GetForToken(token, scope string) (*User, error) {
 
 	return &user, nil
 }
+
+// DeleteScheduledBefore delete the users with a deletion scheduled before t and return their ids, the tokens,
+// permissions, reviews and lists of the users are deleted by the foreign keys
+func (um *UserModel) DeleteScheduledBefore(t time.Time) ([]int64, error) {
+	stmt := `DELETE FROM users
+	WHERE delete_after <= $1
+	RETURNING id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), QueryTimeOut*time.Second)
+	defer cancel()
+
+	rows, err := um.DB.QueryContext(ctx, stmt, t)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []int64{}
+	for rows.Next() {
+		var id int64
+		err = rows.Scan(&id)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
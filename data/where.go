@@ -0,0 +1,101 @@
+package data
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+const (
+	GenresAll  = "all"
+	GenresAny  = "any"
+	GenresNone = "none"
+)
+
+// whereBuilder build the conditions of a query from the filters set, every value is passed as a numbered
+// parameter so only the conditions needed are added to the statement
+type whereBuilder struct {
+	conditions []string
+	args       []interface{}
+	// placeholder is the prefix of the numbered parameters, $ is used when it is empty
+	placeholder string
+}
+
+// param add a query argument and return its placeholder
+func (b *whereBuilder) param(value interface{}) string {
+	b.args = append(b.args, value)
+	if b.placeholder == "" {
+		return fmt.Sprintf("$%d", len(b.args))
+	}
+	return fmt.Sprintf("%s%d", b.placeholder, len(b.args))
+}
+
+// where add a condition, the values are added with param
+func (b *whereBuilder) where(condition string) {
+	b.conditions = append(b.conditions, condition)
+}
+
+func (b *whereBuilder) String() string {
+	if len(b.conditions) == 0 {
+		return "true"
+	}
+	return strings.Join(b.conditions, "\n\tAND ")
+}
+
+// movieConditions add the conditions shared by the movie searches and return the clause to search by title,
+// the clause use the title parameter so it can be used to rank and highlight the movies
+func movieConditions(b *whereBuilder, title string, fuzzy bool, genres []string, personID int64,
+	filters Filters) searchClause {
+	b.where("deleted_at IS NULL")
+
+	sc := titleSearch("", false, "")
+	if title != "" {
+		sc = titleSearch(title, fuzzy, b.param(title))
+		b.where(sc.where)
+	}
+
+	if len(genres) > 0 {
+		p := b.param(pq.Array(genres))
+		switch filters.GenresMode {
+		case GenresAny:
+			b.where(fmt.Sprintf("genres && %s", p))
+		case GenresNone:
+			b.where(fmt.Sprintf("NOT genres && %s", p))
+		default:
+			b.where(fmt.Sprintf("genres @> %s", p))
+		}
+	}
+	if personID > 0 {
+		b.where(fmt.Sprintf("id IN (SELECT movie_id FROM credits WHERE person_id = %s)", b.param(personID)))
+	}
+
+	if filters.YearMin > 0 {
+		b.where(fmt.Sprintf("year >= %s", b.param(filters.YearMin)))
+	}
+	if filters.YearMax > 0 {
+		b.where(fmt.Sprintf("year <= %s", b.param(filters.YearMax)))
+	}
+	if filters.Decade > 0 {
+		b.where(fmt.Sprintf("year BETWEEN %s AND %s", b.param(filters.Decade), b.param(filters.Decade+9))) //nolint:gomnd
+	}
+
+	if filters.RuntimeMin > 0 {
+		b.where(fmt.Sprintf("runtime >= %s", b.param(filters.RuntimeMin)))
+	}
+	if filters.RuntimeMax > 0 {
+		b.where(fmt.Sprintf("runtime <= %s", b.param(filters.RuntimeMax)))
+	}
+	if filters.RuntimeBucket != "" {
+		bucket := runtimeBucket(filters.RuntimeBucket)
+		b.where(fmt.Sprintf("runtime >= %s AND runtime < %s", b.param(bucket.Min), b.param(bucket.Max)))
+	}
+
+	if !filters.CreatedAfter.IsZero() {
+		b.where(fmt.Sprintf("created_at >= %s", b.param(filters.CreatedAfter)))
+	}
+	if !filters.CreatedBefore.IsZero() {
+		b.where(fmt.Sprintf("created_at < %s", b.param(filters.CreatedBefore)))
+	}
+	return sc
+}
@@ -0,0 +1,7 @@
+DROP TRIGGER IF EXISTS reviews_rating_aggregate ON reviews;
+DROP FUNCTION IF EXISTS movies_rating_aggregate();
+DROP TABLE IF EXISTS reviews;
+DROP INDEX IF EXISTS movie_average_rating_idx;
+ALTER TABLE movies DROP COLUMN IF EXISTS average_rating;
+ALTER TABLE movies DROP COLUMN IF EXISTS rating_count;
+ALTER TABLE movies DROP COLUMN IF EXISTS rating_sum;
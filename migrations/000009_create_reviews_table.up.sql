@@ -0,0 +1,44 @@
+CREATE TABLE IF NOT EXISTS reviews (
+    id bigserial PRIMARY KEY,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    movie_id bigint NOT NULL REFERENCES movies ON DELETE CASCADE,
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    rating integer NOT NULL,
+    body text NOT NULL DEFAULT '',
+    version integer NOT NULL DEFAULT 1,
+    UNIQUE (movie_id, user_id)
+);
+
+ALTER TABLE reviews ADD CONSTRAINT reviews_rating_check CHECK (rating BETWEEN 1 AND 10);
+
+ALTER TABLE movies ADD COLUMN IF NOT EXISTS rating_sum bigint NOT NULL DEFAULT 0;
+ALTER TABLE movies ADD COLUMN IF NOT EXISTS rating_count integer NOT NULL DEFAULT 0;
+ALTER TABLE movies ADD COLUMN IF NOT EXISTS average_rating real NOT NULL DEFAULT 0;
+
+CREATE INDEX IF NOT EXISTS movie_average_rating_idx ON movies (average_rating, id);
+
+-- aggregates are kept in the same transaction as the review change, the row lock taken by the
+-- UPDATE serializes concurrent reviews of the same movie and cascaded deletes are also counted
+CREATE OR REPLACE FUNCTION movies_rating_aggregate() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP IN ('UPDATE', 'DELETE') THEN
+        UPDATE movies
+        SET rating_sum = rating_sum - OLD.rating,
+            rating_count = rating_count - 1,
+            average_rating = COALESCE((rating_sum - OLD.rating)::real / NULLIF(rating_count - 1, 0), 0)
+        WHERE id = OLD.movie_id;
+    END IF;
+    IF TG_OP IN ('INSERT', 'UPDATE') THEN
+        UPDATE movies
+        SET rating_sum = rating_sum + NEW.rating,
+            rating_count = rating_count + 1,
+            average_rating = (rating_sum + NEW.rating)::real / (rating_count + 1)
+        WHERE id = NEW.movie_id;
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER reviews_rating_aggregate
+AFTER INSERT OR UPDATE OF rating OR DELETE ON reviews
+FOR EACH ROW EXECUTE PROCEDURE movies_rating_aggregate();
@@ -0,0 +1,3 @@
+DELETE FROM permissions WHERE code = 'movies:admin';
+DROP INDEX IF EXISTS movie_deleted_at_idx;
+ALTER TABLE movies DROP COLUMN IF EXISTS deleted_at;
@@ -0,0 +1,21 @@
+CREATE TABLE IF NOT EXISTS movie_revisions (
+    id bigserial PRIMARY KEY,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    movie_id bigint NOT NULL REFERENCES movies ON DELETE CASCADE,
+    version integer NOT NULL,
+    action text NOT NULL,
+    user_id bigint REFERENCES users ON DELETE SET NULL,
+    title text NOT NULL,
+    year integer NOT NULL,
+    runtime integer NOT NULL,
+    genres text[] NOT NULL
+);
+
+ALTER TABLE movie_revisions ADD CONSTRAINT movie_revisions_action_check
+    CHECK (action IN ('insert', 'update', 'delete', 'restore'));
+
+CREATE INDEX IF NOT EXISTS movie_revisions_movie_idx ON movie_revisions (movie_id, version);
+
+-- existing movies start their history with the current values
+INSERT INTO movie_revisions (movie_id, version, action, title, year, runtime, genres)
+SELECT id, version, 'insert', title, year, runtime, genres FROM movies;
@@ -0,0 +1,73 @@
+CREATE TABLE IF NOT EXISTS genres (
+    id bigserial PRIMARY KEY,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    slug text NOT NULL UNIQUE,
+    name text NOT NULL,
+    aliases text[] NOT NULL DEFAULT '{}',
+    version integer NOT NULL DEFAULT 1
+);
+
+CREATE INDEX IF NOT EXISTS genres_aliases_idx ON genres USING GIN (aliases);
+
+-- the default catalogue is created before the backfill so the spellings used by the movies map to its genres
+INSERT INTO genres (slug, name, aliases)
+VALUES
+    ('action', 'Action', '{}'),
+    ('adventure', 'Adventure', '{}'),
+    ('animation', 'Animation', '{animated}'),
+    ('comedy', 'Comedy', '{}'),
+    ('crime', 'Crime', '{}'),
+    ('documentary', 'Documentary', '{doc}'),
+    ('drama', 'Drama', '{}'),
+    ('family', 'Family', '{}'),
+    ('fantasy', 'Fantasy', '{}'),
+    ('history', 'History', '{historical}'),
+    ('horror', 'Horror', '{}'),
+    ('music', 'Music', '{musical}'),
+    ('mystery', 'Mystery', '{}'),
+    ('romance', 'Romance', '{romantic}'),
+    ('sci-fi', 'Sci-Fi', '{science fiction,science-fiction,scifi}'),
+    ('thriller', 'Thriller', '{}'),
+    ('war', 'War', '{}'),
+    ('western', 'Western', '{}')
+ON CONFLICT DO NOTHING;
+
+-- every spelling used by the movies is mapped to the genre with the same slug, name or alias, so "Science
+-- Fiction" and "Sci-Fi" both become sci-fi
+CREATE TEMPORARY TABLE genre_spellings AS
+SELECT DISTINCT g AS spelling, lower(trim(g)) AS name,
+    COALESCE(NULLIF(trim(both '-' FROM regexp_replace(lower(trim(g)), '[^a-z0-9]+', '-', 'g')), ''), 'other') AS slug
+FROM movies, unnest(genres) AS g;
+
+UPDATE genre_spellings SET slug = genres.slug
+FROM genres
+WHERE genre_spellings.name IN (genres.slug, lower(genres.name))
+    OR genres.aliases && ARRAY[genre_spellings.name, genre_spellings.slug];
+
+-- the spellings without a genre become new genres and every spelling is kept as an alias of its genre
+INSERT INTO genres (slug, name)
+SELECT slug, min(trim(spelling))
+FROM genre_spellings
+GROUP BY slug
+ON CONFLICT DO NOTHING;
+
+UPDATE genres SET aliases = aliases || ARRAY(
+    SELECT DISTINCT genre_spellings.name FROM genre_spellings
+    WHERE genre_spellings.slug = genres.slug AND genre_spellings.name NOT IN (genres.slug, lower(genres.name))
+        AND NOT genres.aliases @> ARRAY[genre_spellings.name]
+    ORDER BY genre_spellings.name
+)
+WHERE slug IN (SELECT slug FROM genre_spellings);
+
+-- movies store the slugs, duplicated genres are removed keeping the original order
+UPDATE movies SET genres = ARRAY(
+    SELECT slug FROM (
+        SELECT genre_spellings.slug, min(ord) AS ord
+        FROM unnest(movies.genres) WITH ORDINALITY AS t(g, ord)
+        INNER JOIN genre_spellings ON genre_spellings.spelling = t.g
+        GROUP BY genre_spellings.slug
+    ) AS normalized
+    ORDER BY ord
+);
+
+DROP TABLE genre_spellings;
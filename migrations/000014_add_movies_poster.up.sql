@@ -0,0 +1,3 @@
+-- poster hold the url of the original image and the thumbnails, poster_key the storage prefix of the files
+ALTER TABLE movies ADD COLUMN IF NOT EXISTS poster jsonb;
+ALTER TABLE movies ADD COLUMN IF NOT EXISTS poster_key text;
@@ -0,0 +1,2 @@
+DELETE FROM tokens WHERE scope IN ('email-change', 'email-revert');
+ALTER TABLE tokens DROP COLUMN IF EXISTS email;
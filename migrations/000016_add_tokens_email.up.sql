@@ -0,0 +1,2 @@
+-- email hold the address confirmed by the email-change and email-revert tokens
+ALTER TABLE tokens ADD COLUMN IF NOT EXISTS email citext NOT NULL DEFAULT '';
@@ -0,0 +1,3 @@
+-- delete_after is set when a user request the deletion of the account, the user is deleted once it pass
+ALTER TABLE users ADD COLUMN IF NOT EXISTS delete_after timestamp(0) with time zone;
+CREATE INDEX IF NOT EXISTS users_delete_after_idx ON users (delete_after) WHERE delete_after IS NOT NULL;
@@ -0,0 +1,328 @@
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	BackendPostgres = "postgres"
+	BackendSQLite   = "sqlite"
+
+	// lockKey identify the Postgres advisory lock held while the migrations run
+	lockKey int64 = 4125327001
+)
+
+//go:embed *.sql
+var postgresFS embed.FS
+
+//go:embed sqlite/*.sql
+var sqliteFS embed.FS
+
+var (
+	ErrDirty          = errors.New("database is dirty, fix the failed migration and force its version")
+	ErrUnknownVersion = errors.New("unknown migration version")
+)
+
+// Migration is a schema change read from its up and down SQL files, the version is the file prefix
+type Migration struct {
+	Version int64
+	Name    string
+	up      string
+	down    string
+}
+
+// Migrator apply the embedded migrations of a backend, the applied version is stored in the schema_migrations
+// table used by the migrate CLI so databases migrated with the CLI keep working
+type Migrator struct {
+	db         *sql.DB
+	backend    string
+	Migrations []Migration
+}
+
+// New return a migrator for the backend, postgres or sqlite like data.Models.Backend
+func New(db *sql.DB, backend string) (*Migrator, error) {
+	var fsys fs.FS = postgresFS
+	dir := "."
+	switch backend {
+	case BackendPostgres:
+	case BackendSQLite:
+		fsys, dir = sqliteFS, "sqlite"
+	default:
+		return nil, fmt.Errorf("migrations are not available for the %s backend", backend)
+	}
+
+	migrations, err := read(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{db: db, backend: backend, Migrations: migrations}, nil
+}
+
+// read parse the files named <version>_<name>.<up|down>.sql sorted by version
+func read(fsys fs.FS, dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int64]*Migration)
+	for _, e := range entries {
+		parts := strings.SplitN(e.Name(), "_", 2) //nolint:gomnd
+		if e.IsDir() || len(parts) != 2 {
+			continue
+		}
+		var version int64
+		version, err = strconv.ParseInt(parts[0], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid migration file %s: %w", e.Name(), err)
+		}
+
+		var b []byte
+		b, err = fs.ReadFile(fsys, path.Join(dir, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version}
+			byVersion[version] = m
+		}
+		switch {
+		case strings.HasSuffix(parts[1], ".up.sql"):
+			m.Name, m.up = strings.TrimSuffix(parts[1], ".up.sql"), string(b)
+		case strings.HasSuffix(parts[1], ".down.sql"):
+			m.down = string(b)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// Latest return the version of the last migration
+func (m *Migrator) Latest() int64 {
+	if len(m.Migrations) == 0 {
+		return 0
+	}
+	return m.Migrations[len(m.Migrations)-1].Version
+}
+
+// Version return the version applied and if the last migration run by the migrate CLI failed
+func (m *Migrator) Version(ctx context.Context) (int64, bool, error) {
+	err := m.createTable(ctx)
+	if err != nil {
+		return 0, false, err
+	}
+	return version(ctx, m.db)
+}
+
+// Up apply every pending migration and return the amount applied
+func (m *Migrator) Up(ctx context.Context) (int, error) {
+	return m.Goto(ctx, m.Latest())
+}
+
+// Down revert the last n migrations applied
+func (m *Migrator) Down(ctx context.Context, n int) (int, error) {
+	current, _, err := m.Version(ctx)
+	if err != nil {
+		return 0, err
+	}
+	i := m.index(current)
+	switch {
+	case current == 0:
+		return 0, nil
+	case i < 0:
+		return 0, fmt.Errorf("%w: the database is at version %d", ErrUnknownVersion, current)
+	case i-n < 0:
+		return m.Goto(ctx, 0)
+	default:
+		return m.Goto(ctx, m.Migrations[i-n].Version)
+	}
+}
+
+// Goto apply or revert the migrations one at a time until the target version is reached, 0 revert every
+// migration. The migrations run while the lock is held and the version is read again in the transaction of
+// every migration, so replicas running the migrations at the same time never apply a migration twice.
+func (m *Migrator) Goto(ctx context.Context, target int64) (int, error) {
+	if target != 0 && m.index(target) < 0 {
+		return 0, ErrUnknownVersion
+	}
+	err := m.createTable(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	conn, err := m.lock(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer m.unlock(conn)
+
+	n := 0
+	for {
+		var done bool
+		done, err = m.step(ctx, conn, target)
+		if err != nil || done {
+			return n, err
+		}
+		n++
+	}
+}
+
+// Force set the version without running any migration, used to clear the dirty flag after fixing a migration
+func (m *Migrator) Force(ctx context.Context, v int64) error {
+	if v != 0 && m.index(v) < 0 {
+		return ErrUnknownVersion
+	}
+	err := m.createTable(ctx)
+	if err != nil {
+		return err
+	}
+
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() //nolint:errcheck
+
+	err = setVersion(ctx, tx, v)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// step apply or revert one migration towards the target version, done is set when the target is reached
+func (m *Migrator) step(ctx context.Context, conn *sql.Conn, target int64) (bool, error) {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback() //nolint:errcheck
+
+	current, dirty, err := version(ctx, tx)
+	if err != nil {
+		return false, err
+	}
+	if dirty {
+		return false, ErrDirty
+	}
+	if current == target {
+		return true, nil
+	}
+
+	var i int
+	var stmt string
+	var next int64
+	switch {
+	case current < target:
+		// the first migration after the current version
+		for i < len(m.Migrations)-1 && m.Migrations[i].Version <= current {
+			i++
+		}
+		stmt, next = m.Migrations[i].up, m.Migrations[i].Version
+	case m.index(current) < 0:
+		return false, fmt.Errorf("%w: the database is at version %d", ErrUnknownVersion, current)
+	default:
+		i = m.index(current)
+		stmt = m.Migrations[i].down
+		if i > 0 {
+			next = m.Migrations[i-1].Version
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, stmt)
+	if err != nil {
+		return false, fmt.Errorf("migration %d: %w", m.Migrations[i].Version, err)
+	}
+	err = setVersion(ctx, tx, next)
+	if err != nil {
+		return false, err
+	}
+	return false, tx.Commit()
+}
+
+// index return the position of a version in the migrations or -1 when it is unknown
+func (m *Migrator) index(v int64) int {
+	for i, mig := range m.Migrations {
+		if mig.Version == v {
+			return i
+		}
+	}
+	return -1
+}
+
+// lock return the connection used to run the migrations, with Postgres it hold an advisory lock released by
+// unlock. SQLite only allow one writer and the DSN use immediate transactions so no lock is taken.
+func (m *Migrator) lock(ctx context.Context) (*sql.Conn, error) {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if m.backend == BackendPostgres {
+		_, err = conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, lockKey)
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
+
+func (m *Migrator) unlock(conn *sql.Conn) {
+	if m.backend == BackendPostgres {
+		conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1)`, lockKey) //nolint:errcheck
+	}
+	conn.Close()
+}
+
+func (m *Migrator) createTable(ctx context.Context) error {
+	_, err := m.db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version bigint NOT NULL PRIMARY KEY,
+		dirty boolean NOT NULL
+	)`)
+	return err
+}
+
+// querier is implemented by *sql.DB and *sql.Tx
+type querier interface {
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+func version(ctx context.Context, q querier) (int64, bool, error) {
+	var v int64
+	var dirty bool
+	err := q.QueryRowContext(ctx, `SELECT version, dirty FROM schema_migrations LIMIT 1`).Scan(&v, &dirty)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return 0, false, nil
+		default:
+			return 0, false, err
+		}
+	}
+	return v, dirty, nil
+}
+
+// setVersion store the version applied, no row is stored when every migration was reverted
+func setVersion(ctx context.Context, tx *sql.Tx, v int64) error {
+	_, err := tx.ExecContext(ctx, `DELETE FROM schema_migrations`)
+	if err != nil || v == 0 {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `INSERT INTO schema_migrations (version, dirty) VALUES ($1, false)`, v)
+	return err
+}
@@ -0,0 +1,13 @@
+DROP TABLE IF EXISTS movie_revisions;
+DROP TABLE IF EXISTS list_items;
+DROP TABLE IF EXISTS lists;
+DROP TABLE IF EXISTS reviews;
+DROP TABLE IF EXISTS user_permissions;
+DROP TABLE IF EXISTS permissions;
+DROP TABLE IF EXISTS tokens;
+DROP TABLE IF EXISTS users;
+DROP TABLE IF EXISTS credits;
+DROP TABLE IF EXISTS people;
+DROP TABLE IF EXISTS genres;
+DROP TABLE IF EXISTS movies_fts;
+DROP TABLE IF EXISTS movies;
@@ -0,0 +1,203 @@
+-- SQLite schema for the movies, genres, people, credits, reviews, lists, revisions, users, tokens and permissions,
+-- the genres and aliases are stored as JSON arrays and the titles are searched with FTS5
+CREATE TABLE IF NOT EXISTS movies (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    created_at datetime NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    title text NOT NULL,
+    year integer NOT NULL CHECK (year BETWEEN 1888 AND 2100),
+    runtime integer NOT NULL CHECK (runtime >= 0),
+    genres text NOT NULL DEFAULT '[]' CHECK (json_valid(genres) AND json_array_length(genres) BETWEEN 1 AND 5),
+    version integer NOT NULL DEFAULT 1,
+    deleted_at datetime,
+    rating_sum integer NOT NULL DEFAULT 0,
+    rating_count integer NOT NULL DEFAULT 0,
+    average_rating real NOT NULL DEFAULT 0,
+    poster text,
+    poster_key text
+);
+
+CREATE INDEX IF NOT EXISTS movie_deleted_at_idx ON movies (deleted_at) WHERE deleted_at IS NOT NULL;
+CREATE INDEX IF NOT EXISTS movie_average_rating_idx ON movies (average_rating, id);
+
+CREATE VIRTUAL TABLE IF NOT EXISTS movies_fts USING fts5(title, content='movies', content_rowid='id');
+
+CREATE TRIGGER IF NOT EXISTS movies_fts_insert AFTER INSERT ON movies BEGIN
+    INSERT INTO movies_fts (rowid, title) VALUES (NEW.id, NEW.title);
+END;
+
+CREATE TRIGGER IF NOT EXISTS movies_fts_delete AFTER DELETE ON movies BEGIN
+    INSERT INTO movies_fts (movies_fts, rowid, title) VALUES ('delete', OLD.id, OLD.title);
+END;
+
+CREATE TRIGGER IF NOT EXISTS movies_fts_update AFTER UPDATE OF title ON movies BEGIN
+    INSERT INTO movies_fts (movies_fts, rowid, title) VALUES ('delete', OLD.id, OLD.title);
+    INSERT INTO movies_fts (rowid, title) VALUES (NEW.id, NEW.title);
+END;
+
+CREATE TABLE IF NOT EXISTS genres (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    created_at datetime NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    slug text NOT NULL UNIQUE,
+    name text NOT NULL,
+    aliases text NOT NULL DEFAULT '[]' CHECK (json_valid(aliases)),
+    version integer NOT NULL DEFAULT 1
+);
+
+-- the default catalogue, the in-memory backend start with the same genres
+INSERT INTO genres (slug, name, aliases)
+VALUES
+    ('action', 'Action', '[]'),
+    ('adventure', 'Adventure', '[]'),
+    ('animation', 'Animation', '["animated"]'),
+    ('comedy', 'Comedy', '[]'),
+    ('crime', 'Crime', '[]'),
+    ('documentary', 'Documentary', '["doc"]'),
+    ('drama', 'Drama', '[]'),
+    ('family', 'Family', '[]'),
+    ('fantasy', 'Fantasy', '[]'),
+    ('history', 'History', '["historical"]'),
+    ('horror', 'Horror', '[]'),
+    ('music', 'Music', '["musical"]'),
+    ('mystery', 'Mystery', '[]'),
+    ('romance', 'Romance', '["romantic"]'),
+    ('sci-fi', 'Sci-Fi', '["science fiction","science-fiction","scifi"]'),
+    ('thriller', 'Thriller', '[]'),
+    ('war', 'War', '[]'),
+    ('western', 'Western', '[]')
+ON CONFLICT DO NOTHING;
+
+CREATE TABLE IF NOT EXISTS people (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    created_at datetime NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    name text NOT NULL,
+    birth_year integer NOT NULL DEFAULT 0,
+    version integer NOT NULL DEFAULT 1
+);
+
+CREATE TABLE IF NOT EXISTS credits (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    movie_id integer NOT NULL REFERENCES movies ON DELETE CASCADE,
+    person_id integer NOT NULL REFERENCES people ON DELETE CASCADE,
+    role text NOT NULL CHECK (role IN ('actor', 'director', 'writer')),
+    character text NOT NULL DEFAULT '',
+    billing_order integer NOT NULL DEFAULT 0
+);
+
+CREATE INDEX IF NOT EXISTS credits_movie_idx ON credits (movie_id);
+CREATE INDEX IF NOT EXISTS credits_person_idx ON credits (person_id);
+
+-- emails are compared ignoring case like citext
+CREATE TABLE IF NOT EXISTS users (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    created_at datetime NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    name text NOT NULL,
+    email text NOT NULL UNIQUE COLLATE NOCASE,
+    password_hash blob NOT NULL,
+    activated integer NOT NULL,
+    version integer NOT NULL DEFAULT 1
+);
+
+CREATE TABLE IF NOT EXISTS tokens (
+    hash blob PRIMARY KEY,
+    user_id integer NOT NULL REFERENCES users ON DELETE CASCADE,
+    expiry datetime NOT NULL,
+    scope text NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS permissions (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    code text NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS user_permissions (
+    user_id integer NOT NULL REFERENCES users ON DELETE CASCADE,
+    permission_id integer NOT NULL REFERENCES permissions ON DELETE CASCADE,
+    PRIMARY KEY (user_id, permission_id)
+);
+
+INSERT INTO permissions (code)
+VALUES
+    ('movies:read'),
+    ('movies:write'),
+    ('movies:admin');
+
+CREATE TABLE IF NOT EXISTS reviews (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    created_at datetime NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    movie_id integer NOT NULL REFERENCES movies ON DELETE CASCADE,
+    user_id integer NOT NULL REFERENCES users ON DELETE CASCADE,
+    rating integer NOT NULL CHECK (rating BETWEEN 1 AND 10),
+    body text NOT NULL DEFAULT '',
+    version integer NOT NULL DEFAULT 1,
+    UNIQUE (movie_id, user_id)
+);
+
+-- the rating aggregates are kept by the triggers like movies_rating_aggregate, the right side of SET read the
+-- values before the update and the cascaded deletes also fire the triggers
+CREATE TRIGGER IF NOT EXISTS reviews_rating_insert AFTER INSERT ON reviews BEGIN
+    UPDATE movies
+    SET rating_sum = rating_sum + NEW.rating,
+        rating_count = rating_count + 1,
+        average_rating = CAST(rating_sum + NEW.rating AS real) / (rating_count + 1)
+    WHERE id = NEW.movie_id;
+END;
+
+CREATE TRIGGER IF NOT EXISTS reviews_rating_update AFTER UPDATE OF rating ON reviews BEGIN
+    UPDATE movies
+    SET rating_sum = rating_sum - OLD.rating + NEW.rating,
+        average_rating = CAST(rating_sum - OLD.rating + NEW.rating AS real) / rating_count
+    WHERE id = NEW.movie_id;
+END;
+
+CREATE TRIGGER IF NOT EXISTS reviews_rating_delete AFTER DELETE ON reviews BEGIN
+    UPDATE movies
+    SET rating_sum = rating_sum - OLD.rating,
+        rating_count = rating_count - 1,
+        average_rating = COALESCE(CAST(rating_sum - OLD.rating AS real) / NULLIF(rating_count - 1, 0), 0)
+    WHERE id = OLD.movie_id;
+END;
+
+CREATE TABLE IF NOT EXISTS lists (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    created_at datetime NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    user_id integer NOT NULL REFERENCES users ON DELETE CASCADE,
+    name text NOT NULL,
+    is_default integer NOT NULL DEFAULT 0,
+    slug text UNIQUE,
+    version integer NOT NULL DEFAULT 1,
+    UNIQUE (user_id, name)
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS lists_default_idx ON lists (user_id) WHERE is_default;
+
+CREATE TABLE IF NOT EXISTS list_items (
+    list_id integer NOT NULL REFERENCES lists ON DELETE CASCADE,
+    movie_id integer NOT NULL REFERENCES movies ON DELETE CASCADE,
+    position integer NOT NULL,
+    added_at datetime NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    watched_at datetime,
+    PRIMARY KEY (list_id, movie_id)
+);
+
+CREATE INDEX IF NOT EXISTS list_items_movie_idx ON list_items (movie_id);
+
+-- the movies moved to the trash are removed from the lists like MovieModel.Delete does
+CREATE TRIGGER IF NOT EXISTS movies_trash_list_items AFTER UPDATE OF deleted_at ON movies
+WHEN NEW.deleted_at IS NOT NULL BEGIN
+    DELETE FROM list_items WHERE movie_id = NEW.id;
+END;
+
+CREATE TABLE IF NOT EXISTS movie_revisions (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    created_at datetime NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    movie_id integer NOT NULL REFERENCES movies ON DELETE CASCADE,
+    version integer NOT NULL,
+    action text NOT NULL CHECK (action IN ('insert', 'update', 'delete', 'restore')),
+    user_id integer REFERENCES users ON DELETE SET NULL,
+    title text NOT NULL,
+    year integer NOT NULL,
+    runtime integer NOT NULL,
+    genres text NOT NULL DEFAULT '[]' CHECK (json_valid(genres))
+);
+
+CREATE INDEX IF NOT EXISTS movie_revisions_movie_idx ON movie_revisions (movie_id, version);
@@ -0,0 +1,30 @@
+INSERT INTO permissions (code)
+VALUES
+    ('permissions:admin');
+
+CREATE TABLE IF NOT EXISTS roles (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    created_at datetime NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    name text NOT NULL UNIQUE,
+    version integer NOT NULL DEFAULT 1
+);
+
+CREATE TABLE IF NOT EXISTS role_permissions (
+    role_id integer NOT NULL REFERENCES roles ON DELETE CASCADE,
+    permission_id integer NOT NULL REFERENCES permissions ON DELETE CASCADE,
+    PRIMARY KEY (role_id, permission_id)
+);
+
+CREATE TABLE IF NOT EXISTS user_roles (
+    user_id integer NOT NULL REFERENCES users ON DELETE CASCADE,
+    role_id integer NOT NULL REFERENCES roles ON DELETE CASCADE,
+    PRIMARY KEY (user_id, role_id)
+);
+
+INSERT INTO roles (name)
+VALUES
+    ('editor');
+
+INSERT INTO role_permissions
+SELECT roles.id, permissions.id FROM roles, permissions
+WHERE roles.name = 'editor' AND permissions.code IN ('movies:read', 'movies:write');
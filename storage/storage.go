@@ -0,0 +1,100 @@
+package storage
+
+import (
+	"errors"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+var ErrInvalidKey = errors.New("invalid storage key")
+
+// Storage save the uploaded media, the keys are slash separated paths like posters/1/abc/w185.jpg
+type Storage interface {
+	// Put store the data under the key replacing any previous content
+	Put(key string, data []byte, contentType string) error
+	// Get return the content stored under the key, fs.ErrNotExist is returned when there is no file
+	Get(key string) ([]byte, error)
+	// DeletePrefix remove every file stored under the prefix
+	DeletePrefix(prefix string) error
+	// URL return the address used by the clients to download the file
+	URL(key string) string
+}
+
+// Local store the files in a directory of the local filesystem, the files are served by the API under baseURL
+type Local struct {
+	Dir     string
+	BaseURL string
+}
+
+// NewLocal return a Local storage creating the directory when it does not exist
+func NewLocal(dir, baseURL string) (*Local, error) {
+	err := os.MkdirAll(dir, 0o755) //nolint:gomnd
+	if err != nil {
+		return nil, err
+	}
+	return &Local{Dir: dir, BaseURL: strings.TrimSuffix(baseURL, "/")}, nil
+}
+
+// path return the filesystem path for a key, keys escaping the storage directory are rejected
+func (l *Local) path(key string) (string, error) {
+	clean := path.Clean("/" + key)
+	if clean == "/" || clean != "/"+key {
+		return "", ErrInvalidKey
+	}
+	return filepath.Join(l.Dir, filepath.FromSlash(clean)), nil
+}
+
+// Put write the file to a temporary file and rename it, so a file is never served partially written
+func (l *Local) Put(key string, data []byte, contentType string) error {
+	p, err := l.path(key)
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(p), 0o755) //nolint:gomnd
+	if err != nil {
+		return err
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(p), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name()) //nolint:errcheck
+
+	_, err = f.Write(data)
+	if err != nil {
+		f.Close()
+		return err
+	}
+	err = f.Close()
+	if err != nil {
+		return err
+	}
+	err = os.Chmod(f.Name(), 0o644) //nolint:gomnd
+	if err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), p)
+}
+
+func (l *Local) Get(key string) ([]byte, error) {
+	p, err := l.path(key)
+	if err != nil {
+		return nil, err
+	}
+	return os.ReadFile(p)
+}
+
+func (l *Local) DeletePrefix(prefix string) error {
+	p, err := l.path(strings.TrimSuffix(prefix, "/"))
+	if err != nil {
+		return err
+	}
+	return os.RemoveAll(p)
+}
+
+func (l *Local) URL(key string) string {
+	return l.BaseURL + "/" + key
+}